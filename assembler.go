@@ -0,0 +1,63 @@
+package quark
+
+import "fmt"
+
+// instruction is an instruction of a function being compiled, its operand
+// isn't limited to 24 bits and jumps target the index of an instruction
+// being compiled.
+type instruction struct {
+	opcode  Opcode
+	operand Operand
+}
+
+// assemble encodes the instructions of fn. An operand that doesn't fit in
+// 24 bits is prefixed by an OpExtendedArg holding its high bits. Prefixes
+// move the instructions after them, so jump targets are translated, which
+// may in turn make more jumps need a prefix.
+func assemble(fn *CompiledFunctionObject) {
+	code := fn.code
+	extended := make([]bool, len(code))
+	for i, inst := range code {
+		extended[i] = !isJump(inst.opcode) && inst.operand > InvalidOperand
+	}
+
+	// newIndex maps an instruction to the index of its first encoded one
+	newIndex := make([]int, len(code)+1)
+	for changed := true; changed; {
+		n := 0
+		for i := range code {
+			newIndex[i] = n
+			if extended[i] {
+				n++
+			}
+			n++
+		}
+		newIndex[len(code)] = n
+
+		changed = false
+		for i, inst := range code {
+			if isJump(inst.opcode) && !extended[i] && newIndex[inst.operand] > int(InvalidOperand) {
+				extended[i] = true
+				changed = true
+			}
+		}
+	}
+	if uint64(newIndex[len(code)]) > MaxOperand {
+		panic(fmt.Errorf("function '%s' has too many instructions", fn.Name))
+	}
+
+	result := make([]Instruction, 0, newIndex[len(code)])
+	for i, inst := range code {
+		operand := inst.operand
+		if isJump(inst.opcode) {
+			operand = Operand(newIndex[operand])
+		}
+		if extended[i] {
+			result = append(result, NewInstruction(OpExtendedArg, operand>>24))
+		}
+		result = append(result, NewInstruction(inst.opcode, operand))
+	}
+	fn.Instructions = result
+	fn.Lines.remap(newIndex)
+	fn.code = nil
+}
@@ -0,0 +1,49 @@
+package quark
+
+import (
+	"testing"
+
+	"github.com/janqx/quark-lang/v1/tokenize"
+)
+
+func TestAssemble_ExtendedArg(t *testing.T) {
+	wide := Operand(1<<24 + 5)
+	fn := &CompiledFunctionObject{
+		code: []instruction{
+			{OpLoadTrue, InvalidOperand},
+			{OpJumpIfFalse, 4},
+			{OpLoadConst, wide},
+			{OpStoreGlobal, wide + 1},
+			{OpLoadNull, InvalidOperand},
+			{OpReturn, 1},
+		},
+	}
+	for i := range fn.code {
+		fn.Lines.add(i, tokenize.Position{Line: i + 1})
+	}
+	assemble(fn)
+
+	expected := []Instruction{
+		NewInstruction(OpLoadTrue, InvalidOperand),
+		NewInstruction(OpJumpIfFalse, 6),
+		NewInstruction(OpExtendedArg, 1),
+		NewInstruction(OpLoadConst, 5),
+		NewInstruction(OpExtendedArg, 1),
+		NewInstruction(OpStoreGlobal, 6),
+		NewInstruction(OpLoadNull, InvalidOperand),
+		NewInstruction(OpReturn, 1),
+	}
+	if len(fn.Instructions) != len(expected) {
+		t.Fatalf("unexpected instructions %v", fn.Instructions)
+	}
+	for i := range expected {
+		if fn.Instructions[i] != expected[i] {
+			t.Fatalf("unexpected instructions %v", fn.Instructions)
+		}
+	}
+	for pc, line := range []int{1, 2, 3, 3, 4, 4, 5, 6} {
+		if l, _ := fn.Lines.Lookup(pc); l != line {
+			t.Errorf("#%d: unexpected line %d", pc, l)
+		}
+	}
+}
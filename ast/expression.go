@@ -26,6 +26,11 @@ func (node *ExpressionImpl) End() tokenize.Position {
 	return node.end
 }
 
+func (node *ExpressionImpl) SetPosition(start, end tokenize.Position) {
+	node.start = start
+	node.end = end
+}
+
 func (node *ExpressionImpl) String() string {
 	panic(fmt.Errorf("not implemented"))
 }
@@ -137,6 +142,20 @@ func (node *StringLiteralExpression) Accept(visitor Visitor) {
 	visitor.VisitStringLiteralExpression(node)
 }
 
+type BytesLiteralExpression struct {
+	ExpressionImpl
+	Value []byte
+	Proto string
+}
+
+func (node *BytesLiteralExpression) String() string {
+	return node.Proto
+}
+
+func (node *BytesLiteralExpression) Accept(visitor Visitor) {
+	visitor.VisitBytesLiteralExpression(node)
+}
+
 type ListLiteralExpression struct {
 	ExpressionImpl
 	Value *ExpressionList
@@ -153,6 +172,7 @@ func (node *ListLiteralExpression) Accept(visitor Visitor) {
 type DictLiteralExpression struct {
 	ExpressionImpl
 	Value map[string]Expression
+	Keys  []string // of Value in source order
 }
 
 func (node *DictLiteralExpression) String() string {
@@ -203,6 +223,29 @@ func (node *IndexAccessExpression) Accept(visitor Visitor) {
 	visitor.VisitIndexAccessExpression(node)
 }
 
+type SliceExpression struct {
+	ExpressionImpl
+	Value Expression
+	Low   Expression
+	High  Expression
+}
+
+func (node *SliceExpression) String() string {
+	s := node.Value.String() + "["
+	if node.Low != nil {
+		s += node.Low.String()
+	}
+	s += ":"
+	if node.High != nil {
+		s += node.High.String()
+	}
+	return s + "]"
+}
+
+func (node *SliceExpression) Accept(visitor Visitor) {
+	visitor.VisitSliceExpression(node)
+}
+
 type AttributeAccessExpression struct {
 	ExpressionImpl
 	Value  Expression
@@ -221,15 +264,18 @@ func (node *AttributeAccessExpression) Accept(visitor Visitor) {
 type FunctionDeclareExpression struct {
 	ExpressionImpl
 	ParameterNames []string
+	ParameterSpans []Span  // of the names
+	ParameterTypes []*Type // nil for parameters without an annotation
+	ReturnType     *Type
 	Body           Statement
 }
 
 func (node *FunctionDeclareExpression) String() string {
 	s := "fn("
 	if node.ParameterNames != nil {
-		s += strings.Join(node.ParameterNames, ",")
+		s += parameterString(node.ParameterNames, node.ParameterTypes)
 	}
-	s += ")" + node.Body.String()
+	s += ")" + returnTypeString(node.ReturnType) + node.Body.String()
 
 	return s
 }
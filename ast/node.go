@@ -5,6 +5,14 @@ import "github.com/janqx/quark-lang/v1/tokenize"
 type Node interface {
 	Start() tokenize.Position
 	End() tokenize.Position
+	SetPosition(start, end tokenize.Position)
 	String() string
 	Accept(visitor Visitor)
 }
+
+// Span is the position of a part of a node that isn't a node itself, e.g.
+// the name of a parameter. End is exclusive.
+type Span struct {
+	Start tokenize.Position
+	End   tokenize.Position
+}
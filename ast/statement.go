@@ -26,6 +26,11 @@ func (node *StatementImpl) End() tokenize.Position {
 	return node.end
 }
 
+func (node *StatementImpl) SetPosition(start, end tokenize.Position) {
+	node.start = start
+	node.end = end
+}
+
 func (node *StatementImpl) String() string {
 	panic(fmt.Errorf("not implemented"))
 }
@@ -195,15 +200,33 @@ func (node *ForStatement) Accept(visitor Visitor) {
 	visitor.VisitForStatement(node)
 }
 
+type ForInStatement struct {
+	StatementImpl
+	Name     string
+	Iterable Expression
+	Body     Statement
+}
+
+func (node *ForInStatement) String() string {
+	return "for " + node.Name + " in " + node.Iterable.String() + node.Body.String()
+}
+
+func (node *ForInStatement) Accept(visitor Visitor) {
+	visitor.VisitForInStatement(node)
+}
+
 type FunctionDeclareStatement struct {
 	StatementImpl
 	Name           string
 	ParameterNames []string
+	ParameterSpans []Span  // of the names
+	ParameterTypes []*Type // nil for parameters without an annotation
+	ReturnType     *Type
 	Body           Statement
 }
 
 func (node *FunctionDeclareStatement) String() string {
-	return "fn " + node.Name + "(" + strings.Join(node.ParameterNames, ",") + ")" + node.Body.String()
+	return "fn " + node.Name + "(" + parameterString(node.ParameterNames, node.ParameterTypes) + ")" + returnTypeString(node.ReturnType) + node.Body.String()
 }
 
 func (node *FunctionDeclareStatement) Accept(visitor Visitor) {
@@ -240,13 +263,18 @@ func (node *ExportStatement) Accept(visitor Visitor) {
 type AssignStatement struct {
 	StatementImpl
 	Assignables []Expression
+	Types       []*Type // nil when no assignable is annotated
 	Expressions *ExpressionList
 }
 
 func (node *AssignStatement) String() string {
 	assigns := make([]string, 0)
-	for _, assign := range node.Assignables {
-		assigns = append(assigns, assign.String())
+	for i, assign := range node.Assignables {
+		if i < len(node.Types) && node.Types[i] != nil {
+			assigns = append(assigns, assign.String()+": "+node.Types[i].String())
+		} else {
+			assigns = append(assigns, assign.String())
+		}
 	}
 	return strings.Join(assigns, ",") + "=" + node.Expressions.String()
 }
@@ -293,3 +321,33 @@ func (node *DebuggerStatement) String() string {
 func (node *DebuggerStatement) Accept(visitor Visitor) {
 	visitor.VisitDebuggerStatement(node)
 }
+
+// Terminates reports whether control never goes on after node, so that
+// the statements following it can't run: node returns, exports, breaks or
+// continues, or every branch of it does.
+func Terminates(node Statement) bool {
+	switch node := node.(type) {
+	case *ReturnStatement, *ExportStatement, *BreakStatement, *ContinueStatement:
+		return true
+	case *BlockStatement:
+		list := node.Statements.List
+		for i := len(list) - 1; i >= 0; i-- {
+			if _, ok := list[i].(*EmptyStatement); !ok {
+				return Terminates(list[i])
+			}
+		}
+		return false
+	case *IfStatement:
+		if node.ElseBody == nil || !Terminates(node.ThenBody) || !Terminates(node.ElseBody) {
+			return false
+		}
+		for _, elif := range node.Elifs {
+			if !Terminates(elif.Body) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
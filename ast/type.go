@@ -0,0 +1,53 @@
+package ast
+
+import (
+	"strings"
+
+	"github.com/janqx/quark-lang/v1/tokenize"
+)
+
+// Type is a type annotation, e.g. Int, List[String] or Dict[Int]?.
+// Annotations are only read by the static checker, the compiler ignores
+// them.
+type Type struct {
+	Name      string
+	Arguments []*Type
+	Nullable  bool
+	Start     tokenize.Position
+	End       tokenize.Position
+}
+
+func (t *Type) String() string {
+	s := t.Name
+	if len(t.Arguments) > 0 {
+		arguments := make([]string, len(t.Arguments))
+		for i, argument := range t.Arguments {
+			arguments[i] = argument.String()
+		}
+		s += "[" + strings.Join(arguments, ", ") + "]"
+	}
+	if t.Nullable {
+		s += "?"
+	}
+	return s
+}
+
+// parameterString formats a parameter list, types may be nil or contain
+// nil for parameters without an annotation.
+func parameterString(names []string, types []*Type) string {
+	parameters := make([]string, len(names))
+	for i, name := range names {
+		parameters[i] = name
+		if i < len(types) && types[i] != nil {
+			parameters[i] += ": " + types[i].String()
+		}
+	}
+	return strings.Join(parameters, ",")
+}
+
+func returnTypeString(t *Type) string {
+	if t == nil {
+		return ""
+	}
+	return " -> " + t.String()
+}
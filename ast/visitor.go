@@ -10,6 +10,7 @@ type Visitor interface {
 	VisitReturnStatement(node *ReturnStatement)
 	VisitIfStatement(node *IfStatement)
 	VisitForStatement(node *ForStatement)
+	VisitForInStatement(node *ForInStatement)
 	VisitFunctionDeclareStatement(node *FunctionDeclareStatement)
 	VisitImportStatement(node *ImportStatement)
 	VisitExportStatement(node *ExportStatement)
@@ -25,10 +26,12 @@ type Visitor interface {
 	VisitIntLiteralExpression(node *IntLiteralExpression)
 	VisitFloatLiteralExpression(node *FloatLiteralExpression)
 	VisitStringLiteralExpression(node *StringLiteralExpression)
+	VisitBytesLiteralExpression(node *BytesLiteralExpression)
 	VisitListLiteralExpression(node *ListLiteralExpression)
 	VisitDictLiteralExpression(node *DictLiteralExpression)
 	VisitIdentifierExpression(node *IdentifierExpression)
 	VisitIndexAccessExpression(node *IndexAccessExpression)
+	VisitSliceExpression(node *SliceExpression)
 	VisitAttributeAccessExpression(node *AttributeAccessExpression)
 	VisitFunctionDeclareExpression(node *FunctionDeclareExpression)
 	VisitCallFunctionExpression(node *CallFunctionExpression)
@@ -48,6 +51,7 @@ func (c *EmptyVisitor) VisitBlockStatement(node *BlockStatement)
 func (c *EmptyVisitor) VisitReturnStatement(node *ReturnStatement)                   {}
 func (c *EmptyVisitor) VisitIfStatement(node *IfStatement)                           {}
 func (c *EmptyVisitor) VisitForStatement(node *ForStatement)                         {}
+func (c *EmptyVisitor) VisitForInStatement(node *ForInStatement)                     {}
 func (c *EmptyVisitor) VisitFunctionDeclareStatement(node *FunctionDeclareStatement) {}
 func (c *EmptyVisitor) VisitImportStatement(node *ImportStatement)                   {}
 func (c *EmptyVisitor) VisitExportStatement(node *ExportStatement)                   {}
@@ -63,10 +67,12 @@ func (c *EmptyVisitor) VisitFalseLiteralExpression(node *FalseLiteralExpression)
 func (c *EmptyVisitor) VisitIntLiteralExpression(node *IntLiteralExpression)           {}
 func (c *EmptyVisitor) VisitFloatLiteralExpression(node *FloatLiteralExpression)       {}
 func (c *EmptyVisitor) VisitStringLiteralExpression(node *StringLiteralExpression)     {}
+func (c *EmptyVisitor) VisitBytesLiteralExpression(node *BytesLiteralExpression)       {}
 func (c *EmptyVisitor) VisitListLiteralExpression(node *ListLiteralExpression)         {}
 func (c *EmptyVisitor) VisitDictLiteralExpression(node *DictLiteralExpression)         {}
 func (c *EmptyVisitor) VisitIdentifierExpression(node *IdentifierExpression)           {}
 func (c *EmptyVisitor) VisitIndexAccessExpression(node *IndexAccessExpression)         {}
+func (c *EmptyVisitor) VisitSliceExpression(node *SliceExpression)                     {}
 func (c *EmptyVisitor) VisitAttributeAccessExpression(node *AttributeAccessExpression) {}
 func (c *EmptyVisitor) VisitFunctionDeclareExpression(node *FunctionDeclareExpression) {}
 func (c *EmptyVisitor) VisitCallFunctionExpression(node *CallFunctionExpression)       {}
@@ -3,8 +3,9 @@ package quark
 import (
 	"fmt"
 	"os"
-	"path/filepath"
+	"sort"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/janqx/quark-lang/v1/parser"
 )
@@ -15,18 +16,33 @@ var builtinObjects = map[string]Object{
 	"panic":     NewBuiltinFunction("panic", _panic, 1),
 	"input":     NewBuiltinFunction("input", _input, 1),
 	"format":    nil,
-	"copy":      nil,
+	"copy":      NewBuiltinFunction("copy", _copy, 1),
 	"length":    NewBuiltinFunction("length", _length, 1),
 	"typename":  NewBuiltinFunction("typename", _typename, 1),
 	"typeid":    nil,
-	"append":    nil,
-	"delete":    nil,
+	"append":    NewBuiltinFunction("append", _append, 2),
+	"delete":    NewBuiltinFunction("delete", _delete, 2),
 	"import":    NewBuiltinFunction("import", _import, 1),
 	"to_bool":   NewBuiltinFunction("to_bool", _to_bool, 1),
 	"to_int":    NewBuiltinFunction("to_int", _to_int, 1),
 	"to_float":  NewBuiltinFunction("to_float", _to_float, 1),
 	"to_string": NewBuiltinFunction("to_string", _to_string, 1),
 	"chr":       NewBuiltinFunction("chr", _chr, 1),
+	"encode":    NewBuiltinFunction("encode", _encode, 1),
+	"decode":    NewBuiltinFunction("decode", _decode, 1),
+	"bytes":     NewBuiltinFunction("bytes", _bytes, 1),
+}
+
+// BuiltinNames returns the sorted names of the builtin functions.
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtinObjects))
+	for name, value := range builtinObjects {
+		if value != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
 }
 
 func _print(ctx *Context, args []Object) (Object, error) {
@@ -63,7 +79,7 @@ func _input(ctx *Context, args []Object) (Object, error) {
 func _length(ctx *Context, args []Object) (Object, error) {
 	length, err := args[0].Length()
 	if err != nil {
-		return nil, err
+		return nil, typeError(err, "object of type '%s' has no length", args[0].TypeName())
 	}
 	return FromInterface(length)
 }
@@ -72,6 +88,46 @@ func _typename(ctx *Context, args []Object) (Object, error) {
 	return FromInterface(args[0].TypeName())
 }
 
+func _copy(ctx *Context, args []Object) (Object, error) {
+	value, err := args[0].Copy()
+	if err != nil {
+		return nil, typeError(err, "'%s' object can't be copied", args[0].TypeName())
+	}
+	return value, nil
+}
+
+// append adds a value to the end of a list in place and returns the list.
+func _append(ctx *Context, args []Object) (Object, error) {
+	list, ok := args[0].(*ListObject)
+	if !ok {
+		return nil, ErrInvalidArgument{
+			Name:     "list",
+			Expected: "List",
+			Found:    args[0].TypeName(),
+		}
+	}
+	list.Value = append(list.Value, args[1])
+	return list, nil
+}
+
+// delete removes a key from a dict or an index from a list.
+func _delete(ctx *Context, args []Object) (Object, error) {
+	switch x := args[0].(type) {
+	case *DictObject:
+		delete(x.Value, args[1].ToString())
+		return Null, nil
+	case *ListObject:
+		_, err := _list_pop(ctx, x, args[1:])
+		return Null, err
+	default:
+		return nil, ErrInvalidArgument{
+			Name:     "container",
+			Expected: "Dict or List",
+			Found:    args[0].TypeName(),
+		}
+	}
+}
+
 func _import(ctx *Context, args []Object) (Object, error) {
 	filename, ok := args[0].(*StringObject)
 	if !ok {
@@ -86,9 +142,8 @@ func _import(ctx *Context, args []Object) (Object, error) {
 
 	var err error
 	var moduleAbsolute string
-	if moduleAbsolute, err = filepath.Abs(filepath.Join(ctx.ImportBasePath, modulePath)); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(-1)
+	if moduleAbsolute, err = ctx.modulePath(modulePath); err != nil {
+		return nil, err
 	}
 
 	if module, ok := ctx.compiledModules[moduleAbsolute]; ok {
@@ -98,34 +153,54 @@ func _import(ctx *Context, args []Object) (Object, error) {
 	}
 
 	source, err := os.ReadFile(moduleAbsolute)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(-1)
-	}
-
-	p := parser.NewParser(filename.Value, source)
-	chunk, err := p.Parse()
 	if err != nil {
 		return nil, err
 	}
 
-	compiler := NewCompiler(ctx, nil)
-	compiled, err := compiler.Compile(chunk)
+	compiled, err := ctx.compileCached(moduleAbsolute, source, func() (*compiled, error) {
+		p := parser.NewParser(moduleAbsolute, source)
+		chunk, err := p.Parse()
+		if err != nil {
+			return nil, err
+		}
+
+		diagnostics := NewChecker(ctx).Check(chunk)
+		if diagnostics.HasErrors() {
+			return nil, diagnostics.Errors()
+		}
+
+		compiled, err := NewCompiler(ctx, nil).Compile(chunk)
+		if err != nil {
+			return nil, err
+		}
+		compiled.setSource(string(source))
+		compiled.warnings = diagnostics.Warnings()
+		return compiled, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	compiled.PrintInstructionList()
-
+	ctx.load(compiled)
 	vm := NewVM(ctx)
+	// a module without export exports null
+	exportIndex := ctx.exportObjectIndex
 	err = vm.Prepare(compiled.entryFunction, 0)
+	if err == nil {
+		_, err = vm.Execute()
+	}
+	var module Object = Null
+	if err == nil && ctx.exportObjectIndex > exportIndex {
+		module = ctx.exportObjects[exportIndex]
+	}
+	for i := exportIndex; i < ctx.exportObjectIndex; i++ {
+		ctx.exportObjects[i] = nil
+	}
+	ctx.exportObjectIndex = exportIndex
 	if err != nil {
 		return nil, err
 	}
 
-	ctx.exportObjectIndex--
-	module := ctx.exportObjects[ctx.exportObjectIndex]
-
 	ctx.compiledModules[moduleAbsolute] = module
 
 	return module, nil
@@ -171,3 +246,62 @@ func _chr(ctx *Context, args []Object) (Object, error) {
 
 	return NewString(string(rune(value.Value))), nil
 }
+
+func _encode(ctx *Context, args []Object) (Object, error) {
+	value, ok := args[0].(*StringObject)
+	if !ok {
+		return nil, ErrInvalidArgument{
+			Name:     "string",
+			Expected: "String",
+			Found:    args[0].TypeName(),
+		}
+	}
+
+	return NewBytes([]byte(value.Value)), nil
+}
+
+func _decode(ctx *Context, args []Object) (Object, error) {
+	value, ok := args[0].(*BytesObject)
+	if !ok {
+		return nil, ErrInvalidArgument{
+			Name:     "bytes",
+			Expected: "Bytes",
+			Found:    args[0].TypeName(),
+		}
+	}
+
+	if !utf8.Valid(value.Value) {
+		return nil, ErrInvalidUTF8
+	}
+	return NewString(string(value.Value)), nil
+}
+
+func _bytes(ctx *Context, args []Object) (Object, error) {
+	switch x := args[0].(type) {
+	case *IntObject:
+		if x.Value < 0 {
+			return nil, ErrIndexOutOfRange
+		}
+		return NewBytes(make([]byte, x.Value)), nil
+	case *StringObject:
+		return NewBytes([]byte(x.Value)), nil
+	case *BytesObject:
+		return x.Copy()
+	case *ListObject:
+		value := make([]byte, len(x.Value))
+		for i, item := range x.Value {
+			if item, ok := item.(*IntObject); !ok || item.Value < 0 || item.Value > 255 {
+				return nil, ErrInvalidByteValue
+			} else {
+				value[i] = byte(item.Value)
+			}
+		}
+		return NewBytes(value), nil
+	default:
+		return nil, ErrInvalidArgument{
+			Name:     "value",
+			Expected: "Int, String, Bytes or List",
+			Found:    args[0].TypeName(),
+		}
+	}
+}
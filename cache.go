@@ -0,0 +1,138 @@
+package quark
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/janqx/quark-lang/v1/diagnostic"
+	"github.com/janqx/quark-lang/v1/tokenize"
+)
+
+// DefaultCacheDir is created next to the compiled files unless the
+// context relocates the cache.
+const DefaultCacheDir = "__qkcache__"
+
+var cacheMagic = []byte("QKCACHE\x01")
+
+// cachePath returns where the compiled code of filename is cached.
+func (c *Context) cachePath(filename string) string {
+	name := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	if c.CacheDir == "" {
+		return filepath.Join(filepath.Dir(filename), DefaultCacheDir, name+BytecodeFileExt)
+	}
+	// the files of every directory share the relocated cache
+	sum := sha256.Sum256([]byte(filename))
+	return filepath.Join(c.CacheDir, name+"."+hex.EncodeToString(sum[:8])+BytecodeFileExt)
+}
+
+// cacheKey identifies what the cached code was compiled from and how, the
+// cache is only used if it matches exactly.
+func (c *Context) cacheKey(filename string, source []byte) []byte {
+	sum := sha256.Sum256(source)
+	return []byte(fmt.Sprintf("%s\x00%x\x00%d.%d.%d/%d\x00%d/%d/%t\x00",
+		filename, sum, VersionMajor, VersionMinor, VersionPatch, BytecodeVersion, c.Mode, c.OptimizationLevel, c.noFusion))
+}
+
+// compileCached returns the compiled code of the file filename, whose
+// content is source. The code is loaded from the cache if it was compiled
+// from the same source by the same version, otherwise compile is called
+// and its result cached. Failing to read or write the cache only makes
+// compile run.
+//
+// A cache file holds the magic, the key, the warnings of the checker,
+// which a hit reports again, and the bytecode.
+func (c *Context) compileCached(filename string, source []byte, compile func() (*compiled, error)) (*compiled, error) {
+	if c.DisableCache {
+		return compile()
+	}
+	path := c.cachePath(filename)
+	header := append(append([]byte(nil), cacheMagic...), c.cacheKey(filename, source)...)
+	if data, err := ioutil.ReadFile(path); err == nil && bytes.HasPrefix(data, header) {
+		r := &bytecodeReader{Reader: bytes.NewReader(data[len(header):])}
+		warnings := r.warnings()
+		if r.err == nil {
+			if result, err := unmarshal(c, data[len(data)-r.Len():]); err == nil {
+				result.setSource(string(source))
+				result.warnings = warnings
+				return result, nil
+			}
+		}
+	}
+
+	result, err := compile()
+	if err != nil {
+		return nil, err
+	}
+	if data, err := result.marshal(c); err == nil {
+		w := &bytecodeWriter{}
+		w.Write(header)
+		w.warnings(result.warnings)
+		w.Write(data)
+		c.writeCache(path, w.Bytes())
+	}
+	return result, nil
+}
+
+func (w *bytecodeWriter) warnings(warnings diagnostic.Diagnostics) {
+	position := func(p tokenize.Position) {
+		w.string(p.Filename)
+		w.int(p.Offset)
+		w.int(p.Line)
+		w.int(p.Column)
+	}
+	w.int(len(warnings))
+	for _, warning := range warnings {
+		position(warning.Start)
+		position(warning.End)
+		w.string(warning.Message)
+		w.int(len(warning.Hints))
+		for _, hint := range warning.Hints {
+			w.string(hint)
+		}
+	}
+}
+
+func (r *bytecodeReader) warnings() diagnostic.Diagnostics {
+	position := func() tokenize.Position {
+		return tokenize.Position{Filename: r.string(), Offset: r.int(), Line: r.int(), Column: r.int()}
+	}
+	var warnings diagnostic.Diagnostics
+	for i, n := 0, r.count(); i < n && r.err == nil; i++ {
+		start, end := position(), position()
+		message := r.string()
+		hints := make([]string, r.count())
+		for j := range hints {
+			hints[j] = r.string()
+		}
+		warnings = append(warnings, diagnostic.NewWarning(start, end, message, hints...))
+	}
+	return warnings
+}
+
+// writeCache replaces the cache file atomically, so concurrent processes
+// never read a partial file.
+func (c *Context) writeCache(path string, data []byte) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(data)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
@@ -0,0 +1,22 @@
+package quark
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestContext_CacheKey(t *testing.T) {
+	ctx := NewContext(ModeNormal, nil)
+	source := []byte("x = 1")
+	key := ctx.cacheKey("m.qk", source)
+	ctx.OptimizationLevel = OptimizeBasic
+	if bytes.Equal(key, ctx.cacheKey("m.qk", source)) {
+		t.Error("the optimization level isn't part of the key")
+	}
+	ctx.OptimizationLevel = OptimizeFull
+	key = ctx.cacheKey("m.qk", source)
+	ctx.noFusion = true
+	if bytes.Equal(key, ctx.cacheKey("m.qk", source)) {
+		t.Error("fusion isn't part of the key")
+	}
+}
@@ -0,0 +1,350 @@
+package quark
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/janqx/quark-lang/v1/ast"
+	"github.com/janqx/quark-lang/v1/diagnostic"
+	"github.com/janqx/quark-lang/v1/tokenize"
+)
+
+type checkVariable struct {
+	name      string
+	start     tokenize.Position
+	end       tokenize.Position
+	parameter bool
+	used      bool
+}
+
+// checkScope mirrors the symbol tables the compiler builds, a function
+// scope starts a new frame, a block scope only limits visibility.
+type checkScope struct {
+	parent    *checkScope
+	function  bool
+	variables map[string]*checkVariable
+	order     []*checkVariable
+}
+
+func newCheckScope(parent *checkScope, function bool) *checkScope {
+	return &checkScope{
+		parent:    parent,
+		function:  function,
+		variables: make(map[string]*checkVariable),
+	}
+}
+
+// Checker validates a chunk before it is compiled: it resolves identifiers
+// with the same scoping rules as the compiler and checks that break,
+// continue and export appear where they are allowed. Errors make the chunk
+// uncompilable, warnings point at code that is most likely a mistake.
+type Checker struct {
+	ctx         *Context
+	root        *checkScope
+	scope       *checkScope
+	loops       int
+	depth       int // of nested statement lists
+	diagnostics diagnostic.Diagnostics
+}
+
+func NewChecker(ctx *Context) *Checker {
+	return &Checker{
+		ctx: ctx,
+	}
+}
+
+// Check returns the problems found in chunk sorted by position, the chunk
+// may only be compiled if none of them is an error.
+func (c *Checker) Check(chunk *ast.Chunk) diagnostic.Diagnostics {
+	c.root = newCheckScope(nil, true)
+	c.scope = c.root
+	c.loops = 0
+	c.depth = 0
+	c.diagnostics = nil
+	chunk.Accept(c)
+	c.diagnostics.Sort()
+	return c.diagnostics
+}
+
+func (c *Checker) error(node ast.Node, format string, args ...interface{}) {
+	c.diagnostics = append(c.diagnostics, diagnostic.NewError(node.Start(), node.End(), fmt.Sprintf(format, args...)))
+}
+
+func (c *Checker) warning(start, end tokenize.Position, message string, hints ...string) {
+	c.diagnostics = append(c.diagnostics, diagnostic.NewWarning(start, end, message, hints...))
+}
+
+func (c *Checker) pushScope(function bool) {
+	c.scope = newCheckScope(c.scope, function)
+}
+
+// popScope leaves the current scope and reports the variables that were
+// assigned but never read. Variables of the root scope are visible to
+// importers and the REPL, so they are never reported.
+func (c *Checker) popScope() {
+	for _, v := range c.scope.order {
+		if !v.used && !v.parameter && !strings.HasPrefix(v.name, "_") {
+			c.warning(v.start, v.end, fmt.Sprintf("variable '%s' is declared but never used", v.name),
+				fmt.Sprintf("rename it to '_%s' if this is intentional", v.name))
+		}
+	}
+	c.scope = c.scope.parent
+}
+
+// lookup finds name in the enclosing scopes, global reports whether it
+// is a builtin or a global defined by a previous chunk.
+func (c *Checker) lookup(name string) (v *checkVariable, global bool) {
+	for scope := c.scope; scope != nil; scope = scope.parent {
+		if v, ok := scope.variables[name]; ok {
+			return v, false
+		}
+	}
+	return nil, c.ctx.globalSymbolTable.FindSymbol(name) != nil
+}
+
+func (c *Checker) declare(name string, node ast.Node) *checkVariable {
+	v := &checkVariable{
+		name:  name,
+		start: node.Start(),
+		end:   node.End(),
+	}
+	c.scope.variables[name] = v
+	if c.scope != c.root {
+		c.scope.order = append(c.scope.order, v)
+	}
+	return v
+}
+
+// checkFunction checks a function body in a scope of its own, loops of the
+// enclosing function can't be left from inside it.
+func (c *Checker) checkFunction(node ast.Node, parameterNames []string, body ast.Statement) {
+	loops := c.loops
+	c.loops = 0
+	c.pushScope(true)
+	for _, name := range parameterNames {
+		if v, global := c.lookup(name); v != nil {
+			c.warning(node.Start(), node.End(), fmt.Sprintf("parameter '%s' shadows a variable declared at %s", name, v.start.String()))
+		} else if global {
+			c.warning(node.Start(), node.End(), fmt.Sprintf("parameter '%s' shadows the global '%s'", name, name))
+		}
+		c.declare(name, node).parameter = true
+	}
+	body.Accept(c)
+	c.popScope()
+	c.loops = loops
+}
+
+func (c *Checker) checkLoopBody(body ast.Statement) {
+	c.loops++
+	body.Accept(c)
+	c.loops--
+}
+
+func (c *Checker) VisitChunk(node *ast.Chunk) {
+	node.Statements.Accept(c)
+}
+
+func (c *Checker) VisitStatementList(node *ast.StatementList) {
+	c.depth++
+	terminated := false
+	for i, s := range node.List {
+		if _, ok := s.(*ast.EmptyStatement); ok {
+			continue
+		}
+		if terminated {
+			c.warning(s.Start(), node.List[len(node.List)-1].End(), "unreachable code")
+			terminated = false
+		}
+		s.Accept(c)
+		if ast.Terminates(s) && i < len(node.List)-1 {
+			terminated = true
+		}
+	}
+	c.depth--
+}
+
+func (c *Checker) VisitContinueStatement(node *ast.ContinueStatement) {
+	if c.loops == 0 {
+		c.error(node, "'continue' outside loop")
+	}
+}
+
+func (c *Checker) VisitBreakStatement(node *ast.BreakStatement) {
+	if c.loops == 0 {
+		c.error(node, "'break' outside loop")
+	}
+}
+
+func (c *Checker) VisitBlockStatement(node *ast.BlockStatement) {
+	c.pushScope(false)
+	node.Statements.Accept(c)
+	c.popScope()
+}
+
+func (c *Checker) VisitReturnStatement(node *ast.ReturnStatement) {
+	node.Expressions.Accept(c)
+}
+
+func (c *Checker) VisitIfStatement(node *ast.IfStatement) {
+	node.Condition.Accept(c)
+	node.ThenBody.Accept(c)
+	for _, elif := range node.Elifs {
+		elif.Condition.Accept(c)
+		elif.Body.Accept(c)
+	}
+	if node.ElseBody != nil {
+		node.ElseBody.Accept(c)
+	}
+}
+
+func (c *Checker) VisitForStatement(node *ast.ForStatement) {
+	if node.Init != nil {
+		node.Init.Accept(c)
+	}
+	if node.Condition != nil {
+		node.Condition.Accept(c)
+	}
+	c.checkLoopBody(node.Body)
+	if node.Increment != nil {
+		node.Increment.Accept(c)
+	}
+}
+
+func (c *Checker) VisitForInStatement(node *ast.ForInStatement) {
+	node.Iterable.Accept(c)
+	if v, global := c.lookup(node.Name); v == nil && !global {
+		c.declare(node.Name, node)
+	}
+	c.checkLoopBody(node.Body)
+}
+
+func (c *Checker) VisitFunctionDeclareStatement(node *ast.FunctionDeclareStatement) {
+	if v, global := c.lookup(node.Name); v == nil && !global {
+		c.declare(node.Name, node)
+	}
+	c.checkFunction(node, node.ParameterNames, node.Body)
+}
+
+func (c *Checker) VisitImportStatement(node *ast.ImportStatement) {
+}
+
+func (c *Checker) VisitExportStatement(node *ast.ExportStatement) {
+	if c.depth != 1 || c.scope != c.root {
+		c.error(node, "'export' outside the top level")
+	}
+	node.Module.Accept(c)
+}
+
+func (c *Checker) VisitAssignStatement(node *ast.AssignStatement) {
+	node.Expressions.Accept(c)
+	for i := len(node.Assignables) - 1; i >= 0; i-- {
+		node.Assignables[i].Accept(c)
+	}
+}
+
+func (c *Checker) VisitCallFunctionStatement(node *ast.CallFunctionStatement) {
+	node.Args.Accept(c)
+	node.Callable.Accept(c)
+}
+
+func (c *Checker) VisitExpressionStatement(node *ast.ExpressionStatement) {
+	node.Expression.Accept(c)
+}
+
+func (c *Checker) VisitDebuggerStatement(node *ast.DebuggerStatement) {
+}
+
+func (c *Checker) VisitExpressionList(node *ast.ExpressionList) {
+	for _, e := range node.List {
+		e.Accept(c)
+	}
+}
+
+func (c *Checker) VisitNullLiteralExpression(node *ast.NullLiteralExpression) {
+}
+
+func (c *Checker) VisitTrueLiteralExpression(node *ast.TrueLiteralExpression) {
+}
+
+func (c *Checker) VisitFalseLiteralExpression(node *ast.FalseLiteralExpression) {
+}
+
+func (c *Checker) VisitIntLiteralExpression(node *ast.IntLiteralExpression) {
+}
+
+func (c *Checker) VisitFloatLiteralExpression(node *ast.FloatLiteralExpression) {
+}
+
+func (c *Checker) VisitStringLiteralExpression(node *ast.StringLiteralExpression) {
+}
+
+func (c *Checker) VisitBytesLiteralExpression(node *ast.BytesLiteralExpression) {
+}
+
+func (c *Checker) VisitListLiteralExpression(node *ast.ListLiteralExpression) {
+	node.Value.Accept(c)
+}
+
+func (c *Checker) VisitDictLiteralExpression(node *ast.DictLiteralExpression) {
+	for _, value := range node.Value {
+		value.Accept(c)
+	}
+}
+
+func (c *Checker) VisitIdentifierExpression(node *ast.IdentifierExpression) {
+	v, global := c.lookup(node.Name)
+	if node.Assign {
+		if v == nil && !global {
+			c.declare(node.Name, node)
+		}
+		return
+	}
+	if v != nil {
+		v.used = true
+	} else if !global {
+		c.error(node, "undeclared identifier '%s'", node.Name)
+	}
+}
+
+func (c *Checker) VisitIndexAccessExpression(node *ast.IndexAccessExpression) {
+	node.Value.Accept(c)
+	node.Index.Accept(c)
+}
+
+func (c *Checker) VisitSliceExpression(node *ast.SliceExpression) {
+	node.Value.Accept(c)
+	if node.Low != nil {
+		node.Low.Accept(c)
+	}
+	if node.High != nil {
+		node.High.Accept(c)
+	}
+}
+
+func (c *Checker) VisitAttributeAccessExpression(node *ast.AttributeAccessExpression) {
+	node.Value.Accept(c)
+}
+
+func (c *Checker) VisitFunctionDeclareExpression(node *ast.FunctionDeclareExpression) {
+	c.checkFunction(node, node.ParameterNames, node.Body)
+}
+
+func (c *Checker) VisitCallFunctionExpression(node *ast.CallFunctionExpression) {
+	node.Args.Accept(c)
+	node.Callable.Accept(c)
+}
+
+func (c *Checker) VisitUnaryExpression(node *ast.UnaryExpression) {
+	node.Expression.Accept(c)
+}
+
+func (c *Checker) VisitBinaryExpression(node *ast.BinaryExpression) {
+	node.Left.Accept(c)
+	node.Right.Accept(c)
+}
+
+func (c *Checker) VisitTernaryExpression(node *ast.TernaryExpression) {
+	node.Cond.Accept(c)
+	node.X.Accept(c)
+	node.Y.Accept(c)
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/janqx/quark-lang/v1"
+	"github.com/janqx/quark-lang/v1/dap"
+	"github.com/janqx/quark-lang/v1/stdlib"
+)
+
+const (
+	DEBUG_PROMPT = "(qdb) "
+	DEBUG_HELP   = `s, step            run to the next line, entering calls
+n, next            run to the next line of this function
+f, finish          run until this function returns
+c, continue        run until a breakpoint or a debugger statement
+b, break [file:]line
+                   pause before the line runs, list the breakpoints without a line
+clear [file:]line  remove a breakpoint
+bt, backtrace      show the active calls
+frame n, up, down  select the call inspected by the commands below
+locals             show the locals of the call
+outers             show the variables it sees from enclosing functions
+globals            show the globals
+p, print expr      evaluate an expression or a statement in the call
+q, quit            stop the program
+An empty line repeats the last step, next, finish or continue.
+`
+)
+
+// debugger reads the commands of the user whenever the program pauses.
+type debugger struct {
+	in     *bufio.Scanner
+	out    io.Writer
+	frames []*quark.DebugFrame
+	frame  int    // selected
+	last   string // step command repeated by an empty line
+}
+
+func (p *debugger) hook(d *quark.Debugger, reason quark.PauseReason) quark.DebugAction {
+	p.frames = d.Frames()
+	p.frame = 0
+	if reason != quark.PauseStep {
+		fmt.Fprintf(p.out, "%s\n", reason)
+	}
+	p.where()
+	for {
+		fmt.Fprint(p.out, DEBUG_PROMPT)
+		if !p.in.Scan() {
+			fmt.Fprintln(p.out)
+			return quark.DebugAbort
+		}
+		line := strings.TrimSpace(p.in.Text())
+		if line == "" {
+			line = p.last
+		}
+		command, arg := line, ""
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			command, arg = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		switch command {
+		case "":
+		case "s", "step":
+			p.last = command
+			return quark.DebugStepInto
+		case "n", "next":
+			p.last = command
+			return quark.DebugStepOver
+		case "f", "finish":
+			p.last = command
+			return quark.DebugStepOut
+		case "c", "continue":
+			p.last = command
+			return quark.DebugContinue
+		case "q", "quit":
+			return quark.DebugAbort
+		case "b", "break":
+			if arg == "" {
+				for _, b := range d.Breakpoints() {
+					fmt.Fprintf(p.out, "%s:%d\n", b.Filename, b.Line)
+				}
+			} else if filename, line, ok := p.location(arg); ok {
+				d.SetBreakpoint(filename, line)
+			}
+		case "clear":
+			if filename, line, ok := p.location(arg); ok && !d.ClearBreakpoint(filename, line) {
+				fmt.Fprintf(p.out, "no breakpoint at %s:%d\n", filename, line)
+			}
+		case "bt", "backtrace":
+			for i, frame := range p.frames {
+				marker := " "
+				if i == p.frame {
+					marker = ">"
+				}
+				fmt.Fprintf(p.out, "%s #%d %s at %s:%d\n", marker, i, frame.Function, frame.Filename, frame.Line)
+			}
+		case "frame":
+			if n, err := strconv.Atoi(arg); err != nil || n < 0 || n >= len(p.frames) {
+				fmt.Fprintf(p.out, "no frame '%s'\n", arg)
+			} else {
+				p.frame = n
+				p.where()
+			}
+		case "up":
+			if p.frame+1 < len(p.frames) {
+				p.frame++
+			}
+			p.where()
+		case "down":
+			if p.frame > 0 {
+				p.frame--
+			}
+			p.where()
+		case "locals":
+			p.variables(p.frames[p.frame].Locals())
+		case "outers":
+			p.variables(p.frames[p.frame].Outers())
+		case "globals":
+			p.variables(d.Globals())
+		case "p", "print":
+			if value, err := p.frames[p.frame].Evaluate(arg); err != nil {
+				fmt.Fprintln(p.out, err)
+			} else if value != quark.Null {
+				fmt.Fprintln(p.out, repr(value))
+			}
+		case "h", "help":
+			fmt.Fprint(p.out, DEBUG_HELP)
+		default:
+			fmt.Fprintf(p.out, "unknown command '%s', try help\n", command)
+		}
+	}
+}
+
+// where prints the position of the selected call.
+func (p *debugger) where() {
+	frame := p.frames[p.frame]
+	fmt.Fprintf(p.out, "%s:%d, in %s\n", frame.Filename, frame.Line, frame.Function)
+	if frame.SourceLine != "" {
+		fmt.Fprintf(p.out, "%4d  %s\n", frame.Line, frame.SourceLine)
+	}
+}
+
+// location parses [file:]line, the file defaults to that of the selected
+// call.
+func (p *debugger) location(s string) (string, int, bool) {
+	filename := p.frames[p.frame].Filename
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		filename, s = s[:i], s[i+1:]
+	}
+	line, err := strconv.Atoi(s)
+	if err != nil || line < 1 || filename == "" {
+		fmt.Fprintf(p.out, "invalid location '%s', expected [file:]line\n", s)
+		return "", 0, false
+	}
+	return filename, line, true
+}
+
+func (p *debugger) variables(vars []*quark.Variable) {
+	for _, v := range vars {
+		fmt.Fprintf(p.out, "%s = %s\n", v.Name(), repr(v.Value()))
+	}
+}
+
+func repr(value quark.Object) string {
+	if s, ok := value.(*quark.StringObject); ok {
+		return strconv.Quote(s.Value)
+	}
+	return value.ToString()
+}
+
+// debugFile runs a file under the debugger, it pauses before the first
+// line so that breakpoints can be set.
+func debugFile(filename string) {
+	ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+	p := &debugger{in: bufio.NewScanner(os.Stdin), out: os.Stdout}
+	d := quark.NewDebugger(p.hook)
+	d.Pause()
+	ctx.SetDebugger(d)
+	script := quark.NewScript(ctx)
+	err := script.RunFile(filename)
+	for _, warning := range script.Warnings() {
+		fmt.Fprintln(os.Stderr, warning)
+	}
+	if err != nil && !errors.Is(err, quark.ErrAborted) {
+		printError(err)
+		os.Exit(-1)
+	}
+}
+
+// debugAdapter serves a client of the Debug Adapter Protocol on the
+// standard input and output, or on the TCP address given with -listen.
+// The output of the program is sent to the client.
+func debugAdapter(args []string) {
+	flags := flag.NewFlagSet("dap", flag.ExitOnError)
+	listen := flags.String("listen", "", "accept a client on this local address, e.g. :4711 or 127.0.0.1:4711, instead of using stdio")
+	flags.Parse(args)
+
+	var in io.Reader = os.Stdin
+	var out io.Writer = os.Stdout
+	if *listen != "" {
+		address, err := loopbackAddress(*listen)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "listening on %s\n", listener.Addr())
+		conn, err := listener.Accept()
+		listener.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer conn.Close()
+		in, out = conn, conn
+	}
+
+	// the builtins print to os.Stdout, which carries the protocol with stdio
+	r, w, err := os.Pipe()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Stdout = w
+	server := dap.NewServer(in, out)
+	go server.Forward(r, "stdout")
+	if err := server.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// loopbackAddress returns address with 127.0.0.1 as the host if it has
+// none. A client can run any code through the adapter, so it only
+// listens on the loopback interface.
+func loopbackAddress(address string) (string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", err
+	}
+	if host == "" {
+		return net.JoinHostPort("127.0.0.1", port), nil
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return "", fmt.Errorf("%s isn't a loopback address, the adapter only accepts local clients", host)
+	}
+	return address, nil
+}
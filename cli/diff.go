@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const diffContext = 3
+
+type edit struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// differ finds the edits turning a list of lines into another with the
+// linear space refinement of Myers' algorithm: the middle snake of a
+// shortest edit path splits the lists, both halves are compared
+// recursively.
+type differ struct {
+	edits []edit
+}
+
+func (d *differ) add(kind byte, lines []string) {
+	for _, line := range lines {
+		d.edits = append(d.edits, edit{kind, line})
+	}
+}
+
+func (d *differ) compare(x, y []string) {
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+	d.add(' ', x[:prefix])
+	mx, my := x[prefix:len(x)-suffix], y[prefix:len(y)-suffix]
+	switch {
+	case len(mx) == 0:
+		d.add('+', my)
+	case len(my) == 0:
+		d.add('-', mx)
+	default:
+		x0, y0, x1, y1 := middleSnake(mx, my)
+		d.compare(mx[:x0], my[:y0])
+		d.add(' ', mx[x0:x1])
+		d.compare(mx[x1:], my[y1:])
+	}
+	d.add(' ', x[len(x)-suffix:])
+}
+
+// middleSnake returns the snake, from (x0, y0) to (x1, y1), in the middle
+// of a shortest edit path from x to y. The search runs forward from the
+// start and backward from the end until the paths overlap, it only keeps
+// the furthest point of each diagonal.
+func middleSnake(x, y []string) (x0, y0, x1, y1 int) {
+	n, m := len(x), len(y)
+	delta := n - m
+	odd := delta%2 != 0
+	max := (n + m + 1) / 2
+	offset := max + 1
+	// the furthest x reached on each diagonal, k = x - y forward and
+	// c = (n - x) - (m - y) backward, where x counts from the end
+	forward, backward := make([]int, 2*max+3), make([]int, 2*max+3)
+	for d := 0; d <= max; d++ {
+		for k := -d; k <= d; k += 2 {
+			var u int
+			if k == -d || k != d && forward[offset+k-1] < forward[offset+k+1] {
+				u = forward[offset+k+1]
+			} else {
+				u = forward[offset+k-1] + 1
+			}
+			v := u - k
+			su, sv := u, v
+			for u < n && v < m && x[u] == y[v] {
+				u++
+				v++
+			}
+			forward[offset+k] = u
+			if c := delta - k; odd && c >= -(d-1) && c <= d-1 && u+backward[offset+c] >= n {
+				return su, sv, u, v
+			}
+		}
+		for c := -d; c <= d; c += 2 {
+			var u int
+			if c == -d || c != d && backward[offset+c-1] < backward[offset+c+1] {
+				u = backward[offset+c+1]
+			} else {
+				u = backward[offset+c-1] + 1
+			}
+			v := u - c
+			su, sv := u, v
+			for u < n && v < m && x[n-1-u] == y[m-1-v] {
+				u++
+				v++
+			}
+			backward[offset+c] = u
+			if k := delta - c; !odd && k >= -d && k <= d && u+forward[offset+k] >= n {
+				return n - u, m - v, n - su, m - sv
+			}
+		}
+	}
+	panic("unreachable")
+}
+
+// diff returns the unified diff turning a into b, or "" if they're equal.
+func diff(name string, a, b []byte) string {
+	if string(a) == string(b) {
+		return ""
+	}
+	d := &differ{}
+	d.compare(splitLines(string(a)), splitLines(string(b)))
+	edits := d.edits
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s.orig\n+++ %s\n", name, name)
+	// line numbers in a and b before each edit
+	linesA, linesB := make([]int, len(edits)+1), make([]int, len(edits)+1)
+	for k, e := range edits {
+		linesA[k+1], linesB[k+1] = linesA[k], linesB[k]
+		if e.kind != '+' {
+			linesA[k+1]++
+		}
+		if e.kind != '-' {
+			linesB[k+1]++
+		}
+	}
+	for k := 0; k < len(edits); {
+		if edits[k].kind == ' ' {
+			k++
+			continue
+		}
+		// a hunk covers the changes closer than twice the context
+		start := k - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := k
+		for end < len(edits) {
+			if edits[end].kind != ' ' {
+				end++
+				continue
+			}
+			n := end
+			for n < len(edits) && edits[n].kind == ' ' {
+				n++
+			}
+			if n == len(edits) || n-end > 2*diffContext {
+				end += diffContext
+				if end > len(edits) {
+					end = len(edits)
+				}
+				break
+			}
+			end = n
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(linesA[start], linesA[end]), hunkRange(linesB[start], linesB[end]))
+		for _, e := range edits[start:end] {
+			out.WriteByte(e.kind)
+			out.WriteString(e.line)
+		}
+		k = end
+	}
+	return out.String()
+}
+
+func hunkRange(start, end int) string {
+	if end-start == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	if end == start {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, end-start)
+}
+
+// splitLines splits s after each newline, a last line without one gets
+// it added with the usual marker.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n\\ No newline at end of file\n"
+	return lines
+}
@@ -2,14 +2,22 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/janqx/quark-lang/v1"
+	"github.com/janqx/quark-lang/v1/format"
+	"github.com/janqx/quark-lang/v1/lint"
+	"github.com/janqx/quark-lang/v1/lsp"
+	"github.com/janqx/quark-lang/v1/parser"
 	"github.com/janqx/quark-lang/v1/stdlib"
+	"github.com/janqx/quark-lang/v1/typecheck"
 )
 
 const (
@@ -20,8 +28,22 @@ var (
 	flagShowVersion bool
 	flagShowHelp    bool
 	flagCmd         string
+	flagDisasm      bool
+	flagTrace       bool
+	flagTraceFormat string
+	flagTraceFunc   string
+	flagTraceModule string
+	flagTraceOut    string
 )
 
+func printError(err error) {
+	var traceback *quark.Traceback
+	if errors.As(err, &traceback) {
+		fmt.Fprintln(os.Stderr, traceback)
+	}
+	fmt.Fprintln(os.Stderr, err)
+}
+
 func repl() {
 	ctx := quark.NewContext(quark.ModeREPL, stdlib.LoadModules())
 	script := quark.NewScript(ctx)
@@ -41,7 +63,7 @@ func repl() {
 		}
 		result, err := script.RunString(line)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
+			printError(err)
 			continue
 		}
 		if result != nil && result != quark.Null {
@@ -50,33 +72,315 @@ func repl() {
 	}
 }
 
-func run(filename string) {
+// newContext returns the context of the file or string to run, with a
+// tracer if -trace is given. The returned function flushes the trace.
+func newContext() (*quark.Context, func()) {
 	ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+	if !flagTrace {
+		return ctx, func() {}
+	}
+	var out io.Writer = os.Stderr
+	if flagTraceOut != "" {
+		file, err := os.Create(flagTraceOut)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		out = file
+	}
+	w := bufio.NewWriter(out)
+	ctx.Tracer = &quark.Tracer{Writer: w}
+	switch flagTraceFormat {
+	case "text":
+	case "json":
+		ctx.Tracer.Format = quark.TraceJSON
+	default:
+		fmt.Fprintf(os.Stderr, "unknown trace format '%s', expected text or json\n", flagTraceFormat)
+		os.Exit(2)
+	}
+	if flagTraceFunc != "" {
+		ctx.Tracer.Functions = strings.Split(flagTraceFunc, ",")
+	}
+	if flagTraceModule != "" {
+		ctx.Tracer.Modules = strings.Split(flagTraceModule, ",")
+	}
+	return ctx, func() {
+		if err := ctx.Tracer.Err(); err != nil {
+			fmt.Fprintln(os.Stderr, "trace:", err)
+		} else if err := w.Flush(); err != nil {
+			fmt.Fprintln(os.Stderr, "trace:", err)
+		}
+		if file, ok := out.(*os.File); ok && file != os.Stderr {
+			file.Close()
+		}
+	}
+}
+
+func run(filename string) {
+	ctx, flush := newContext()
 	script := quark.NewScript(ctx)
-	if err := script.RunFile(filename); err != nil {
-		fmt.Fprintln(os.Stderr, err)
+	err := script.RunFile(filename)
+	flush()
+	for _, warning := range script.Warnings() {
+		fmt.Fprintln(os.Stderr, warning)
+	}
+	if err != nil {
+		printError(err)
 		os.Exit(-1)
 	}
 }
 
+// disassemble prints the bytecode of a file, or of source if filename is
+// empty.
+func disassemble(filename string, source string) {
+	script := quark.NewScript(quark.NewContext(quark.ModeNormal, stdlib.LoadModules()))
+	var text string
+	var err error
+	if filename != "" {
+		text, err = script.DisassembleFile(filename)
+	} else {
+		text, err = script.DisassembleString(source)
+	}
+	if err != nil {
+		printError(err)
+		os.Exit(-1)
+	}
+	fmt.Print(text)
+}
+
+// disassembleFiles prints the bytecode of each source or .qkc file, it
+// exits with a non-zero status if any couldn't be disassembled.
+func disassembleFiles(filenames []string) {
+	failed := false
+	for _, filename := range filenames {
+		script := quark.NewScript(quark.NewContext(quark.ModeNormal, stdlib.LoadModules()))
+		text, err := script.DisassembleFile(filename)
+		if err != nil {
+			printError(err)
+			failed = true
+			continue
+		}
+		if len(filenames) > 1 {
+			fmt.Printf("%s:\n", filename)
+		}
+		fmt.Print(text)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
 func execute(source string) {
-	ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+	ctx, flush := newContext()
 	script := quark.NewScript(ctx)
-	if _, err := script.RunString(source); err != nil {
-		fmt.Fprintln(os.Stderr, err)
+	_, err := script.RunString(source)
+	flush()
+	if err != nil {
+		printError(err)
 		os.Exit(-1)
 	}
 }
 
+// check reports the syntax, semantic and type errors of the given files
+// without running them, it exits with a non-zero status if any was found.
+func check(filenames []string) {
+	failed := false
+	for _, filename := range filenames {
+		source, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+			continue
+		}
+		chunk, err := parser.NewParser(filename, source).Parse()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+			continue
+		}
+		ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+		diagnostics := append(quark.NewChecker(ctx).Check(chunk), typecheck.Check(chunk)...)
+		diagnostics.Sort()
+		for _, d := range diagnostics {
+			fmt.Fprintln(os.Stderr, d)
+		}
+		failed = failed || diagnostics.HasErrors()
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// compile writes the bytecode of each file next to it, with the extension
+// replaced by .qkc, quark runs them without parsing the sources again.
+func compile(filenames []string) {
+	failed := false
+	for _, filename := range filenames {
+		source, err := os.ReadFile(filename)
+		if err == nil {
+			var data []byte
+			ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+			script := quark.NewScript(ctx)
+			if fullpath, e := filepath.Abs(filename); e == nil {
+				filename = fullpath
+			}
+			data, err = script.Compile(filename, string(source))
+			for _, warning := range script.Warnings() {
+				fmt.Fprintln(os.Stderr, warning)
+			}
+			if err == nil {
+				output := strings.TrimSuffix(filename, filepath.Ext(filename)) + quark.BytecodeFileExt
+				err = os.WriteFile(output, data, 0644)
+			}
+		}
+		if err != nil {
+			printError(err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// sourceFiles returns the files named by args, directories are searched
+// for .qk files.
+func sourceFiles(args []string) []string {
+	var filenames []string
+	for _, arg := range args {
+		err := filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() && info.Name() == quark.DefaultCacheDir {
+				return filepath.SkipDir
+			}
+			if !info.IsDir() && (path == arg || filepath.Ext(path) == ".qk") {
+				filenames = append(filenames, path)
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	return filenames
+}
+
+// formatFiles formats the given files, directories are searched for .qk
+// files. By default the formatted sources are printed, -check lists the
+// files that aren't formatted, -d prints the changes as diffs and -w writes
+// them back. The status is non-zero if a file can't be formatted or, with
+// -check or -d, if one isn't formatted.
+func formatFiles(args []string) {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	check := flags.Bool("check", false, "list the files whose formatting differs")
+	showDiff := flags.Bool("d", false, "print the changes as diffs")
+	write := flags.Bool("w", false, "write the formatted sources back to the files")
+	flags.Parse(args)
+
+	failed, unformatted := false, false
+	for _, filename := range sourceFiles(flags.Args()) {
+		source, err := os.ReadFile(filename)
+		var formatted []byte
+		if err == nil {
+			formatted, err = format.Source(filename, source)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+			continue
+		}
+		changed := string(formatted) != string(source)
+		unformatted = unformatted || changed
+		switch {
+		case *check || *showDiff || *write:
+			if changed && *check {
+				fmt.Println(filename)
+			}
+			if changed && *showDiff {
+				fmt.Print(diff(filename, source, formatted))
+			}
+			if changed && *write {
+				if err := os.WriteFile(filename, formatted, 0644); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					failed = true
+				}
+			}
+		default:
+			os.Stdout.Write(formatted)
+		}
+	}
+	if failed {
+		os.Exit(2)
+	}
+	if unformatted && !*write && (*check || *showDiff) {
+		os.Exit(1)
+	}
+}
+
+// lintFiles reports the lint problems of the given files, directories are
+// searched for .qk files. The rules are configured by the file given with
+// -config, or by .quarklint.json in the current directory if it exists.
+// The status is non-zero if a problem was found.
+func lintFiles(args []string) {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	configFile := flags.String("config", "", "read the configuration of the rules from this file")
+	asJSON := flags.Bool("json", false, "print the problems as a JSON array")
+	flags.Parse(args)
+
+	config := lint.DefaultConfig()
+	if *configFile == "" {
+		if _, err := os.Stat(".quarklint.json"); err == nil {
+			*configFile = ".quarklint.json"
+		}
+	}
+	if *configFile != "" {
+		var err error
+		if config, err = lint.LoadConfig(*configFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+
+	problems := []lint.Problem{}
+	for _, filename := range sourceFiles(flags.Args()) {
+		source, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		problems = append(problems, lint.Source(filename, source, config)...)
+	}
+	if *asJSON {
+		data, _ := json.MarshalIndent(problems, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+	}
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+}
+
 func main() {
 	flag.BoolVar(&flagShowVersion, "version", false, "show version information")
 	flag.BoolVar(&flagShowHelp, "help", false, "show help information")
 	flag.StringVar(&flagCmd, "c", "", "execute string")
+	flag.BoolVar(&flagDisasm, "disasm", false, "print the bytecode of the file or string instead of running it")
+	flag.BoolVar(&flagTrace, "trace", false, "log every instruction executed by the file or string")
+	flag.StringVar(&flagTraceFormat, "trace-format", "text", "format of the trace, text or json (JSON Lines)")
+	flag.StringVar(&flagTraceFunc, "trace-func", "", "only trace these comma-separated functions")
+	flag.StringVar(&flagTraceModule, "trace-module", "", "only trace the functions of these comma-separated files, e.g. main or lib.qk")
+	flag.StringVar(&flagTraceOut, "trace-out", "", "write the trace to this file instead of stderr")
 	flag.Parse()
 
 	if flagShowHelp {
 		_, executable := filepath.Split(os.Args[0])
-		fmt.Printf("Usage: %s [file] [options]\nOptions:\n", executable)
+		fmt.Printf("Usage: %s [file] [options]\n       %s check file...\n       %s compile file...\n       %s disasm file...\n       %s fmt [-check] [-d] [-w] file|dir...\n       %s lint [-json] [-config file] file|dir...\n       %s lsp\n       %s debug file\n       %s dap [-listen address]\nOptions:\n", executable, executable, executable, executable, executable, executable, executable, executable, executable)
 		flag.PrintDefaults()
 		os.Exit(0)
 	} else if flagShowVersion {
@@ -84,11 +388,71 @@ func main() {
 		os.Exit(0)
 	}
 
+	if flagDisasm {
+		if flagCmd == "" && flag.Arg(0) == "" {
+			fmt.Fprintln(os.Stderr, "-disasm needs a file or -c")
+			os.Exit(2)
+		}
+		disassemble(flag.Arg(0), flagCmd)
+		os.Exit(0)
+	}
+
 	if flagCmd != "" {
 		execute(flagCmd)
 		os.Exit(0)
 	}
 
+	if flag.Arg(0) == "check" {
+		check(flag.Args()[1:])
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "compile" {
+		compile(flag.Args()[1:])
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "disasm" {
+		if flag.NArg() < 2 {
+			fmt.Fprintln(os.Stderr, "disasm needs a file")
+			os.Exit(2)
+		}
+		disassembleFiles(flag.Args()[1:])
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "fmt" {
+		formatFiles(flag.Args()[1:])
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "lint" {
+		lintFiles(flag.Args()[1:])
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "debug" {
+		if flag.NArg() != 2 {
+			fmt.Fprintln(os.Stderr, "debug needs a file")
+			os.Exit(2)
+		}
+		debugFile(flag.Arg(1))
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "dap" {
+		debugAdapter(flag.Args()[1:])
+		os.Exit(0)
+	}
+
+	if flag.Arg(0) == "lsp" {
+		if err := lsp.NewServer(os.Stdin, os.Stdout).Run(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	filename := flag.Arg(0)
 	if filename == "" {
 		repl()
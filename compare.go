@@ -0,0 +1,310 @@
+package quark
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+)
+
+// Equality and ordering rules shared by all builtin types.
+//
+// == is structural: Int and Float compare by numeric value, String and
+// Bytes by content, List element-wise and Dict by key set and values.
+// Values of different types (other than Int/Float) are never equal.
+// Functions, closures and iterators are only equal to themselves.
+//
+// < defines a total order. Values of different types are ordered by type:
+//
+//	Null < Bool < Int/Float < String < Bytes < List < Dict < others
+//
+// Within a type, false < true, numbers by value (NaN before every other
+// number), strings by code point, bytes by value, lists lexicographically
+// and dicts by their sorted (key, value) pairs.
+
+// comparePair identifies a pair of containers being compared, it guards
+// against infinite recursion on self-referencing lists and dicts.
+type comparePair struct {
+	x, y Object
+}
+
+// Equals reports whether x == y holds.
+func Equals(x, y Object) bool {
+	return equals(x, y, nil)
+}
+
+func equals(x, y Object, seen map[comparePair]bool) bool {
+	switch x := x.(type) {
+	case *NullObject:
+		_, ok := y.(*NullObject)
+		return ok
+	case *BoolObject:
+		y, ok := y.(*BoolObject)
+		return ok && x.Value == y.Value
+	case *IntObject:
+		switch y := y.(type) {
+		case *IntObject:
+			return x.Value == y.Value
+		case *FloatObject:
+			return !math.IsNaN(y.Value) && compareIntFloat(x.Value, y.Value) == 0
+		}
+		return false
+	case *FloatObject:
+		switch y := y.(type) {
+		case *IntObject:
+			return !math.IsNaN(x.Value) && compareIntFloat(y.Value, x.Value) == 0
+		case *FloatObject:
+			return x.Value == y.Value
+		}
+		return false
+	case *StringObject:
+		y, ok := y.(*StringObject)
+		return ok && x.Value == y.Value
+	case *BytesObject:
+		y, ok := y.(*BytesObject)
+		return ok && bytes.Equal(x.Value, y.Value)
+	case *ListObject:
+		y, ok := y.(*ListObject)
+		if !ok || len(x.Value) != len(y.Value) {
+			return false
+		}
+		if x == y {
+			return true
+		}
+		pair := comparePair{x, y}
+		if seen[pair] {
+			return true
+		}
+		if seen == nil {
+			seen = make(map[comparePair]bool)
+		}
+		seen[pair] = true
+		for i := range x.Value {
+			if !equals(x.Value[i], y.Value[i], seen) {
+				return false
+			}
+		}
+		return true
+	case *DictObject:
+		y, ok := y.(*DictObject)
+		if !ok || len(x.Value) != len(y.Value) {
+			return false
+		}
+		if x == y {
+			return true
+		}
+		pair := comparePair{x, y}
+		if seen[pair] {
+			return true
+		}
+		if seen == nil {
+			seen = make(map[comparePair]bool)
+		}
+		seen[pair] = true
+		for key, value := range x.Value {
+			other, ok := y.Value[key]
+			if !ok || !equals(value, other, seen) {
+				return false
+			}
+		}
+		return true
+	case *BuiltinFunctionObject, *CompiledFunctionObject, *ClosureObject, *IteratorObject:
+		return x == y
+	default:
+		if x == y {
+			return true
+		}
+		result, err := x.BinaryEq(y)
+		return err == nil && result.ToBool()
+	}
+}
+
+// Compare returns -1, 0 or +1 depending on whether x is less than, equal
+// to or greater than y in the total order described above.
+func Compare(x, y Object) int {
+	return compare(x, y, nil)
+}
+
+func compare(x, y Object, seen map[comparePair]bool) int {
+	if rx, ry := typeRank(x), typeRank(y); rx != ry {
+		return compareInt(int64(rx), int64(ry))
+	}
+	switch x := x.(type) {
+	case *NullObject:
+		return 0
+	case *BoolObject:
+		return compareInt(int64(x.HashCode()), int64(y.HashCode()))
+	case *IntObject:
+		switch y := y.(type) {
+		case *IntObject:
+			return compareInt(x.Value, y.Value)
+		case *FloatObject:
+			return compareIntFloat(x.Value, y.Value)
+		}
+	case *FloatObject:
+		switch y := y.(type) {
+		case *IntObject:
+			return -compareIntFloat(y.Value, x.Value)
+		case *FloatObject:
+			return compareFloat(x.Value, y.Value)
+		}
+	case *StringObject:
+		// byte order of UTF-8 is the same as code point order
+		return strings.Compare(x.Value, y.(*StringObject).Value)
+	case *BytesObject:
+		return bytes.Compare(x.Value, y.(*BytesObject).Value)
+	case *ListObject:
+		y := y.(*ListObject)
+		pair := comparePair{x, y}
+		if x == y || seen[pair] {
+			return 0
+		}
+		if seen == nil {
+			seen = make(map[comparePair]bool)
+		}
+		seen[pair] = true
+		for i := 0; i < len(x.Value) && i < len(y.Value); i++ {
+			if result := compare(x.Value[i], y.Value[i], seen); result != 0 {
+				return result
+			}
+		}
+		return compareInt(int64(len(x.Value)), int64(len(y.Value)))
+	case *DictObject:
+		y := y.(*DictObject)
+		pair := comparePair{x, y}
+		if x == y || seen[pair] {
+			return 0
+		}
+		if seen == nil {
+			seen = make(map[comparePair]bool)
+		}
+		seen[pair] = true
+		xkeys, ykeys := sortedKeys(x), sortedKeys(y)
+		for i := 0; i < len(xkeys) && i < len(ykeys); i++ {
+			if result := strings.Compare(xkeys[i], ykeys[i]); result != 0 {
+				return result
+			}
+			if result := compare(x.Value[xkeys[i]], y.Value[ykeys[i]], seen); result != 0 {
+				return result
+			}
+		}
+		return compareInt(int64(len(xkeys)), int64(len(ykeys)))
+	}
+	// everything else has no natural order, keep it stable by type and text
+	if result := strings.Compare(x.TypeName(), y.TypeName()); result != 0 {
+		return result
+	}
+	return strings.Compare(x.ToString(), y.ToString())
+}
+
+func typeRank(x Object) int {
+	switch x.(type) {
+	case *NullObject:
+		return 0
+	case *BoolObject:
+		return 1
+	case *IntObject, *FloatObject:
+		return 2
+	case *StringObject:
+		return 3
+	case *BytesObject:
+		return 4
+	case *ListObject:
+		return 5
+	case *DictObject:
+		return 6
+	default:
+		return 7
+	}
+}
+
+func compareInt(x, y int64) int {
+	if x < y {
+		return -1
+	} else if x > y {
+		return 1
+	}
+	return 0
+}
+
+func compareFloat(x, y float64) int {
+	switch xnan, ynan := math.IsNaN(x), math.IsNaN(y); {
+	case xnan && ynan:
+		return 0
+	case xnan:
+		return -1
+	case ynan:
+		return 1
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// compareIntFloat compares without converting x to float64, which would
+// lose precision above 2^53.
+func compareIntFloat(x int64, y float64) int {
+	switch {
+	case math.IsNaN(y):
+		return 1
+	case y >= math.MaxInt64:
+		return -1
+	case y < math.MinInt64:
+		return 1
+	}
+	t := math.Trunc(y)
+	if result := compareInt(x, int64(t)); result != 0 {
+		return result
+	}
+	return -compareFloat(y, t)
+}
+
+// floatHashCode matches the hash of an equal Int for integral values.
+func floatHashCode(value float64) int {
+	if t := math.Trunc(value); t == value && value >= math.MinInt64 && value < math.MaxInt64 {
+		return int(int64(t))
+	}
+	return int(math.Float64bits(value) ^ math.Float64bits(value)>>32)
+}
+
+// maxHashDepth bounds how deep HashCode looks into nested containers, so
+// self-referencing values still hash in finite time. Equal values always
+// hash equally because the cut-off does not depend on identity.
+const maxHashDepth = 4
+
+func hashCode(x Object, depth int) int {
+	switch x := x.(type) {
+	case *ListObject:
+		h := 17 + len(x.Value)
+		if depth < maxHashDepth {
+			for _, item := range x.Value {
+				h = h*31 + hashCode(item, depth+1)
+			}
+		}
+		return h
+	case *DictObject:
+		h := 19 + len(x.Value)
+		if depth < maxHashDepth {
+			// order independent, map iteration order is random
+			for key, value := range x.Value {
+				h += hashString(key) ^ hashCode(value, depth+1)
+			}
+		}
+		return h
+	default:
+		return x.HashCode()
+	}
+}
+
+func hashString(value string) int {
+	h := fnv.New32a()
+	h.Write([]byte(value))
+	return int(h.Sum32())
+}
+
+func hashIdentity(x Object) int {
+	return hashString(fmt.Sprintf("%p", x))
+}
@@ -1,21 +1,22 @@
 package quark
 
-import "fmt"
+import (
+	"strings"
+
+	"github.com/janqx/quark-lang/v1/diagnostic"
+)
 
 type compiled struct {
 	entryFunction     *CompiledFunctionObject
 	compiledFunctions []*CompiledFunctionObject
+	warnings          diagnostic.Diagnostics // of the checker, kept by the cache
 }
 
-func (c *compiled) PrintInstructionList() {
-	fmt.Printf("PrintInstructionList(%d):\n", len(c.entryFunction.Instructions))
+// setSource records the source the functions were compiled from, errors,
+// tracebacks and the debugger show its lines.
+func (c *compiled) setSource(source string) {
+	lines := strings.Split(source, "\n")
 	for _, fn := range c.compiledFunctions {
-		fmt.Println("---> compiled-function: " + fn.Name)
-		var index int = 0
-		for _, ins := range fn.Instructions {
-			fmt.Printf("#%d: %s\n", index, ins.String())
-			index++
-		}
+		fn.source = lines
 	}
-	fmt.Println()
 }
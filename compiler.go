@@ -13,6 +13,7 @@ type loopState struct {
 }
 
 type Compiler struct {
+	OptimizationLevel  OptimizationLevel
 	ctx                *Context
 	parent             *Compiler
 	loops              []*loopState
@@ -20,17 +21,20 @@ type Compiler struct {
 	currentSymbolTable *SymbolTable
 	currentFunction    *CompiledFunctionObject
 	compiled           *compiled
+	constants          *constantPool
+	position           tokenize.Position // of the node being compiled
 }
 
 func NewCompiler(ctx *Context, parent *Compiler) *Compiler {
 	return &Compiler{
-		ctx:    ctx,
-		parent: parent,
+		OptimizationLevel: ctx.OptimizationLevel,
+		ctx:               ctx,
+		parent:            parent,
 	}
 }
 
 func (c *Compiler) mark() int {
-	return len(c.currentFunction.Instructions)
+	return len(c.currentFunction.code)
 }
 
 func (c *Compiler) emit1(opcode Opcode) {
@@ -38,14 +42,24 @@ func (c *Compiler) emit1(opcode Opcode) {
 }
 
 func (c *Compiler) emit2(opcode Opcode, operand Operand) {
-	c.addInstruction(NewInstruction(opcode, operand))
+	c.currentFunction.Lines.add(len(c.currentFunction.code), c.position)
+	c.currentFunction.code = append(c.currentFunction.code, instruction{opcode, operand})
 }
-func (c *Compiler) addInstruction(inst Instruction) {
-	c.currentFunction.Instructions = append(c.currentFunction.Instructions, inst)
+
+// visit compiles node, instructions emitted meanwhile are attributed to its
+// position. Nodes without a position, e.g. synthesized ones, keep the
+// position of their parent.
+func (c *Compiler) visit(node ast.Node) {
+	prev := c.position
+	if start := node.Start(); start.Line > 0 {
+		c.position = start
+	}
+	node.Accept(c)
+	c.position = prev
 }
 
 func (c *Compiler) setInstructionOperand(index int, operand Operand) {
-	c.currentFunction.Instructions[index] = NewInstruction(c.currentFunction.Instructions[index].Opcode(), operand)
+	c.currentFunction.code[index].operand = operand
 }
 
 func (c *Compiler) addContinueMark(mark int) {
@@ -65,16 +79,37 @@ func (c *Compiler) popLoopState() {
 	c.loopIndex--
 }
 
+// Compile generates code for a chunk that passed the Checker, a chunk that
+// didn't may still trip the compiler, which is reported as an error.
 func (c *Compiler) Compile(chunk *ast.Chunk) (*compiled, error) {
-	result := c.compileChunk(chunk)
+	return c.compile(chunk, nil)
+}
+
+// compile resolves the names of chunk in scope, or in the context if it is
+// nil.
+func (c *Compiler) compile(chunk *ast.Chunk, scope *SymbolTable) (result *compiled, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = nil
+			if e, ok := r.(error); ok {
+				err = e
+			} else {
+				err = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+	result = c.compileChunk(chunk, scope)
 	return result, c.ctx.err
 }
 
-func (c *Compiler) compileChunk(chunk *ast.Chunk) *compiled {
+func (c *Compiler) compileChunk(chunk *ast.Chunk, scope *SymbolTable) *compiled {
 	c.loops = make([]*loopState, 32)
 	c.loopIndex = -1
+	c.constants = newConstantPool()
 
-	if c.ctx.Mode == ModeREPL {
+	if scope != nil {
+		c.currentSymbolTable = scope.Push(TypeFunction)
+	} else if c.ctx.Mode == ModeREPL {
 		c.currentSymbolTable = c.ctx.globalSymbolTable
 	} else {
 		c.currentSymbolTable = c.ctx.globalSymbolTable.Push(TypeFunction)
@@ -82,9 +117,9 @@ func (c *Compiler) compileChunk(chunk *ast.Chunk) *compiled {
 
 	c.currentFunction = &CompiledFunctionObject{
 		Name:           "<compiled-function entry>",
-		Instructions:   make([]Instruction, 0),
 		ParameterNames: []string{},
 		SymbolTable:    c.currentSymbolTable,
+		Filename:       chunk.Start().Filename,
 	}
 
 	c.compiled = &compiled{
@@ -92,20 +127,35 @@ func (c *Compiler) compileChunk(chunk *ast.Chunk) *compiled {
 		compiledFunctions: []*CompiledFunctionObject{c.currentFunction},
 	}
 
-	chunk.Accept(c)
+	c.visit(chunk)
+
+	for _, fn := range c.compiled.compiledFunctions {
+		fn.Constants = c.constants.values
+		if c.OptimizationLevel >= OptimizeFull {
+			optimizeInstructions(fn)
+		}
+		assemble(fn)
+		if c.OptimizationLevel >= OptimizeFull && !c.ctx.noFusion {
+			fuseInstructions(fn)
+		}
+	}
 
 	return c.compiled
 }
 
 func (c *Compiler) VisitChunk(node *ast.Chunk) {
-	node.Statements.Accept(c)
+	c.visit(node.Statements)
 	c.emit1(OpLoadNull)
 	c.emit1(OpReturn)
 }
 
 func (c *Compiler) VisitStatementList(node *ast.StatementList) {
 	for _, s := range node.List {
-		s.Accept(c)
+		c.visit(s)
+		if c.OptimizationLevel >= OptimizeBasic && ast.Terminates(s) {
+			// the rest can never run
+			break
+		}
 	}
 }
 
@@ -121,26 +171,36 @@ func (c *Compiler) VisitBreakStatement(node *ast.BreakStatement) {
 
 func (c *Compiler) VisitBlockStatement(node *ast.BlockStatement) {
 	c.currentSymbolTable = c.currentSymbolTable.Push(TypeBlock)
-	node.Statements.Accept(c)
+	c.visit(node.Statements)
 	c.currentSymbolTable = c.currentSymbolTable.Pop()
 }
 
 func (c *Compiler) VisitReturnStatement(node *ast.ReturnStatement) {
-	node.Expressions.Accept(c)
+	c.visit(node.Expressions)
 	c.emit2(OpReturn, Operand(node.Expressions.Count()))
 }
 
 func (c *Compiler) VisitIfStatement(node *ast.IfStatement) {
+	if c.OptimizationLevel >= OptimizeBasic {
+		var elseBody ast.Statement
+		if node, elseBody = c.pruneBranches(node); node == nil {
+			if elseBody != nil {
+				c.visit(elseBody)
+			}
+			return
+		}
+	}
+
 	jumpNextMark := -1
 	jumpElseMark := -1
 	quitIfMarks := make([]int, 0)
 
-	node.Condition.Accept(c)
+	c.visit(node.Condition)
 
 	jumpNextMark = c.mark()
 	c.emit2(OpJumpIfFalse, InvalidOperand)
 
-	node.ThenBody.Accept(c)
+	c.visit(node.ThenBody)
 
 	quitIfMarks = append(quitIfMarks, c.mark())
 	c.emit2(OpJump, InvalidOperand)
@@ -148,7 +208,7 @@ func (c *Compiler) VisitIfStatement(node *ast.IfStatement) {
 	if len(node.Elifs) > 0 {
 		for i, elif := range node.Elifs {
 			c.setInstructionOperand(jumpNextMark, Operand(c.mark()))
-			elif.Condition.Accept(c)
+			c.visit(elif.Condition)
 
 			jumpNextMark = c.mark()
 			c.emit2(OpJumpIfFalse, InvalidOperand)
@@ -157,7 +217,7 @@ func (c *Compiler) VisitIfStatement(node *ast.IfStatement) {
 				jumpElseMark = jumpNextMark
 			}
 
-			elif.Body.Accept(c)
+			c.visit(elif.Body)
 
 			quitIfMarks = append(quitIfMarks, c.mark())
 			c.emit2(OpJump, InvalidOperand)
@@ -168,7 +228,7 @@ func (c *Compiler) VisitIfStatement(node *ast.IfStatement) {
 
 	c.setInstructionOperand(jumpElseMark, Operand(c.mark()))
 	if node.ElseBody != nil {
-		node.ElseBody.Accept(c)
+		c.visit(node.ElseBody)
 	}
 
 	for _, mark := range quitIfMarks {
@@ -182,24 +242,31 @@ func (c *Compiler) VisitForStatement(node *ast.ForStatement) {
 	c.pushLoopState()
 
 	if node.Init != nil {
-		node.Init.Accept(c)
+		c.visit(node.Init)
 	}
 
 	startLoopMark := c.mark()
 
-	if node.Condition != nil {
-		node.Condition.Accept(c)
+	if value, ok := c.constantCondition(node.Condition); node.Condition == nil || ok {
+		if node.Condition != nil && !value {
+			c.popLoopState()
+			return
+		}
+		if c.OptimizationLevel < OptimizeBasic {
+			c.emit1(OpLoadTrue)
+			c.addBreakMark(c.mark())
+			c.emit1(OpJumpIfFalse)
+		}
 	} else {
-		c.emit1(OpLoadTrue)
+		c.visit(node.Condition)
+		c.addBreakMark(c.mark())
+		c.emit1(OpJumpIfFalse)
 	}
 
-	c.addBreakMark(c.mark())
-	c.emit1(OpJumpIfFalse)
-
-	node.Body.Accept(c)
+	c.visit(node.Body)
 
 	if node.Increment != nil {
-		node.Increment.Accept(c)
+		c.visit(node.Increment)
 	}
 
 	c.emit2(OpJump, Operand(startLoopMark))
@@ -218,6 +285,37 @@ func (c *Compiler) VisitForStatement(node *ast.ForStatement) {
 	c.popLoopState()
 }
 
+func (c *Compiler) VisitForInStatement(node *ast.ForInStatement) {
+	c.pushLoopState()
+
+	c.visit(node.Iterable)
+	c.emit1(OpIterInit)
+
+	startLoopMark := c.mark()
+
+	c.addBreakMark(c.mark())
+	c.emit1(OpIterNext)
+
+	c.visit(&ast.IdentifierExpression{Name: node.Name, Assign: true})
+
+	c.visit(node.Body)
+
+	c.emit2(OpJump, Operand(startLoopMark))
+
+	quitLoopMark := c.mark()
+	c.emit1(OpRemoveTop)
+
+	for _, mark := range c.loops[c.loopIndex].continues {
+		c.setInstructionOperand(mark, Operand(startLoopMark))
+	}
+
+	for _, mark := range c.loops[c.loopIndex].breaks {
+		c.setInstructionOperand(mark, Operand(quitLoopMark))
+	}
+
+	c.popLoopState()
+}
+
 func (c *Compiler) VisitFunctionDeclareStatement(node *ast.FunctionDeclareStatement) {
 	symbol := c.currentSymbolTable.FindSymbol(node.Name)
 	if symbol == nil {
@@ -231,22 +329,22 @@ func (c *Compiler) VisitFunctionDeclareStatement(node *ast.FunctionDeclareStatem
 
 	fn := &CompiledFunctionObject{}
 	fn.Name = name
-	fn.Instructions = make([]Instruction, 0)
 	fn.ParameterNames = node.ParameterNames[:]
 	fn.SymbolTable = c.currentSymbolTable
+	fn.Filename = prev.Filename
 
 	c.compiled.compiledFunctions = append(c.compiled.compiledFunctions, fn)
 	c.currentFunction = fn
 	for _, name := range fn.ParameterNames {
 		c.currentSymbolTable.AddLocalSymbol(name)
 	}
-	node.Body.Accept(c)
+	c.visit(node.Body)
 	c.emit1(OpLoadNull)
 	c.emit1(OpReturn)
 
 	c.currentSymbolTable = c.currentSymbolTable.Pop()
 	c.currentFunction = prev
-	c.emit2(OpLoadConst, Operand(c.ctx.appendConstant(fn)))
+	c.emit2(OpLoadConst, Operand(c.constants.append(fn)))
 	c.emit1(OpClosure)
 
 	switch symbol.Scope {
@@ -260,30 +358,30 @@ func (c *Compiler) VisitFunctionDeclareStatement(node *ast.FunctionDeclareStatem
 }
 
 func (c *Compiler) VisitImportStatement(node *ast.ImportStatement) {
-	c.emit2(OpImport, Operand(c.ctx.addStringConstant(node.Path)))
+	c.emit2(OpImport, Operand(c.constants.addString(node.Path)))
 }
 
 func (c *Compiler) VisitExportStatement(node *ast.ExportStatement) {
-	node.Module.Accept(c)
+	c.visit(node.Module)
 	c.emit1(OpExport)
 }
 
 func (c *Compiler) VisitAssignStatement(node *ast.AssignStatement) {
-	node.Expressions.Accept(c)
+	c.visit(node.Expressions)
 	for i := len(node.Assignables) - 1; i >= 0; i-- {
-		node.Assignables[i].Accept(c)
+		c.visit(node.Assignables[i])
 	}
 }
 
 func (c *Compiler) VisitCallFunctionStatement(node *ast.CallFunctionStatement) {
-	node.Args.Accept(c)
-	node.Callable.Accept(c)
+	c.visit(node.Args)
+	c.visit(node.Callable)
 	c.emit2(OpCall, Operand(node.Args.Count()))
 	c.emit1(OpRemoveTop)
 }
 
 func (c *Compiler) VisitExpressionStatement(node *ast.ExpressionStatement) {
-	node.Expression.Accept(c)
+	c.visit(node.Expression)
 	c.emit1(OpRemoveTop)
 }
 
@@ -293,7 +391,7 @@ func (c *Compiler) VisitDebuggerStatement(node *ast.DebuggerStatement) {
 
 func (c *Compiler) VisitExpressionList(node *ast.ExpressionList) {
 	for _, e := range node.List {
-		e.Accept(c)
+		c.visit(e)
 	}
 }
 
@@ -311,26 +409,33 @@ func (c *Compiler) VisitFalseLiteralExpression(node *ast.FalseLiteralExpression)
 }
 
 func (c *Compiler) VisitIntLiteralExpression(node *ast.IntLiteralExpression) {
-	c.emit2(OpLoadConst, Operand(c.ctx.addIntConstant(node.Value)))
+	c.emit2(OpLoadConst, Operand(c.constants.addInt(node.Value)))
 }
 
 func (c *Compiler) VisitFloatLiteralExpression(node *ast.FloatLiteralExpression) {
-	c.emit2(OpLoadConst, Operand(c.ctx.addFloatConstant(node.Value)))
+	c.emit2(OpLoadConst, Operand(c.constants.addFloat(node.Value)))
 }
 
 func (c *Compiler) VisitStringLiteralExpression(node *ast.StringLiteralExpression) {
-	c.emit2(OpLoadConst, Operand(c.ctx.addStringConstant(node.Value)))
+	c.emit2(OpLoadConst, Operand(c.constants.addString(node.Value)))
+}
+
+// Bytes are mutable, every evaluation of the literal gets its own copy of
+// the constant.
+func (c *Compiler) VisitBytesLiteralExpression(node *ast.BytesLiteralExpression) {
+	c.emit2(OpLoadConst, Operand(c.constants.addBytes(node.Value)))
+	c.emit1(OpCopy)
 }
 
 func (c *Compiler) VisitListLiteralExpression(node *ast.ListLiteralExpression) {
-	node.Value.Accept(c)
+	c.visit(node.Value)
 	c.emit2(OpBuildList, Operand(node.Value.Count()))
 }
 
 func (c *Compiler) VisitDictLiteralExpression(node *ast.DictLiteralExpression) {
 	for k, v := range node.Value {
-		c.emit2(OpLoadConst, Operand(c.ctx.addStringConstant(k)))
-		v.Accept(c)
+		c.emit2(OpLoadConst, Operand(c.constants.addString(k)))
+		c.visit(v)
 	}
 	c.emit2(OpBuildDict, Operand(len(node.Value)))
 }
@@ -370,8 +475,8 @@ func (c *Compiler) VisitIdentifierExpression(node *ast.IdentifierExpression) {
 }
 
 func (c *Compiler) VisitIndexAccessExpression(node *ast.IndexAccessExpression) {
-	node.Value.Accept(c)
-	node.Index.Accept(c)
+	c.visit(node.Value)
+	c.visit(node.Index)
 	if node.Assign {
 		c.emit1(OpStoreIndex)
 	} else {
@@ -379,9 +484,24 @@ func (c *Compiler) VisitIndexAccessExpression(node *ast.IndexAccessExpression) {
 	}
 }
 
+func (c *Compiler) VisitSliceExpression(node *ast.SliceExpression) {
+	c.visit(node.Value)
+	if node.Low != nil {
+		c.visit(node.Low)
+	} else {
+		c.emit1(OpLoadNull)
+	}
+	if node.High != nil {
+		c.visit(node.High)
+	} else {
+		c.emit1(OpLoadNull)
+	}
+	c.emit1(OpLoadSlice)
+}
+
 func (c *Compiler) VisitAttributeAccessExpression(node *ast.AttributeAccessExpression) {
-	node.Value.Accept(c)
-	c.emit2(OpLoadConst, Operand(c.ctx.addStringConstant(node.Name)))
+	c.visit(node.Value)
+	c.emit2(OpLoadConst, Operand(c.constants.addString(node.Name)))
 	if node.Assign {
 		c.emit1(OpStoreAttribute)
 	} else {
@@ -397,116 +517,150 @@ func (c *Compiler) VisitFunctionDeclareExpression(node *ast.FunctionDeclareExpre
 
 	fn := &CompiledFunctionObject{}
 	fn.Name = name
-	fn.Instructions = make([]Instruction, 0)
 	fn.ParameterNames = node.ParameterNames[:]
 	fn.SymbolTable = c.currentSymbolTable
+	fn.Filename = prev.Filename
 
 	c.compiled.compiledFunctions = append(c.compiled.compiledFunctions, fn)
 	c.currentFunction = fn
 	for _, name := range fn.ParameterNames {
 		c.currentSymbolTable.AddLocalSymbol(name)
 	}
-	node.Body.Accept(c)
+	c.visit(node.Body)
 	c.emit1(OpLoadNull)
 	c.emit1(OpReturn)
 
 	c.currentSymbolTable = c.currentSymbolTable.Pop()
 	c.currentFunction = prev
-	c.emit2(OpLoadConst, Operand(c.ctx.appendConstant(fn)))
+	c.emit2(OpLoadConst, Operand(c.constants.append(fn)))
 	c.emit1(OpClosure)
 }
 
 func (c *Compiler) VisitCallFunctionExpression(node *ast.CallFunctionExpression) {
-	node.Args.Accept(c)
-	node.Callable.Accept(c)
+	c.visit(node.Args)
+	c.visit(node.Callable)
 	c.emit2(OpCall, Operand(node.Args.Count()))
 }
 
 func (c *Compiler) VisitUnaryExpression(node *ast.UnaryExpression) {
-	node.Expression.Accept(c)
-	var op Opcode
-	switch node.Op {
+	if c.foldConstant(node) {
+		return
+	}
+	c.visit(node.Expression)
+	c.emit1(unaryOpcode(node.Op))
+}
+
+func unaryOpcode(tt tokenize.TokenType) Opcode {
+	switch tt {
 	case tokenize.TokenPlus:
-		op = OpUnaryPlus
+		return OpUnaryPlus
 	case tokenize.TokenMinus:
-		op = OpUnaryMinus
+		return OpUnaryMinus
 	case tokenize.TokenBitNot:
-		op = OpUnaryBitNot
+		return OpUnaryBitNot
 	case tokenize.TokenNot:
-		op = OpUnaryNot
+		return OpUnaryNot
 	default:
-		panic(fmt.Errorf("invalid unary operator: %s", tokenize.TokenTypeToString[node.Op]))
+		panic(fmt.Errorf("invalid unary operator: %s", tokenize.TokenTypeToString[tt]))
 	}
-	c.emit1(op)
 }
 
 func (c *Compiler) VisitBinaryExpression(node *ast.BinaryExpression) {
+	if c.foldConstant(node) {
+		return
+	}
+	if node.Op == tokenize.TokenLogicAnd || node.Op == tokenize.TokenLogicOr {
+		// a constant left operand decides whether the right one is evaluated
+		if value, ok := c.constantCondition(node.Left); ok {
+			if value == (node.Op == tokenize.TokenLogicAnd) {
+				c.visit(node.Right)
+			} else {
+				c.visit(node.Left)
+			}
+			return
+		}
+	}
 	if node.Op == tokenize.TokenLogicAnd {
-		node.Left.Accept(c)
+		c.visit(node.Left)
 		mark := c.mark()
 		c.emit1(OpJumpIfFalseOrPop)
-		node.Right.Accept(c)
+		c.visit(node.Right)
 		c.setInstructionOperand(mark, Operand(c.mark()))
 		return
 	} else if node.Op == tokenize.TokenLogicOr {
-		node.Left.Accept(c)
+		c.visit(node.Left)
 		mark := c.mark()
 		c.emit1(OpJumpIfTrueOrPop)
-		node.Right.Accept(c)
+		c.visit(node.Right)
 		c.setInstructionOperand(mark, Operand(c.mark()))
 		return
 	}
 
-	node.Left.Accept(c)
-	node.Right.Accept(c)
-	var op Opcode
-	switch node.Op {
+	c.visit(node.Left)
+	c.visit(node.Right)
+	c.emit1(binaryOpcode(node.Op))
+}
+
+func binaryOpcode(tt tokenize.TokenType) Opcode {
+	switch tt {
 	case tokenize.TokenPlus:
-		op = OpBinaryAdd
+		return OpBinaryAdd
 	case tokenize.TokenMinus:
-		op = OpBinarySub
+		return OpBinarySub
 	case tokenize.TokenMul:
-		op = OpBinaryMul
+		return OpBinaryMul
 	case tokenize.TokenDiv:
-		op = OpBinaryDiv
+		return OpBinaryDiv
 	case tokenize.TokenMod:
-		op = OpBinaryMod
+		return OpBinaryMod
 	case tokenize.TokenLT:
-		op = OpBinaryLT
+		return OpBinaryLT
 	case tokenize.TokenLTE:
-		op = OpBinaryLTE
+		return OpBinaryLTE
 	case tokenize.TokenGT:
-		op = OpBinaryGT
+		return OpBinaryGT
 	case tokenize.TokenGTE:
-		op = OpBinaryGTE
+		return OpBinaryGTE
 	case tokenize.TokenEQ:
-		op = OpBinaryEQ
+		return OpBinaryEQ
 	case tokenize.TokenNEQ:
-		op = OpBinaryNEQ
+		return OpBinaryNEQ
+	case tokenize.TokenIs:
+		return OpBinaryIs
 	case tokenize.TokenBitAnd:
-		op = OpBinaryBitAnd
+		return OpBinaryBitAnd
 	case tokenize.TokenBitOr:
-		op = OpBinaryBitOr
+		return OpBinaryBitOr
 	case tokenize.TokenBitXor:
-		op = OpBinaryBitXor
+		return OpBinaryBitXor
 	case tokenize.TokenBitLhs:
-		op = OpBinaryBitLhs
+		return OpBinaryBitLhs
 	case tokenize.TokenBitRhs:
-		op = OpBinaryBitRhs
+		return OpBinaryBitRhs
 	default:
-		panic(fmt.Errorf("invalid binary operator: %s", tokenize.TokenTypeToString[node.Op]))
+		panic(fmt.Errorf("invalid binary operator: %s", tokenize.TokenTypeToString[tt]))
 	}
-	c.emit1(op)
 }
 
 func (c *Compiler) VisitTernaryExpression(node *ast.TernaryExpression) {
-	node.Cond.Accept(c)
+	if c.foldConstant(node) {
+		return
+	}
+	if value, ok := c.constantCondition(node.Cond); ok {
+		if value {
+			c.visit(node.X)
+		} else {
+			c.visit(node.Y)
+		}
+		return
+	}
+	c.visit(node.Cond)
 	mark1 := c.mark()
 	c.emit1(OpJumpIfFalse)
-	node.X.Accept(c)
+	c.visit(node.X)
 	mark2 := c.mark()
 	c.emit1(OpJump)
 	c.setInstructionOperand(mark1, Operand(c.mark()))
-	node.Y.Accept(c)
+	c.visit(node.Y)
 	c.setInstructionOperand(mark2, Operand(c.mark()))
 }
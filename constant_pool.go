@@ -0,0 +1,67 @@
+package quark
+
+import "fmt"
+
+// constantPool collects the constants of a compiled chunk. The functions of
+// the chunk share it, so it is released together with them.
+type constantPool struct {
+	values  []Object
+	ints    map[int64]int
+	floats  map[float64]int
+	strings map[string]int
+	bytes   map[string]int
+}
+
+func newConstantPool() *constantPool {
+	return &constantPool{
+		values:  make([]Object, 0),
+		ints:    make(map[int64]int),
+		floats:  make(map[float64]int),
+		strings: make(map[string]int),
+		bytes:   make(map[string]int),
+	}
+}
+
+func (p *constantPool) append(value Object) int {
+	if uint64(len(p.values)) > MaxOperand {
+		panic(fmt.Errorf("too many constants"))
+	}
+	p.values = append(p.values, value)
+	return len(p.values) - 1
+}
+
+func (p *constantPool) addInt(value int64) int {
+	if index, ok := p.ints[value]; ok {
+		return index
+	}
+	index := p.append(NewInt(value))
+	p.ints[value] = index
+	return index
+}
+
+func (p *constantPool) addFloat(value float64) int {
+	if index, ok := p.floats[value]; ok {
+		return index
+	}
+	index := p.append(NewFloat(value))
+	p.floats[value] = index
+	return index
+}
+
+func (p *constantPool) addString(value string) int {
+	if index, ok := p.strings[value]; ok {
+		return index
+	}
+	index := p.append(NewString(value))
+	p.strings[value] = index
+	return index
+}
+
+func (p *constantPool) addBytes(value []byte) int {
+	if index, ok := p.bytes[string(value)]; ok {
+		return index
+	}
+	index := p.append(NewBytes(value))
+	p.bytes[string(value)] = index
+	return index
+}
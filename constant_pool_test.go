@@ -0,0 +1,32 @@
+package quark
+
+import (
+	"testing"
+
+	"github.com/janqx/quark-lang/v1/parser"
+)
+
+func TestConstantPool_PerChunk(t *testing.T) {
+	ctx := NewContext(ModeREPL, nil)
+	var pools [][]Object
+	for _, source := range []string{"x = \"a\" + \"b\"", "fn f() { return 1.5 }\ny = 2"} {
+		chunk, err := parser.NewParser("<test>", []byte(source)).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := NewCompiler(ctx, nil).Compile(chunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, fn := range result.compiledFunctions {
+			if len(fn.Constants) != len(result.entryFunction.Constants) {
+				t.Errorf("%s doesn't share the pool of its chunk", fn.Name)
+			}
+		}
+		pools = append(pools, result.entryFunction.Constants)
+	}
+	// the pool of the second chunk only holds f, 1.5 and 2
+	if len(pools[0]) != 1 || len(pools[1]) != 3 {
+		t.Errorf("unexpected pools %v", pools)
+	}
+}
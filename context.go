@@ -3,6 +3,8 @@ package quark
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
 type InterpreterMode uint8
@@ -13,12 +15,15 @@ const (
 )
 
 type Context struct {
-	Mode           InterpreterMode
-	AllowImport    bool
-	ImportBasePath string
+	Mode              InterpreterMode
+	AllowImport       bool
+	ImportBasePath    string
+	OptimizationLevel OptimizationLevel // of the compilers created for the context
+	CacheDir          string            // of compiled files, DefaultCacheDir next to each file if empty
+	DisableCache      bool              // always compile files, don't read or write the cache
+	Tracer            *Tracer           // logs the executed instructions if set
 
 	// used for vm
-	constants         []Object
 	globals           []Object
 	builtinModules    map[string]Object
 	compiledModules   map[string]Object
@@ -31,12 +36,12 @@ type Context struct {
 	currentFrame      *CallFrame
 	ip                int
 	abortFlag         int32
+	currentBuiltin    *BuiltinFunctionObject // set while a builtin runs
+	debugger          *Debugger
 
 	// used for compiler
 	globalSymbolTable *SymbolTable
-	intConstantMap    map[int64]int
-	floatConstantMap  map[float64]int
-	stringConstantMap map[string]int
+	noFusion          bool // skip superinstructions, the benchmarks compare both
 
 	err error
 }
@@ -46,16 +51,13 @@ func NewContext(mode InterpreterMode, stdlibModules map[string]map[string]Object
 	ctx.Mode = mode
 	ctx.AllowImport = true
 	ctx.ImportBasePath, _ = os.Getwd()
+	ctx.OptimizationLevel = DefaultOptimizationLevel
 
-	ctx.constants = make([]Object, 0)
 	ctx.globals = make([]Object, 0)
 	ctx.builtinModules = make(map[string]Object)
 	ctx.compiledModules = make(map[string]Object)
 
 	ctx.globalSymbolTable = NewSymbolTable(nil, TypeFunction)
-	ctx.intConstantMap = make(map[int64]int)
-	ctx.floatConstantMap = make(map[float64]int)
-	ctx.stringConstantMap = make(map[string]int)
 
 	topFn := &CompiledFunctionObject{
 		Name:           "<top-function>",
@@ -96,38 +98,6 @@ func NewContext(mode InterpreterMode, stdlibModules map[string]map[string]Object
 	return ctx
 }
 
-func (c *Context) appendConstant(value Object) int {
-	c.constants = append(c.constants, value)
-	return len(c.constants) - 1
-}
-
-func (c *Context) addIntConstant(value int64) int {
-	if index, ok := c.intConstantMap[value]; ok {
-		return index
-	}
-	index := c.appendConstant(NewInt(value))
-	c.intConstantMap[value] = index
-	return index
-}
-
-func (c *Context) addFloatConstant(value float64) int {
-	if index, ok := c.floatConstantMap[value]; ok {
-		return index
-	}
-	index := c.appendConstant(NewFloat(value))
-	c.floatConstantMap[value] = index
-	return index
-}
-
-func (c *Context) addStringConstant(value string) int {
-	if index, ok := c.stringConstantMap[value]; ok {
-		return index
-	}
-	index := c.appendConstant(NewString(value))
-	c.stringConstantMap[value] = index
-	return index
-}
-
 func (c *Context) addGlobalSymbol(name string) *Symbol {
 	symbol := c.globalSymbolTable.AddGlobalSymbol(name)
 	if len(c.globals) <= symbol.Index {
@@ -152,8 +122,47 @@ func (c *Context) getGlobal(name string) Object {
 	}
 }
 
+// load is called with the code of a chunk before it runs.
+func (c *Context) load(compiled *compiled) {
+	if c.debugger != nil {
+		c.debugger.load(compiled)
+	}
+}
+
+// modulePath returns the file a module imported as path is loaded from.
+func (c *Context) modulePath(path string) (string, error) {
+	return filepath.Abs(filepath.Join(c.ImportBasePath, path))
+}
+
+// UnloadModule forgets the module imported as path, it is compiled again
+// by the next import. Its code and constants are released once none of
+// its objects are referenced anymore. It reports whether it was loaded.
+func (c *Context) UnloadModule(path string) bool {
+	filename, err := c.modulePath(path)
+	if err != nil {
+		return false
+	}
+	if _, ok := c.compiledModules[filename]; !ok {
+		return false
+	}
+	delete(c.compiledModules, filename)
+	return true
+}
+
+// sourceLine returns the given line (starting at 1) of the source fn was
+// compiled from, or "" if it isn't known. The file named by the function
+// is never read, bytecode can name any file.
+func (fn *CompiledFunctionObject) sourceLine(line int) string {
+	if line < 1 || line > len(fn.source) {
+		return ""
+	}
+	return strings.TrimRight(fn.source[line-1], "\r")
+}
+
+// GetStackTraceback formats the calls active right now, builtins can use it
+// to report where they were called from.
 func (c *Context) GetStackTraceback() string {
-	return ""
+	return c.traceback().String()
 }
 
 func (c *Context) ThrowErrorf(format string, args ...interface{}) {
@@ -0,0 +1,541 @@
+// Package dap implements a debug adapter for quark, editors start it with
+// quark dap and debug programs through it with the Debug Adapter Protocol.
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/janqx/quark-lang/v1"
+	"github.com/janqx/quark-lang/v1/internal/framing"
+	"github.com/janqx/quark-lang/v1/stdlib"
+)
+
+// threadID is that of the only thread, programs run on a single VM.
+const threadID = 1
+
+// scope is the variables reference of a scope of a paused frame.
+type scope struct {
+	frame *quark.DebugFrame
+	name  string
+}
+
+// Server debugs one program for one client, the program is started once
+// it is launched and the client is done with its configuration.
+type Server struct {
+	in       *bufio.Reader
+	out      io.Writer
+	outMutex sync.Mutex
+	seq      int
+
+	debugger   *quark.Debugger
+	launch     *LaunchArguments
+	configured bool
+	started    bool
+	done       chan struct{} // closed once the program ended
+	resume     chan quark.DebugAction
+
+	mutex       sync.Mutex // guards the state below, shared with the program
+	paused      bool
+	entry       bool // the next pause is the one requested by stopOnEntry
+	terminating bool
+	frames      []*quark.DebugFrame
+	references  []interface{}            // scopes and containers by variables reference - 1
+	breakpoints map[string][]*Breakpoint // by path, as set by the client
+	lastID      int                      // of the breakpoints
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	s := &Server{
+		in:          bufio.NewReader(in),
+		out:         out,
+		done:        make(chan struct{}),
+		resume:      make(chan quark.DebugAction),
+		breakpoints: map[string][]*Breakpoint{},
+	}
+	s.debugger = quark.NewDebugger(s.hook)
+	s.debugger.OnLoad(s.loaded)
+	return s
+}
+
+// Run serves the client until it disconnects, the program is aborted if
+// it still runs.
+func (s *Server) Run() error {
+	for {
+		data, err := framing.ReadMessage(s.in)
+		if err == io.EOF {
+			s.terminate()
+			return nil
+		}
+		if err != nil {
+			s.terminate()
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(data, &req); err != nil {
+			s.terminate()
+			return err
+		}
+		body, err := s.handle(&req)
+		resp := &response{Type: "response", RequestSeq: req.Seq, Success: err == nil, Command: req.Command, Body: body}
+		if err != nil {
+			resp.Message = err.Error()
+		}
+		if err := s.send(resp); err != nil {
+			return err
+		}
+		switch req.Command {
+		case "initialize":
+			s.event("initialized", nil)
+		case "launch", "configurationDone":
+			s.start()
+		case "disconnect":
+			return nil
+		}
+	}
+}
+
+func (s *Server) send(message interface{}) error {
+	s.outMutex.Lock()
+	defer s.outMutex.Unlock()
+	s.seq++
+	switch message := message.(type) {
+	case *response:
+		message.Seq = s.seq
+	case *event:
+		message.Seq = s.seq
+	}
+	return framing.WriteMessage(s.out, message)
+}
+
+func (s *Server) event(name string, body interface{}) {
+	s.send(&event{Type: "event", Event: name, Body: body})
+}
+
+// Forward sends what is read from r to the client as output of the given
+// category, e.g. "stdout" for the standard output of the program.
+func (s *Server) Forward(r io.Reader, category string) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			s.event("output", &OutputEventBody{Category: category, Output: string(buf[:n])})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func decode(data json.RawMessage, arguments interface{}) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, arguments)
+}
+
+var errNotPaused = errors.New("the program isn't paused")
+
+func (s *Server) handle(req *request) (interface{}, error) {
+	switch req.Command {
+	case "initialize":
+		return map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers":        true,
+			"supportsTerminateRequest":         true,
+		}, nil
+	case "launch":
+		var arguments LaunchArguments
+		if err := decode(req.Arguments, &arguments); err != nil {
+			return nil, err
+		}
+		if s.launch != nil {
+			return nil, errors.New("the program was launched already")
+		}
+		if filepath.Ext(arguments.Program) != quark.SourceFileExt && filepath.Ext(arguments.Program) != quark.BytecodeFileExt {
+			return nil, fmt.Errorf("'%s' isn't a quark program", arguments.Program)
+		}
+		if _, err := os.Stat(arguments.Program); err != nil {
+			return nil, err
+		}
+		s.launch = &arguments
+		return nil, nil
+	case "configurationDone":
+		s.configured = true
+		return nil, nil
+	case "setBreakpoints":
+		var arguments SetBreakpointsArguments
+		if err := decode(req.Arguments, &arguments); err != nil {
+			return nil, err
+		}
+		return s.setBreakpoints(&arguments), nil
+	case "threads":
+		return map[string]interface{}{"threads": []Thread{{ID: threadID, Name: "main"}}}, nil
+	case "stackTrace":
+		var arguments StackTraceArguments
+		if err := decode(req.Arguments, &arguments); err != nil {
+			return nil, err
+		}
+		return s.stackTrace(&arguments)
+	case "scopes":
+		var arguments ScopesArguments
+		if err := decode(req.Arguments, &arguments); err != nil {
+			return nil, err
+		}
+		return s.scopes(&arguments)
+	case "variables":
+		var arguments VariablesArguments
+		if err := decode(req.Arguments, &arguments); err != nil {
+			return nil, err
+		}
+		return s.variables(&arguments)
+	case "evaluate":
+		var arguments EvaluateArguments
+		if err := decode(req.Arguments, &arguments); err != nil {
+			return nil, err
+		}
+		return s.evaluate(&arguments)
+	case "continue":
+		return map[string]interface{}{"allThreadsContinued": true}, s.resumeWith(quark.DebugContinue)
+	case "next":
+		return nil, s.resumeWith(quark.DebugStepOver)
+	case "stepIn":
+		return nil, s.resumeWith(quark.DebugStepInto)
+	case "stepOut":
+		return nil, s.resumeWith(quark.DebugStepOut)
+	case "pause":
+		s.debugger.Pause()
+		return nil, nil
+	case "terminate", "disconnect":
+		s.terminate()
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unsupported request '%s'", req.Command)
+}
+
+// start runs the program once it was launched and configured.
+func (s *Server) start() {
+	if s.launch == nil || !s.configured || s.started {
+		return
+	}
+	s.started = true
+	ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+	if !s.launch.NoDebug {
+		ctx.SetDebugger(s.debugger)
+	}
+	if s.launch.StopOnEntry {
+		s.entry = true
+		s.debugger.Pause()
+	}
+	go func() {
+		defer close(s.done)
+		script := quark.NewScript(ctx)
+		err := script.RunFile(s.launch.Program)
+		for _, warning := range script.Warnings() {
+			s.event("output", &OutputEventBody{Category: "stderr", Output: warning.String() + "\n"})
+		}
+		exitCode := 0
+		if err != nil && !errors.Is(err, quark.ErrAborted) {
+			var message string
+			var traceback *quark.Traceback
+			if errors.As(err, &traceback) {
+				message = traceback.String() + "\n"
+			}
+			s.event("output", &OutputEventBody{Category: "stderr", Output: message + err.Error() + "\n"})
+			exitCode = 1
+		}
+		s.event("exited", map[string]interface{}{"exitCode": exitCode})
+		s.event("terminated", nil)
+	}()
+}
+
+// setBreakpoints replaces the breakpoints of a file. They are only
+// verified once its code is loaded and if there is code on their line.
+func (s *Server) setBreakpoints(arguments *SetBreakpointsArguments) interface{} {
+	path := arguments.Source.Path
+	s.debugger.ClearBreakpoints(path)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	breakpoints := []Breakpoint{}
+	s.breakpoints[path] = nil
+	for _, b := range arguments.Breakpoints {
+		s.debugger.SetBreakpoint(path, b.Line)
+		s.lastID++
+		breakpoint := &Breakpoint{ID: s.lastID, Line: b.Line, Source: arguments.Source}
+		s.verify(breakpoint)
+		s.breakpoints[path] = append(s.breakpoints[path], breakpoint)
+		breakpoints = append(breakpoints, *breakpoint)
+	}
+	return map[string]interface{}{"breakpoints": breakpoints}
+}
+
+// verify tells whether the breakpoint can be hit with the code loaded so
+// far, the message says why not.
+func (s *Server) verify(b *Breakpoint) {
+	has, loaded := s.debugger.HasCode(b.Source.Path, b.Line)
+	b.Verified = has
+	switch {
+	case !loaded:
+		b.Message = "the file isn't loaded yet"
+	case !has:
+		b.Message = "there is no code on this line"
+	default:
+		b.Message = ""
+	}
+}
+
+// loaded tells the client about the breakpoints verified by the code of
+// a file that was just loaded.
+func (s *Server) loaded(filename string) {
+	s.mutex.Lock()
+	var changed []Breakpoint
+	for _, breakpoints := range s.breakpoints {
+		for _, b := range breakpoints {
+			previous := *b
+			if s.verify(b); b.Verified != previous.Verified || b.Message != previous.Message {
+				changed = append(changed, *b)
+			}
+		}
+	}
+	s.mutex.Unlock()
+	for _, b := range changed {
+		s.event("breakpoint", &BreakpointEventBody{Reason: "changed", Breakpoint: b})
+	}
+}
+
+// terminate aborts the program and waits until it ended.
+func (s *Server) terminate() {
+	if !s.started {
+		return
+	}
+	s.mutex.Lock()
+	s.terminating = true
+	s.mutex.Unlock()
+	if s.resumeWith(quark.DebugAbort) != nil {
+		s.debugger.Pause()
+	}
+	<-s.done
+}
+
+// hook reports the pause to the client and waits until it resumes the
+// execution.
+func (s *Server) hook(d *quark.Debugger, reason quark.PauseReason) quark.DebugAction {
+	s.mutex.Lock()
+	if s.terminating {
+		s.mutex.Unlock()
+		return quark.DebugAbort
+	}
+	body := &StoppedEventBody{ThreadID: threadID, AllThreadsStopped: true}
+	switch reason {
+	case quark.PauseStep:
+		body.Reason = "step"
+	case quark.PauseBreakpoint:
+		body.Reason = "breakpoint"
+	case quark.PauseDebugger:
+		body.Reason, body.Description = "breakpoint", "Paused on debugger statement"
+	case quark.PauseRequested:
+		body.Reason = "pause"
+		if s.entry {
+			body.Reason = "entry"
+		}
+	}
+	s.entry = false
+	s.paused = true
+	s.frames = d.Frames()
+	s.references = nil
+	s.mutex.Unlock()
+
+	s.event("stopped", body)
+	return <-s.resume
+}
+
+// resumeWith hands the action to the paused hook, the state of the pause is
+// dropped first so that no other request sees it meanwhile.
+func (s *Server) resumeWith(action quark.DebugAction) error {
+	s.mutex.Lock()
+	if !s.paused {
+		s.mutex.Unlock()
+		return errNotPaused
+	}
+	s.paused = false
+	s.frames = nil
+	s.references = nil
+	s.mutex.Unlock()
+	s.resume <- action
+	return nil
+}
+
+// frame returns the frame with the given id, they are numbered from 1
+// starting with the innermost.
+func (s *Server) frame(id int) (*quark.DebugFrame, error) {
+	if !s.paused {
+		return nil, errNotPaused
+	}
+	if id < 1 || id > len(s.frames) {
+		return nil, fmt.Errorf("no frame %d", id)
+	}
+	return s.frames[id-1], nil
+}
+
+func (s *Server) stackTrace(arguments *StackTraceArguments) (interface{}, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.paused {
+		return nil, errNotPaused
+	}
+	frames := []StackFrame{}
+	for i := arguments.StartFrame; i < len(s.frames); i++ {
+		if arguments.Levels > 0 && len(frames) == arguments.Levels {
+			break
+		}
+		frame := s.frames[i]
+		stackFrame := StackFrame{ID: i + 1, Name: frame.Function, Line: frame.Line, Column: frame.Column}
+		if frame.Filename != "" {
+			stackFrame.Source = &Source{Name: filepath.Base(frame.Filename), Path: frame.Filename}
+		}
+		frames = append(frames, stackFrame)
+	}
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": len(s.frames)}, nil
+}
+
+func (s *Server) scopes(arguments *ScopesArguments) (interface{}, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	frame, err := s.frame(arguments.FrameID)
+	if err != nil {
+		return nil, err
+	}
+	scopes := []Scope{}
+	for _, name := range []string{"Locals", "Outers", "Globals"} {
+		scopes = append(scopes, Scope{Name: name, VariablesReference: s.reference(&scope{frame: frame, name: name})})
+	}
+	return map[string]interface{}{"scopes": scopes}, nil
+}
+
+// reference returns a new variables reference to a scope or a container,
+// the references are valid until the execution goes on.
+func (s *Server) reference(value interface{}) int {
+	s.references = append(s.references, value)
+	return len(s.references)
+}
+
+func (s *Server) variables(arguments *VariablesArguments) (interface{}, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.paused {
+		return nil, errNotPaused
+	}
+	if arguments.VariablesReference < 1 || arguments.VariablesReference > len(s.references) {
+		return nil, fmt.Errorf("invalid variables reference %d", arguments.VariablesReference)
+	}
+	variables := []Variable{}
+	switch value := s.references[arguments.VariablesReference-1].(type) {
+	case *scope:
+		var vars []*quark.Variable
+		switch value.name {
+		case "Locals":
+			vars = value.frame.Locals()
+		case "Outers":
+			vars = value.frame.Outers()
+		case "Globals":
+			vars = s.debugger.Globals()
+		}
+		for _, v := range vars {
+			variables = append(variables, s.variable(v.Name(), v.Value()))
+		}
+	case *quark.ListObject:
+		for i, element := range value.Value {
+			variables = append(variables, s.variable(strconv.Itoa(i), element))
+		}
+	case *quark.DictObject:
+		for _, key := range sortedKeys(value) {
+			variables = append(variables, s.variable(key, value.Value[key]))
+		}
+	}
+	return map[string]interface{}{"variables": variables}, nil
+}
+
+func (s *Server) variable(name string, value quark.Object) Variable {
+	v := Variable{Name: name, Value: repr(value, 0), Type: value.TypeName()}
+	switch container := value.(type) {
+	case *quark.ListObject:
+		if len(container.Value) > 0 {
+			v.VariablesReference = s.reference(value)
+		}
+	case *quark.DictObject:
+		if len(container.Value) > 0 {
+			v.VariablesReference = s.reference(value)
+		}
+	}
+	return v
+}
+
+func (s *Server) evaluate(arguments *EvaluateArguments) (interface{}, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	id := arguments.FrameID
+	if id == 0 {
+		id = 1
+	}
+	frame, err := s.frame(id)
+	if err != nil {
+		return nil, err
+	}
+	value, err := frame.Evaluate(arguments.Expression)
+	if err != nil {
+		return nil, err
+	}
+	v := s.variable("", value)
+	return map[string]interface{}{"result": v.Value, "type": v.Type, "variablesReference": v.VariablesReference}, nil
+}
+
+func sortedKeys(dict *quark.DictObject) []string {
+	keys := make([]string, 0, len(dict.Value))
+	for key := range dict.Value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// maxReprDepth is how deep containers are formatted, a list may contain
+// itself.
+const maxReprDepth = 3
+
+// repr formats a value as it is written in the source, the entries of
+// dicts are sorted so that the value doesn't change from one pause to the
+// next.
+func repr(value quark.Object, depth int) string {
+	switch value := value.(type) {
+	case *quark.StringObject:
+		return strconv.Quote(value.Value)
+	case *quark.ListObject:
+		if depth == maxReprDepth {
+			return "[...]"
+		}
+		elements := make([]string, len(value.Value))
+		for i, element := range value.Value {
+			elements[i] = repr(element, depth+1)
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *quark.DictObject:
+		if depth == maxReprDepth {
+			return "{...}"
+		}
+		entries := make([]string, 0, len(value.Value))
+		for _, key := range sortedKeys(value) {
+			entries = append(entries, key+": "+repr(value.Value[key], depth+1))
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	}
+	return value.ToString()
+}
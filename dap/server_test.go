@@ -0,0 +1,313 @@
+package dap_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/janqx/quark-lang/v1/dap"
+)
+
+const program = `fn area(radius) {
+  result = radius * radius * 3
+  return result
+}
+total = 0
+shapes = {circle: [1, 2], square: "none"}
+for i in shapes["circle"] {
+  total = total + area(i)
+}
+debugger
+`
+
+// client drives a server the way an editor does, the events received
+// while waiting for a response are queued.
+type client struct {
+	t      *testing.T
+	in     *io.PipeWriter
+	out    *bufio.Reader
+	seq    int
+	events []map[string]interface{}
+	done   chan error
+}
+
+func newClient(t *testing.T) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	c := &client{t: t, in: clientOut, out: bufio.NewReader(clientIn), done: make(chan error, 1)}
+	go func() {
+		err := dap.NewServer(serverIn, serverOut).Run()
+		serverOut.Close()
+		c.done <- err
+	}()
+	return c
+}
+
+func (c *client) receive() map[string]interface{} {
+	header, err := textproto.NewReader(c.out).ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	length, _ := strconv.Atoi(header.Get("Content-Length"))
+	data := make([]byte, length)
+	if _, err := io.ReadFull(c.out, data); err != nil {
+		c.t.Fatal(err)
+	}
+	var message map[string]interface{}
+	if err := json.Unmarshal(data, &message); err != nil {
+		c.t.Fatal(err)
+	}
+	return message
+}
+
+// request returns the response to the request, success or not.
+func (c *client) request(command string, arguments interface{}) map[string]interface{} {
+	c.seq++
+	data, _ := json.Marshal(map[string]interface{}{"seq": c.seq, "type": "request", "command": command, "arguments": arguments})
+	if _, err := fmt.Fprintf(c.in, "Content-Length: %d\r\n\r\n%s", len(data), data); err != nil {
+		c.t.Fatal(err)
+	}
+	for {
+		message := c.receive()
+		if message["type"] == "event" {
+			c.events = append(c.events, message)
+			continue
+		}
+		if message["request_seq"] != float64(c.seq) || message["command"] != command {
+			c.t.Fatalf("%s: unexpected message %v", command, message)
+		}
+		return message
+	}
+}
+
+// body returns the body of a successful response.
+func (c *client) body(command string, arguments interface{}, v interface{}) {
+	message := c.request(command, arguments)
+	if message["success"] != true {
+		c.t.Fatalf("%s: %v", command, message["message"])
+	}
+	data, _ := json.Marshal(message["body"])
+	if err := json.Unmarshal(data, v); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// event returns the body of the next event with the given name, the
+// events before it are dropped.
+func (c *client) event(name string) map[string]interface{} {
+	for {
+		var message map[string]interface{}
+		if len(c.events) > 0 {
+			message, c.events = c.events[0], c.events[1:]
+		} else {
+			message = c.receive()
+		}
+		if message["type"] == "event" && message["event"] == name {
+			body, _ := message["body"].(map[string]interface{})
+			return body
+		}
+	}
+}
+
+func (c *client) stackTrace() []dap.StackFrame {
+	var body struct {
+		StackFrames []dap.StackFrame `json:"stackFrames"`
+	}
+	c.body("stackTrace", dap.StackTraceArguments{ThreadID: 1}, &body)
+	return body.StackFrames
+}
+
+func (c *client) variables(reference int) map[string]dap.Variable {
+	var body struct {
+		Variables []dap.Variable `json:"variables"`
+	}
+	c.body("variables", dap.VariablesArguments{VariablesReference: reference}, &body)
+	result := map[string]dap.Variable{}
+	for _, v := range body.Variables {
+		result[v.Name] = v
+	}
+	return result
+}
+
+func (c *client) stopped(reason string, function string, line int) {
+	c.t.Helper()
+	if body := c.event("stopped"); body["reason"] != reason {
+		c.t.Fatalf("stopped for %v, want %s", body["reason"], reason)
+	}
+	frame := c.stackTrace()[0]
+	if frame.Name != function || frame.Line != line {
+		c.t.Fatalf("stopped at %s:%d, want %s:%d", frame.Name, frame.Line, function, line)
+	}
+}
+
+func TestServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "main.qk")
+	if err := ioutil.WriteFile(path, []byte(program), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newClient(t)
+	var capabilities map[string]interface{}
+	c.body("initialize", map[string]interface{}{"adapterID": "quark"}, &capabilities)
+	if capabilities["supportsConfigurationDoneRequest"] != true {
+		t.Errorf("unexpected capabilities %v", capabilities)
+	}
+	c.event("initialized")
+
+	if message := c.request("launch", dap.LaunchArguments{Program: filepath.Join(dir, "missing.qk")}); message["success"] != false {
+		t.Errorf("launched a missing program")
+	}
+	c.body("launch", dap.LaunchArguments{Program: path}, &capabilities)
+	var breakpoints struct {
+		Breakpoints []dap.Breakpoint `json:"breakpoints"`
+	}
+	c.body("setBreakpoints", dap.SetBreakpointsArguments{
+		Source:      dap.Source{Path: path},
+		Breakpoints: []dap.SourceBreakpoint{{Line: 2}, {Line: 4}},
+	}, &breakpoints)
+	if len(breakpoints.Breakpoints) != 2 || breakpoints.Breakpoints[0].Verified || breakpoints.Breakpoints[1].Verified {
+		t.Errorf("breakpoints verified before the program is loaded %v", breakpoints.Breakpoints)
+	}
+	c.request("configurationDone", nil)
+
+	// the breakpoints are verified once the code is loaded
+	changed := map[float64]interface{}{}
+	for i := 0; i < 2; i++ {
+		body := c.event("breakpoint")
+		breakpoint, _ := body["breakpoint"].(map[string]interface{})
+		changed[breakpoint["line"].(float64)] = breakpoint["verified"]
+	}
+	if changed[2] != true || changed[4] != false {
+		t.Errorf("unexpected breakpoint events %v", changed)
+	}
+
+	c.stopped("breakpoint", "area", 2)
+	frames := c.stackTrace()
+	if len(frames) != 2 || frames[0].Source == nil || frames[0].Source.Path != path || frames[1].Line != 8 {
+		t.Fatalf("unexpected stack trace %+v", frames)
+	}
+
+	var scopes struct {
+		Scopes []dap.Scope `json:"scopes"`
+	}
+	c.body("scopes", dap.ScopesArguments{FrameID: 2}, &scopes)
+	if len(scopes.Scopes) != 3 || scopes.Scopes[0].Name != "Locals" {
+		t.Fatalf("unexpected scopes %v", scopes.Scopes)
+	}
+	locals := c.variables(scopes.Scopes[0].VariablesReference)
+	if locals["total"].Value != "0" || locals["i"].Value != "1" {
+		t.Errorf("unexpected locals %v", locals)
+	}
+	shapes := locals["shapes"]
+	if shapes.Value != `{circle: [1, 2], square: "none"}` || shapes.Type != "Dict" || shapes.VariablesReference == 0 {
+		t.Fatalf("unexpected shapes %+v", shapes)
+	}
+	entries := c.variables(shapes.VariablesReference)
+	if entries["square"].VariablesReference != 0 || entries["circle"].VariablesReference == 0 {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+	elements := c.variables(entries["circle"].VariablesReference)
+	if want := (map[string]dap.Variable{
+		"0": {Name: "0", Value: "1", Type: "Int"},
+		"1": {Name: "1", Value: "2", Type: "Int"},
+	}); !reflect.DeepEqual(elements, want) {
+		t.Errorf("got elements %v, want %v", elements, want)
+	}
+
+	var result struct {
+		Result string `json:"result"`
+	}
+	c.body("evaluate", dap.EvaluateArguments{Expression: "radius * 10"}, &result)
+	if result.Result != "10" {
+		t.Errorf("evaluated %s, want 10", result.Result)
+	}
+	if message := c.request("evaluate", dap.EvaluateArguments{Expression: "radius +"}); message["success"] != false {
+		t.Errorf("evaluated an invalid expression")
+	}
+
+	c.request("next", nil)
+	c.stopped("step", "area", 3)
+	c.request("stepOut", nil)
+	c.stopped("step", "<compiled-function entry>", 8)
+	c.request("continue", nil)
+	c.stopped("breakpoint", "area", 2)
+
+	c.body("setBreakpoints", dap.SetBreakpointsArguments{Source: dap.Source{Path: path}}, &breakpoints)
+	c.request("continue", nil)
+	if body := c.event("stopped"); body["description"] == nil {
+		t.Errorf("stopped without a description at the debugger statement")
+	}
+	c.request("continue", nil)
+	if body := c.event("exited"); body["exitCode"] != float64(0) {
+		t.Errorf("exited with %v", body["exitCode"])
+	}
+	c.event("terminated")
+	if message := c.request("continue", nil); message["success"] != false {
+		t.Errorf("continued a program which ended")
+	}
+
+	c.request("disconnect", nil)
+	select {
+	case err := <-c.done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server didn't stop")
+	}
+}
+
+func TestServer_Disconnect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "loop.qk")
+	if err := ioutil.WriteFile(path, []byte("i = 0\nfor ; true; {\n  i = i + 1\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newClient(t)
+	c.request("initialize", nil)
+	c.event("initialized")
+	c.body("launch", dap.LaunchArguments{Program: path, StopOnEntry: true}, &map[string]interface{}{})
+	c.request("configurationDone", nil)
+	c.stopped("entry", "<compiled-function entry>", 1)
+	c.request("continue", nil)
+	c.request("pause", nil)
+	if body := c.event("stopped"); body["reason"] != "pause" {
+		t.Fatalf("stopped for %v, want pause", body["reason"])
+	}
+	// somewhere in the loop
+	if line := c.stackTrace()[0].Line; line != 2 && line != 3 {
+		t.Fatalf("stopped at line %d", line)
+	}
+	c.request("continue", nil)
+
+	// the program is aborted while it runs
+	c.request("disconnect", nil)
+	c.event("terminated")
+	select {
+	case err := <-c.done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server didn't stop")
+	}
+}
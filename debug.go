@@ -0,0 +1,451 @@
+package quark
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/janqx/quark-lang/v1/ast"
+	"github.com/janqx/quark-lang/v1/parser"
+)
+
+// PauseReason tells why the execution paused.
+type PauseReason uint8
+
+const (
+	PauseStep       PauseReason = iota // a step completed
+	PauseBreakpoint                    // a breakpoint was reached
+	PauseDebugger                      // a debugger statement ran
+	PauseRequested                     // by Debugger.Pause
+)
+
+func (r PauseReason) String() string {
+	switch r {
+	case PauseStep:
+		return "step"
+	case PauseBreakpoint:
+		return "breakpoint"
+	case PauseDebugger:
+		return "debugger statement"
+	case PauseRequested:
+		return "pause"
+	default:
+		return "unknown"
+	}
+}
+
+// DebugAction tells how the execution goes on after a pause.
+type DebugAction uint8
+
+const (
+	DebugContinue DebugAction = iota // until a breakpoint or a debugger statement
+	DebugStepInto                    // pause at the next line, entering calls
+	DebugStepOver                    // pause at the next line of the function or of its callers
+	DebugStepOut                     // pause once the function returned
+	DebugAbort                       // stop the execution, it fails with ErrAborted
+)
+
+// DebugHook is called whenever the execution pauses, it can inspect the
+// paused state through the debugger and returns how to go on.
+type DebugHook func(d *Debugger, reason PauseReason) DebugAction
+
+type Breakpoint struct {
+	Filename string
+	Line     int
+}
+
+// Debugger pauses the execution of a context at breakpoints and debugger
+// statements, and lets its hook step through the code. It is attached by
+// Context.SetDebugger.
+type Debugger struct {
+	hook      DebugHook
+	ctx       *Context
+	mutex     sync.Mutex       // breakpoints may be changed while the code runs
+	lines     map[int][]string // filenames of the breakpoints by line
+	requested int32            // set by Pause
+
+	code   map[string]map[int]bool // lines with instructions by filename, of the code loaded so far
+	onLoad func(filename string)
+
+	// the step in progress and where it started
+	action DebugAction
+	frame  *CallFrame
+	fp     int
+	line   int
+
+	// the line of the previous instruction, pauses happen at new lines
+	lastFrame *CallFrame
+	lastFp    int
+	lastLine  int
+
+	evaluating bool
+}
+
+func NewDebugger(hook DebugHook) *Debugger {
+	return &Debugger{
+		hook:  hook,
+		lines: map[int][]string{},
+		code:  map[string]map[int]bool{},
+	}
+}
+
+// SetDebugger attaches d to the context, nil detaches the current one.
+func (c *Context) SetDebugger(d *Debugger) {
+	c.debugger = d
+	if d != nil {
+		d.ctx = c
+	}
+}
+
+// SetBreakpoint pauses the execution before the given line (starting at 1)
+// runs. The filename matches the files with the same path or whose path
+// ends with it, "main.qk" matches "/src/main.qk".
+func (d *Debugger) SetBreakpoint(filename string, line int) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, name := range d.lines[line] {
+		if name == filename {
+			return
+		}
+	}
+	d.lines[line] = append(d.lines[line], filename)
+}
+
+// ClearBreakpoint removes a breakpoint set with the same filename and
+// line, it reports whether there was one.
+func (d *Debugger) ClearBreakpoint(filename string, line int) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for i, name := range d.lines[line] {
+		if name == filename {
+			d.lines[line] = append(d.lines[line][:i], d.lines[line][i+1:]...)
+			if len(d.lines[line]) == 0 {
+				delete(d.lines, line)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// ClearBreakpoints removes the breakpoints set with the given filename.
+func (d *Debugger) ClearBreakpoints(filename string) {
+	for _, b := range d.Breakpoints() {
+		if b.Filename == filename {
+			d.ClearBreakpoint(b.Filename, b.Line)
+		}
+	}
+}
+
+// Breakpoints returns the breakpoints sorted by filename and line.
+func (d *Debugger) Breakpoints() []Breakpoint {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	var result []Breakpoint
+	for line, filenames := range d.lines {
+		for _, filename := range filenames {
+			result = append(result, Breakpoint{Filename: filename, Line: line})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Filename != result[j].Filename {
+			return result[i].Filename < result[j].Filename
+		}
+		return result[i].Line < result[j].Line
+	})
+	return result
+}
+
+func (d *Debugger) atBreakpoint(filename string, line int) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, name := range d.lines[line] {
+		if matchFilename(name, filename) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchFilename reports whether name, given for a breakpoint, stands for
+// the file filename.
+func matchFilename(name string, filename string) bool {
+	return name == filename || strings.HasSuffix(filename, "/"+name) || strings.HasSuffix(filename, "\\"+name)
+}
+
+// OnLoad sets a function called whenever the code of a file was loaded,
+// before it runs, e.g. to check the breakpoints set before with HasCode.
+// It is called by the goroutine running the code.
+func (d *Debugger) OnLoad(f func(filename string)) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.onLoad = f
+}
+
+// HasCode reports whether the code loaded from the file filename has
+// instructions on the given line, so that a breakpoint there can be hit.
+// The filename matches like that of SetBreakpoint, loaded is false as long
+// as no code of the file was loaded.
+func (d *Debugger) HasCode(filename string, line int) (has bool, loaded bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for name, lines := range d.code {
+		if matchFilename(filename, name) {
+			loaded = true
+			if lines[line] {
+				return true, true
+			}
+		}
+	}
+	return false, loaded
+}
+
+// load records the lines of the functions compiled together, it is called
+// before they run.
+func (d *Debugger) load(c *compiled) {
+	d.mutex.Lock()
+	for _, fn := range c.compiledFunctions {
+		lines := d.code[fn.Filename]
+		if lines == nil {
+			lines = map[int]bool{}
+			d.code[fn.Filename] = lines
+		}
+		for _, entry := range fn.Lines.Entries {
+			if entry.Line > 0 {
+				lines[entry.Line] = true
+			}
+		}
+	}
+	onLoad := d.onLoad
+	d.mutex.Unlock()
+	if onLoad != nil {
+		onLoad(c.entryFunction.Filename)
+	}
+}
+
+// Pause pauses the execution at the next line, it may be called while the
+// code runs, e.g. from another goroutine, or before it starts.
+func (d *Debugger) Pause() {
+	atomic.StoreInt32(&d.requested, 1)
+}
+
+// next is called by the VM before each instruction, the execution pauses
+// when it reaches a new line where a step completes or a breakpoint is set.
+// It reports whether the execution is aborted.
+func (d *Debugger) next() bool {
+	if d.evaluating {
+		return false
+	}
+	ctx := d.ctx
+	frame := ctx.currentFrame
+	line, _ := frame.fn.Lines.Lookup(ctx.ip)
+	if line == 0 || frame == d.lastFrame && line == d.lastLine {
+		return false
+	}
+	// a call returning to the middle of a line doesn't hit its breakpoint
+	returned := ctx.fp < d.lastFp
+	d.lastFrame, d.lastFp, d.lastLine = frame, ctx.fp, line
+	moved := frame != d.frame || line != d.line
+	switch {
+	case !returned && d.atBreakpoint(frame.fn.Filename, line):
+		return d.pause(PauseBreakpoint)
+	case atomic.CompareAndSwapInt32(&d.requested, 1, 0):
+		return d.pause(PauseRequested)
+	case d.action == DebugStepInto && moved,
+		d.action == DebugStepOver && moved && ctx.fp <= d.fp,
+		d.action == DebugStepOut && ctx.fp < d.fp:
+		return d.pause(PauseStep)
+	}
+	return false
+}
+
+// pause calls the hook, it reports whether the execution is aborted.
+func (d *Debugger) pause(reason PauseReason) bool {
+	if d.evaluating || d.hook == nil {
+		return false
+	}
+	ctx := d.ctx
+	d.frame, d.fp = ctx.currentFrame, ctx.fp
+	d.line, _ = d.frame.fn.Lines.Lookup(ctx.ip)
+	// the rest of the line runs before the next pause
+	d.lastFrame, d.lastFp, d.lastLine = d.frame, d.fp, d.line
+	d.action = d.hook(d, reason)
+	return d.action == DebugAbort
+}
+
+// DebugFrame is an active call of the paused execution, it is only valid
+// until the execution goes on.
+type DebugFrame struct {
+	Function   string
+	Filename   string
+	Line       int // 0 if unknown
+	Column     int
+	SourceLine string
+
+	debugger *Debugger
+	frame    *CallFrame
+}
+
+// Frames returns the active calls of the paused execution, the innermost
+// comes first.
+func (d *Debugger) Frames() []*DebugFrame {
+	ctx := d.ctx
+	var frames []*DebugFrame
+	for i := ctx.fp; i >= 1; i-- {
+		fn := ctx.frames[i].fn
+		pc := ctx.ip
+		if i < ctx.fp {
+			pc = ctx.frames[i+1].ip
+		}
+		frame := &DebugFrame{
+			Function: fn.Name,
+			Filename: fn.Filename,
+			debugger: d,
+			frame:    ctx.frames[i],
+		}
+		frame.Line, frame.Column = fn.Lines.Lookup(pc)
+		if frame.Line > 0 {
+			frame.SourceLine = fn.sourceLine(frame.Line)
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+func unref(value Object) Object {
+	if ref, ok := value.(*ObjectRef); ok {
+		return ref.Value
+	}
+	return value
+}
+
+// Locals returns the locals of the frame which were assigned, in the order
+// they were declared. Those of blocks keep their last value once the
+// block is left.
+func (f *DebugFrame) Locals() []*Variable {
+	stack := f.debugger.ctx.stack[f.frame.bp:]
+	table := f.frame.fn.SymbolTable
+	var result []*Variable
+	for i, name := range table.LocalNames {
+		if name != "" && i < table.LocalCount && stack[i] != nil {
+			result = append(result, &Variable{name: name, value: unref(stack[i])})
+		}
+	}
+	return result
+}
+
+// Outers returns the variables of the enclosing functions visible in the
+// frame, sorted by name.
+func (f *DebugFrame) Outers() []*Variable {
+	var result []*Variable
+	for name, symbol := range f.frame.fn.SymbolTable.Symbols {
+		if symbol.Scope == ScopeOuter && symbol.Index < len(f.frame.outers) && f.frame.outers[symbol.Index] != nil {
+			result = append(result, &Variable{name: name, value: unref(f.frame.outers[symbol.Index])})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].name < result[j].name
+	})
+	return result
+}
+
+// Globals returns the globals of the context sorted by name, the builtins
+// are left out unless they were replaced.
+func (d *Debugger) Globals() []*Variable {
+	ctx := d.ctx
+	var result []*Variable
+	for name, symbol := range ctx.globalSymbolTable.Symbols {
+		if symbol.Scope != ScopeGlobal || symbol.Index >= len(ctx.globals) || name == "__REPL_RESULT_VALUE__" {
+			continue
+		}
+		value := unref(ctx.globals[symbol.Index])
+		if value == nil || value == builtinObjects[name] {
+			continue
+		}
+		result = append(result, &Variable{name: name, value: value})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].name < result[j].name
+	})
+	return result
+}
+
+// Evaluate runs source in the scope of the frame and returns the value of
+// its expression, or null if it is made of statements. Assignments change
+// the variables of the frame. Nothing pauses the execution meanwhile.
+func (f *DebugFrame) Evaluate(source string) (Object, error) {
+	d := f.debugger
+	chunk, err := parser.NewParser("<debugger>", []byte(source)).Parse()
+	if err != nil {
+		return nil, err
+	}
+	var statements []ast.Statement
+	for _, s := range chunk.Statements.List {
+		if s != ast.SingletonEmptyStatement {
+			statements = append(statements, s)
+		}
+	}
+	if len(statements) == 1 {
+		var value ast.Expression
+		switch s := statements[0].(type) {
+		case *ast.ExpressionStatement:
+			value = s.Expression
+		case *ast.CallFunctionStatement:
+			value = &ast.CallFunctionExpression{Callable: s.Callable, Args: s.Args}
+		}
+		if value != nil {
+			chunk.Statements.List = []ast.Statement{&ast.ReturnStatement{
+				Expressions: &ast.ExpressionList{List: []ast.Expression{value}},
+			}}
+		}
+	}
+	compiled, err := NewCompiler(d.ctx, nil).compile(chunk, f.scope())
+	if err != nil {
+		return nil, err
+	}
+	vm := NewVM(d.ctx)
+	closure, err := vm.makeClosureIn(compiled.entryFunction, f.frame)
+	if err != nil {
+		return nil, err
+	}
+	d.evaluating = true
+	defer func() {
+		d.evaluating = false
+	}()
+	if err := vm.Prepare(closure, 0); err != nil {
+		return nil, err
+	}
+	return vm.Execute()
+}
+
+// scope returns a symbol table declaring the variables visible in the
+// frame, code compiled in it captures them like a closure defined there.
+func (f *DebugFrame) scope() *SymbolTable {
+	globals := f.debugger.ctx.globalSymbolTable
+	table := f.frame.fn.SymbolTable
+	scope := NewSymbolTable(globals, TypeFunction)
+	for name, symbol := range globals.Symbols {
+		if symbol.Scope == ScopeGlobal {
+			scope.Symbols[name] = symbol
+		}
+	}
+	for name, symbol := range table.Symbols {
+		if symbol.Scope == ScopeOuter {
+			scope.Symbols[name] = &Symbol{Name: name, Index: symbol.Index, Scope: ScopeOuter, Owner: scope}
+		}
+	}
+	// a name may be declared by several blocks, the latest assigned wins
+	stack := f.debugger.ctx.stack[f.frame.bp:]
+	for i, name := range table.LocalNames {
+		if name == "" || i >= table.LocalCount {
+			continue
+		}
+		if symbol := scope.Symbols[name]; symbol == nil || symbol.Scope != ScopeLocal || stack[i] != nil {
+			scope.Symbols[name] = &Symbol{Name: name, Index: i, Scope: ScopeLocal, Owner: scope}
+		}
+	}
+	scope.LocalCount = table.LocalCount
+	scope.OuterCount = len(f.frame.outers)
+	return scope
+}
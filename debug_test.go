@@ -0,0 +1,218 @@
+package quark_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/janqx/quark-lang/v1"
+	"github.com/janqx/quark-lang/v1/stdlib"
+)
+
+const debuggee = `fn area(radius) {
+  result = radius * radius * 3
+  return result
+}
+total = 0
+for i in [1, 2] {
+  total = total + area(i)
+}
+debugger
+print(total)
+`
+
+func variables(vars []*quark.Variable) string {
+	var s []string
+	for _, v := range vars {
+		s = append(s, v.Name()+"="+v.Value().ToString())
+	}
+	return strings.Join(s, " ")
+}
+
+// debug runs source, the hook is given the actions to take at each pause
+// and records where they happened.
+func debug(t *testing.T, source string, setup func(d *quark.Debugger), actions ...quark.DebugAction) ([]string, error) {
+	t.Helper()
+	var pauses []string
+	d := quark.NewDebugger(func(d *quark.Debugger, reason quark.PauseReason) quark.DebugAction {
+		frame := d.Frames()[0]
+		pauses = append(pauses, fmt.Sprintf("%s %s:%d", reason, frame.Function, frame.Line))
+		if len(pauses) > len(actions) {
+			t.Fatalf("unexpected pause %s", pauses[len(pauses)-1])
+		}
+		return actions[len(pauses)-1]
+	})
+	if setup != nil {
+		setup(d)
+	}
+	ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+	ctx.SetDebugger(d)
+	_, err := quark.NewScript(ctx).RunString(source)
+	return pauses, err
+}
+
+func TestDebugger_Stepping(t *testing.T) {
+	breakAt := func(line int) func(d *quark.Debugger) {
+		return func(d *quark.Debugger) {
+			d.SetBreakpoint("<repl>", line)
+		}
+	}
+	tests := []struct {
+		name    string
+		setup   func(d *quark.Debugger)
+		actions []quark.DebugAction
+		want    []string
+	}{
+		{
+			"debugger statement",
+			nil,
+			[]quark.DebugAction{quark.DebugContinue},
+			[]string{"debugger statement <compiled-function entry>:9"},
+		},
+		{
+			"breakpoint",
+			breakAt(2),
+			[]quark.DebugAction{quark.DebugContinue, quark.DebugContinue, quark.DebugContinue},
+			[]string{"breakpoint area:2", "breakpoint area:2", "debugger statement <compiled-function entry>:9"},
+		},
+		{
+			"step into",
+			breakAt(7),
+			[]quark.DebugAction{quark.DebugStepInto, quark.DebugStepInto, quark.DebugStepInto, quark.DebugStepInto, quark.DebugAbort},
+			[]string{"breakpoint <compiled-function entry>:7", "step area:2", "step area:3", "step <compiled-function entry>:7", "step <compiled-function entry>:6"},
+		},
+		{
+			"step over",
+			breakAt(5),
+			[]quark.DebugAction{quark.DebugStepOver, quark.DebugStepOver, quark.DebugStepOver, quark.DebugStepOver, quark.DebugAbort},
+			[]string{"breakpoint <compiled-function entry>:5", "step <compiled-function entry>:6", "step <compiled-function entry>:7", "step <compiled-function entry>:6", "step <compiled-function entry>:7"},
+		},
+		{
+			"step out",
+			breakAt(2),
+			[]quark.DebugAction{quark.DebugStepOut, quark.DebugAbort},
+			[]string{"breakpoint area:2", "step <compiled-function entry>:7"},
+		},
+		{
+			"pause",
+			func(d *quark.Debugger) { d.Pause() },
+			[]quark.DebugAction{quark.DebugStepOver, quark.DebugAbort},
+			[]string{"pause <compiled-function entry>:1", "step <compiled-function entry>:5"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pauses, err := debug(t, debuggee, tt.setup, tt.actions...)
+			aborted := tt.actions[len(tt.actions)-1] == quark.DebugAbort
+			if aborted != errors.Is(err, quark.ErrAborted) || !aborted && err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(pauses, tt.want) {
+				t.Errorf("got %q, want %q", pauses, tt.want)
+			}
+		})
+	}
+}
+
+func TestDebugger_Inspect(t *testing.T) {
+	var locals, outers, backtrace []string
+	var evaluated []string
+	d := quark.NewDebugger(func(d *quark.Debugger, reason quark.PauseReason) quark.DebugAction {
+		frames := d.Frames()
+		for _, frame := range frames {
+			locals = append(locals, variables(frame.Locals()))
+			outers = append(outers, variables(frame.Outers()))
+			backtrace = append(backtrace, fmt.Sprintf("%s:%d %s", frame.Function, frame.Line, frame.SourceLine))
+		}
+		for _, source := range []string{"radius * 10", "total + i", "length([1, 2])", "total = 100", "missing"} {
+			value, err := frames[0].Evaluate(source)
+			if err != nil {
+				evaluated = append(evaluated, "error")
+			} else {
+				evaluated = append(evaluated, value.ToString())
+			}
+		}
+		return quark.DebugContinue
+	})
+	d.SetBreakpoint("<repl>", 4)
+	ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+	ctx.SetDebugger(d)
+	result, err := quark.NewScript(ctx).RunString(`total = 5
+fn area(radius) {
+  result = radius * radius * 3
+  return result
+}
+for i in [7] {
+  total = area(i) + total
+}
+return total
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"radius=7 result=147", "total=5 area=<closure area> i=7"}; !reflect.DeepEqual(locals, want) {
+		t.Errorf("locals: got %q, want %q", locals, want)
+	}
+	if want := []string{"area=<closure area> total=5", ""}; !reflect.DeepEqual(outers, want) {
+		t.Errorf("outers: got %q, want %q", outers, want)
+	}
+	if want := []string{"area:4   return result", "<compiled-function entry>:7   total = area(i) + total"}; !reflect.DeepEqual(backtrace, want) {
+		t.Errorf("backtrace: got %q, want %q", backtrace, want)
+	}
+	// total is an outer of area, the assignment changes the variable of
+	// the caller
+	if want := []string{"70", "error", "2", "null", "error"}; !reflect.DeepEqual(evaluated, want) {
+		t.Errorf("evaluated: got %q, want %q", evaluated, want)
+	}
+	if result.ToString() != "247" {
+		t.Errorf("got %s, want 247", result.ToString())
+	}
+}
+
+func TestDebugger_Breakpoints(t *testing.T) {
+	d := quark.NewDebugger(nil)
+	d.SetBreakpoint("main.qk", 3)
+	d.SetBreakpoint("lib.qk", 1)
+	d.SetBreakpoint("main.qk", 3)
+	d.SetBreakpoint("main.qk", 1)
+	want := []quark.Breakpoint{{"lib.qk", 1}, {"main.qk", 1}, {"main.qk", 3}}
+	if got := d.Breakpoints(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !d.ClearBreakpoint("lib.qk", 1) || d.ClearBreakpoint("lib.qk", 1) {
+		t.Errorf("ClearBreakpoint reported the wrong result")
+	}
+	d.ClearBreakpoints("main.qk")
+	if got := d.Breakpoints(); len(got) != 0 {
+		t.Errorf("got %v, want none", got)
+	}
+}
+
+func TestDebugger_Bytecode(t *testing.T) {
+	data, err := quark.NewScript(quark.NewContext(quark.ModeNormal, stdlib.LoadModules())).Compile("test.qk", debuggee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var locals []string
+	d := quark.NewDebugger(func(d *quark.Debugger, reason quark.PauseReason) quark.DebugAction {
+		locals = append(locals, variables(d.Frames()[0].Locals()))
+		return quark.DebugContinue
+	})
+	d.SetBreakpoint("test.qk", 7)
+	ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+	ctx.SetDebugger(d)
+	if _, err := quark.NewScript(ctx).Load(data); err != nil {
+		t.Fatal(err)
+	}
+	// the names of block locals are kept in the bytecode
+	want := []string{
+		"area=<closure area> total=0 i=1",
+		"area=<closure area> total=3 i=2",
+		"area=<closure area> total=15 i=2",
+	}
+	if !reflect.DeepEqual(locals, want) {
+		t.Errorf("got %q, want %q", locals, want)
+	}
+}
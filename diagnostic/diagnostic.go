@@ -0,0 +1,112 @@
+package diagnostic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/janqx/quark-lang/v1/tokenize"
+)
+
+type Severity uint8
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "unknown"
+	}
+}
+
+// Diagnostic is a problem found in the source, Start and End delimit the
+// offending text, End is exclusive. Hints suggest how to fix it.
+type Diagnostic struct {
+	Severity Severity
+	Start    tokenize.Position
+	End      tokenize.Position
+	Message  string
+	Hints    []string
+}
+
+func (d Diagnostic) String() string {
+	s := fmt.Sprintf("%s: %s: %s", d.Start.String(), d.Severity.String(), d.Message)
+	for _, hint := range d.Hints {
+		s += "\n    hint: " + hint
+	}
+	return s
+}
+
+// Diagnostics implements error, so a parse or check that found problems
+// can return all of them at once.
+type Diagnostics []Diagnostic
+
+func (ds Diagnostics) Error() string {
+	lines := make([]string, 0, len(ds))
+	for _, d := range ds {
+		lines = append(lines, d.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (ds Diagnostics) HasErrors() bool {
+	for _, d := range ds {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+func (ds Diagnostics) Errors() Diagnostics {
+	return ds.filter(SeverityError)
+}
+
+func (ds Diagnostics) Warnings() Diagnostics {
+	return ds.filter(SeverityWarning)
+}
+
+func (ds Diagnostics) filter(severity Severity) Diagnostics {
+	var result Diagnostics
+	for _, d := range ds {
+		if d.Severity == severity {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+// Sort orders the diagnostics by position, diagnostics at the same position
+// keep their order.
+func (ds Diagnostics) Sort() {
+	sort.SliceStable(ds, func(i, j int) bool {
+		return ds[i].Start.Offset < ds[j].Start.Offset
+	})
+}
+
+func NewError(start, end tokenize.Position, message string, hints ...string) Diagnostic {
+	return Diagnostic{
+		Severity: SeverityError,
+		Start:    start,
+		End:      end,
+		Message:  message,
+		Hints:    hints,
+	}
+}
+
+func NewWarning(start, end tokenize.Position, message string, hints ...string) Diagnostic {
+	return Diagnostic{
+		Severity: SeverityWarning,
+		Start:    start,
+		End:      end,
+		Message:  message,
+		Hints:    hints,
+	}
+}
@@ -0,0 +1,132 @@
+package quark
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Disassemble renders the instructions of fn and of the functions it
+// defines. Constants and variable names are shown next to the operands
+// that refer to them, jump targets are labeled and the source line of
+// each group of instructions precedes it.
+func (c *Context) Disassemble(fn *CompiledFunctionObject) string {
+	var b strings.Builder
+	functions := []*CompiledFunctionObject{fn}
+	seen := map[*CompiledFunctionObject]bool{fn: true}
+	for i := 0; i < len(functions); i++ {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		c.disassembleFunction(&b, functions[i])
+		for _, constant := range functions[i].Constants {
+			if nested, ok := constant.(*CompiledFunctionObject); ok && !seen[nested] {
+				seen[nested] = true
+				functions = append(functions, nested)
+			}
+		}
+	}
+	return b.String()
+}
+
+func (c *Context) disassembleFunction(b *strings.Builder, fn *CompiledFunctionObject) {
+	fmt.Fprintf(b, "function %s(%s) in %s:\n", fn.Name, strings.Join(fn.ParameterNames, ", "), fn.Filename)
+
+	code := fn.Instructions
+	var targets []int
+	for pc, inst := range code {
+		if isJump(inst.Opcode()) {
+			targets = append(targets, int(operandAt(code, pc)))
+		}
+	}
+	sort.Ints(targets)
+	labels := make(map[int]string)
+	for _, target := range targets {
+		if _, ok := labels[target]; !ok {
+			labels[target] = fmt.Sprintf("L%d", len(labels))
+		}
+	}
+
+	locals := make(map[int]string)
+	outers := make(map[int]string)
+	if fn.SymbolTable != nil {
+		for name, symbol := range fn.SymbolTable.Symbols {
+			switch symbol.Scope {
+			case ScopeLocal:
+				locals[symbol.Index] = name
+			case ScopeOuter:
+				outers[symbol.Index] = name
+			}
+		}
+	}
+	globals := make(map[int]string)
+	for name, symbol := range c.globalSymbolTable.Symbols {
+		if symbol.Scope == ScopeGlobal {
+			globals[symbol.Index] = name
+		}
+	}
+
+	line := 0
+	for pc := 0; pc < len(code); pc++ {
+		if l, _ := fn.Lines.Lookup(pc); l > 0 && l != line {
+			line = l
+			fmt.Fprintf(b, "%5d | %s\n", line, strings.TrimSpace(fn.sourceLine(line)))
+		}
+		if label, ok := labels[pc]; ok {
+			fmt.Fprintf(b, "%s:\n", label)
+		}
+		inst := code[pc]
+		prefixed := inst.Opcode() == OpExtendedArg && pc+1 < len(code)
+		if prefixed {
+			fmt.Fprintf(b, "%8d  %s %d\n", pc, inst.Opcode(), inst.Operand())
+			pc++
+			inst = code[pc]
+		}
+		operand := operandAt(code, pc)
+		var text string
+		switch opcode := inst.Opcode(); {
+		case opcode == OpLoadConst && int(operand) < len(fn.Constants):
+			text = fmt.Sprintf("%d (%s)", operand, constantRepr(fn.Constants[operand]))
+		case opcode == OpLoadLocal || opcode == OpStoreLocal || opcode >= OpIncLocalConst && opcode <= OpCompareLocalsJump:
+			text = nameOperand(operand, locals)
+		case opcode == OpLoadOuter || opcode == OpStoreOuter:
+			text = nameOperand(operand, outers)
+		case opcode == OpLoadGlobal || opcode == OpStoreGlobal:
+			text = nameOperand(operand, globals)
+		case isJump(opcode):
+			text = labels[int(operand)]
+		case prefixed || operand.isValid():
+			text = strconv.Itoa(int(operand))
+		}
+		b.WriteString(strings.TrimRight(fmt.Sprintf("%8d  %-24s%s", pc, inst.Opcode(), text), " ") + "\n")
+	}
+}
+
+// operandAt returns the operand of the instruction at pc, including the
+// high bits held by an OpExtendedArg before it.
+func operandAt(code []Instruction, pc int) Operand {
+	operand := code[pc].Operand()
+	if pc > 0 && code[pc-1].Opcode() == OpExtendedArg {
+		operand |= code[pc-1].Operand() << 24
+	}
+	return operand
+}
+
+func nameOperand(operand Operand, names map[int]string) string {
+	if name, ok := names[int(operand)]; ok {
+		return fmt.Sprintf("%d (%s)", operand, name)
+	}
+	return strconv.Itoa(int(operand))
+}
+
+func constantRepr(value Object) string {
+	switch value := value.(type) {
+	case *StringObject:
+		return strconv.Quote(value.Value)
+	case *CompiledFunctionObject:
+		return "<function " + value.Name + ">"
+	default:
+		return value.ToString()
+	}
+}
@@ -3,6 +3,7 @@ package quark
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 var (
@@ -18,6 +19,10 @@ var (
 	ErrInvalidOperator        = errors.New("invalid operator")
 	ErrInvalidModuleName      = errors.New("invalid module name")
 	ErrNotFoundModule         = errors.New("not found module")
+	ErrInvalidUTF8            = errors.New("invalid UTF-8 sequence")
+	ErrInvalidByteValue       = errors.New("byte value must be an Int in range 0..255")
+	ErrDivisionByZero         = errors.New("division by zero")
+	ErrAborted                = errors.New("execution aborted")
 )
 
 type ErrorMessage struct {
@@ -28,6 +33,59 @@ type ErrorMessage struct {
 	Message  string
 }
 
+// RuntimeError is returned by the VM for every error raised while a script
+// runs, it records where the failing instruction came from. Err is the
+// original error.
+type RuntimeError struct {
+	ErrorMessage
+	SourceLine string
+	Traceback  *Traceback
+	Err        error
+}
+
+func (e *RuntimeError) Error() string {
+	if e.Line == 0 {
+		return e.Message
+	}
+	s := fmt.Sprintf("%s:%d:%d: %s", e.Filename, e.Line, e.Column, e.Message)
+	if e.SourceLine != "" {
+		s += "\n    " + e.SourceLine + "\n    " + caret(e.SourceLine, e.Column)
+	}
+	return s
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+// As lets errors.As extract the traceback directly.
+func (e *RuntimeError) As(target interface{}) bool {
+	if target, ok := target.(**Traceback); ok && e.Traceback != nil {
+		*target = e.Traceback
+		return true
+	}
+	return false
+}
+
+// caret points at column (in runes, starting at 1) of line, tabs are kept
+// so that the caret lines up with the source.
+func caret(line string, column int) string {
+	var b strings.Builder
+	for _, r := range line {
+		if column <= 1 {
+			break
+		}
+		if r == '\t' {
+			b.WriteRune('\t')
+		} else {
+			b.WriteRune(' ')
+		}
+		column--
+	}
+	b.WriteRune('^')
+	return b.String()
+}
+
 type ErrInvalidArgument struct {
 	Name     string
 	Expected string
@@ -45,3 +103,60 @@ func NewErrInvalidArgument(name string, expected string, found string) ErrInvali
 func (e ErrInvalidArgument) Error() string {
 	return fmt.Sprintf("invalid type for argument '%s': expected %s, found %s", e.Name, e.Expected, e.Found)
 }
+
+type ErrUnknownAttribute struct {
+	TypeName string
+	Name     string
+}
+
+func NewErrUnknownAttribute(typeName string, name string) ErrUnknownAttribute {
+	return ErrUnknownAttribute{
+		TypeName: typeName,
+		Name:     name,
+	}
+}
+
+func (e ErrUnknownAttribute) Error() string {
+	return fmt.Sprintf("'%s' object has no attribute '%s'", e.TypeName, e.Name)
+}
+
+// TypeError reports an operation applied to values that don't support it.
+type TypeError struct {
+	Message string
+}
+
+func NewTypeError(format string, args ...interface{}) TypeError {
+	return TypeError{
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+func (e TypeError) Error() string {
+	return e.Message
+}
+
+// typeError turns ErrNotImplemented from the ObjectImpl defaults into a
+// TypeError describing the operation, other errors are returned as is.
+func typeError(err error, format string, args ...interface{}) error {
+	if err == ErrNotImplemented {
+		return NewTypeError(format, args...)
+	}
+	return err
+}
+
+// PanicError is a Go panic recovered while the VM was running, typically
+// raised by a builtin or host object.
+type PanicError struct {
+	Value interface{}
+}
+
+func (e PanicError) Error() string {
+	return fmt.Sprintf("runtime panic: %v", e.Value)
+}
+
+func (e PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
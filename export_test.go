@@ -0,0 +1,18 @@
+package quark
+
+// SetFusion makes the compilers of ctx fuse superinstructions or not, by
+// default they do at OptimizeFull.
+func SetFusion(ctx *Context, enabled bool) {
+	ctx.noFusion = !enabled
+}
+
+// Prepare compiles source like RunString, the returned function runs it.
+func (s *Script) Prepare(source string) (func() (Object, error), error) {
+	compiled, err := s.compile("<repl>", source)
+	if err != nil {
+		return nil, err
+	}
+	return func() (Object, error) {
+		return s.run(compiled)
+	}, nil
+}
@@ -0,0 +1,425 @@
+// Package format prints Quark source in its canonical form: two spaces of
+// indentation, one statement per line, spaces around binary operators and
+// after commas, and only the parentheses the precedence requires. Comments
+// are kept where they were, blank lines between statements are kept but
+// never more than one.
+package format
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/janqx/quark-lang/v1/ast"
+	"github.com/janqx/quark-lang/v1/parser"
+	"github.com/janqx/quark-lang/v1/tokenize"
+)
+
+const indentation = "  "
+
+// Source formats the source of the file filename, syntax errors are
+// returned as diagnostic.Diagnostics.
+func Source(filename string, source []byte) ([]byte, error) {
+	p := parser.NewParser(filename, source)
+	p.SetMode(parser.ScanComments)
+	chunk, err := p.Parse()
+	if err != nil {
+		return nil, err
+	}
+	pr := &printer{
+		source:   source,
+		comments: p.Comments(),
+	}
+	pr.statements(chunk.Statements.List, len(source))
+	return pr.buf.Bytes(), nil
+}
+
+type printer struct {
+	source   []byte
+	comments []*tokenize.Token // not printed yet
+	buf      bytes.Buffer
+	indent   int
+	line     int // source line of what was printed last, 0 at the start of a block
+}
+
+func (p *printer) write(s string) {
+	p.buf.WriteString(s)
+}
+
+// startLine begins a line at the current indentation, it is preceded by a
+// blank line if there was one in the source before line.
+func (p *printer) startLine(line int) {
+	if p.line > 0 && line > p.line+1 {
+		p.buf.WriteByte('\n')
+	}
+	p.write(strings.Repeat(indentation, p.indent))
+}
+
+func (p *printer) text(node ast.Node) string {
+	return string(p.source[node.Start().Offset:node.End().Offset])
+}
+
+func comment(token *tokenize.Token) string {
+	return strings.TrimRight(token.Value.(string), " \t\r")
+}
+
+// leading prints the comments before offset on lines of their own.
+func (p *printer) leading(offset int) {
+	for len(p.comments) > 0 && p.comments[0].Position.Offset < offset {
+		c := p.comments[0]
+		p.comments = p.comments[1:]
+		p.startLine(c.Position.Line)
+		p.write(comment(c))
+		p.buf.WriteByte('\n')
+		p.line = c.End.Line
+	}
+}
+
+// trailing appends to the current line the comments before offset and
+// those on line before limit.
+func (p *printer) trailing(offset int, line int, limit int) {
+	for len(p.comments) > 0 {
+		c := p.comments[0]
+		if c.Position.Offset >= offset && (c.Position.Line != line || c.Position.Offset >= limit) {
+			break
+		}
+		p.comments = p.comments[1:]
+		p.write(" " + comment(c))
+		if c.End.Line > p.line {
+			p.line = c.End.Line
+		}
+	}
+}
+
+// statements prints list, end is the offset of the '}' closing the block
+// or the end of the source.
+func (p *printer) statements(list []ast.Statement, end int) {
+	list = nonEmpty(list)
+	for i, s := range list {
+		p.leading(s.Start().Offset)
+		p.startLine(s.Start().Line)
+		p.statement(s)
+		p.line = s.End().Line
+		limit := end
+		if i+1 < len(list) {
+			limit = list[i+1].Start().Offset
+		}
+		p.trailing(s.End().Offset, p.line, limit)
+		p.buf.WriteByte('\n')
+	}
+	p.leading(end)
+}
+
+func nonEmpty(list []ast.Statement) []ast.Statement {
+	result := make([]ast.Statement, 0, len(list))
+	for _, s := range list {
+		if _, ok := s.(*ast.EmptyStatement); !ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func (p *printer) block(node ast.Statement) {
+	block := node.(*ast.BlockStatement)
+	end := block.End().Offset - 1
+	list := nonEmpty(block.Statements.List)
+	if len(list) == 0 && (len(p.comments) == 0 || p.comments[0].Position.Offset >= end) {
+		p.write("{}")
+		return
+	}
+	p.write("{")
+	limit := end
+	if len(list) > 0 {
+		limit = list[0].Start().Offset
+	}
+	p.trailing(block.Start().Offset, block.Start().Line, limit)
+	p.buf.WriteByte('\n')
+	p.indent++
+	p.line = 0
+	p.statements(list, end)
+	p.indent--
+	p.write(strings.Repeat(indentation, p.indent) + "}")
+}
+
+func (p *printer) statement(node ast.Statement) {
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		p.expression(node.Expression, 0)
+	case *ast.AssignStatement:
+		for i, assignable := range node.Assignables {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(assignable, 0)
+			if i < len(node.Types) && node.Types[i] != nil {
+				p.write(": " + node.Types[i].String())
+			}
+		}
+		p.write(" = ")
+		p.expressions(node.Expressions.List)
+	case *ast.CallFunctionStatement:
+		p.expression(node.Callable, precedencePostfix)
+		p.write("(")
+		p.expressions(node.Args.List)
+		p.write(")")
+	case *ast.ReturnStatement:
+		p.write("return")
+		list := node.Expressions.List
+		if len(list) == 1 && list[0].Start().Offset == node.Start().Offset {
+			// the implicit null of a bare return
+			return
+		}
+		p.write(" ")
+		p.expressions(list)
+	case *ast.IfStatement:
+		p.write("if ")
+		p.expression(node.Condition, 0)
+		p.write(" ")
+		p.block(node.ThenBody)
+		for _, elif := range node.Elifs {
+			p.write(" else if ")
+			p.expression(elif.Condition, 0)
+			p.write(" ")
+			p.block(elif.Body)
+		}
+		if node.ElseBody != nil {
+			p.write(" else ")
+			p.block(node.ElseBody)
+		}
+	case *ast.ForStatement:
+		p.write("for ")
+		if node.Init != nil || node.Increment != nil {
+			if node.Init != nil {
+				p.statement(node.Init)
+			}
+			p.write(";")
+			if node.Condition != nil {
+				p.write(" ")
+				p.expression(node.Condition, 0)
+			}
+			p.write(";")
+			if node.Increment != nil {
+				p.write(" ")
+				p.statement(node.Increment)
+			}
+			p.write(" ")
+		} else if node.Condition != nil {
+			p.expression(node.Condition, 0)
+			p.write(" ")
+		}
+		p.block(node.Body)
+	case *ast.ForInStatement:
+		p.write("for " + node.Name + " in ")
+		p.expression(node.Iterable, 0)
+		p.write(" ")
+		p.block(node.Body)
+	case *ast.FunctionDeclareStatement:
+		p.write("fn " + node.Name)
+		p.signature(node.ParameterNames, node.ParameterTypes, node.ReturnType)
+		p.block(node.Body)
+	case *ast.BlockStatement:
+		p.block(node)
+	case *ast.ExportStatement:
+		p.write("export ")
+		p.expression(node.Module, 0)
+	default:
+		// break, continue, debugger and import
+		p.write(node.String())
+	}
+}
+
+func (p *printer) signature(names []string, types []*ast.Type, returnType *ast.Type) {
+	p.write("(")
+	for i, name := range names {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.write(name)
+		if i < len(types) && types[i] != nil {
+			p.write(": " + types[i].String())
+		}
+	}
+	p.write(")")
+	if returnType != nil {
+		p.write(" -> " + returnType.String())
+	}
+	p.write(" ")
+}
+
+const (
+	precedenceTernary = 1 + iota
+	precedenceLogicOr
+	precedenceLogicAnd
+	precedenceBitOr
+	precedenceBitXor
+	precedenceBitAnd
+	precedenceEquality
+	precedenceRelational
+	precedenceShift
+	precedenceAdditive
+	precedenceMultiplicative
+	precedenceUnary
+	precedencePostfix
+)
+
+var binaryPrecedence = map[tokenize.TokenType]int{
+	tokenize.TokenLogicOr:  precedenceLogicOr,
+	tokenize.TokenLogicAnd: precedenceLogicAnd,
+	tokenize.TokenBitOr:    precedenceBitOr,
+	tokenize.TokenBitXor:   precedenceBitXor,
+	tokenize.TokenBitAnd:   precedenceBitAnd,
+	tokenize.TokenEQ:       precedenceEquality,
+	tokenize.TokenNEQ:      precedenceEquality,
+	tokenize.TokenIs:       precedenceEquality,
+	tokenize.TokenLT:       precedenceRelational,
+	tokenize.TokenLTE:      precedenceRelational,
+	tokenize.TokenGT:       precedenceRelational,
+	tokenize.TokenGTE:      precedenceRelational,
+	tokenize.TokenBitLhs:   precedenceShift,
+	tokenize.TokenBitRhs:   precedenceShift,
+	tokenize.TokenPlus:     precedenceAdditive,
+	tokenize.TokenMinus:    precedenceAdditive,
+	tokenize.TokenMul:      precedenceMultiplicative,
+	tokenize.TokenDiv:      precedenceMultiplicative,
+	tokenize.TokenMod:      precedenceMultiplicative,
+}
+
+func precedence(node ast.Expression) int {
+	switch node := node.(type) {
+	case *ast.TernaryExpression:
+		return precedenceTernary
+	case *ast.BinaryExpression:
+		return binaryPrecedence[node.Op]
+	case *ast.UnaryExpression:
+		return precedenceUnary
+	default:
+		return precedencePostfix
+	}
+}
+
+func (p *printer) expressions(list []ast.Expression) {
+	for i, e := range list {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.expression(e, 0)
+	}
+}
+
+// expression prints node, in parentheses if it binds less tightly than
+// the precedence its position requires.
+func (p *printer) expression(node ast.Expression, required int) {
+	if precedence(node) < required {
+		p.write("(")
+		defer p.write(")")
+	}
+	switch node := node.(type) {
+	case *ast.IntLiteralExpression, *ast.FloatLiteralExpression, *ast.StringLiteralExpression, *ast.BytesLiteralExpression:
+		// as written, e.g. in hex or with its escapes
+		p.write(p.text(node))
+	case *ast.TernaryExpression:
+		p.expression(node.Cond, precedenceLogicOr)
+		p.write(" ? ")
+		p.expression(node.X, precedenceTernary)
+		p.write(" : ")
+		p.expression(node.Y, precedenceTernary)
+	case *ast.BinaryExpression:
+		// operators are left associative
+		op := binaryPrecedence[node.Op]
+		p.expression(node.Left, op)
+		p.write(" " + node.Op.String() + " ")
+		p.expression(node.Right, op+1)
+	case *ast.UnaryExpression:
+		p.write(node.Op.String())
+		p.expression(node.Expression, precedenceUnary)
+	case *ast.CallFunctionExpression:
+		p.expression(node.Callable, precedencePostfix)
+		p.write("(")
+		p.expressions(node.Args.List)
+		p.write(")")
+	case *ast.IndexAccessExpression:
+		p.expression(node.Value, precedencePostfix)
+		p.write("[")
+		p.expression(node.Index, 0)
+		p.write("]")
+	case *ast.SliceExpression:
+		p.expression(node.Value, precedencePostfix)
+		p.write("[")
+		if node.Low != nil {
+			p.expression(node.Low, 0)
+		}
+		p.write(":")
+		if node.High != nil {
+			p.expression(node.High, 0)
+		}
+		p.write("]")
+	case *ast.AttributeAccessExpression:
+		p.expression(node.Value, precedencePostfix)
+		p.write("." + node.Name)
+	case *ast.ListLiteralExpression:
+		p.elements(node, "[", "]", len(node.Value.List), func(i int) (string, ast.Expression) {
+			return "", node.Value.List[i]
+		})
+	case *ast.DictLiteralExpression:
+		p.elements(node, "{", "}", len(node.Keys), func(i int) (string, ast.Expression) {
+			return node.Keys[i] + ": ", node.Value[node.Keys[i]]
+		})
+	case *ast.FunctionDeclareExpression:
+		p.write("fn")
+		p.signature(node.ParameterNames, node.ParameterTypes, node.ReturnType)
+		p.block(node.Body)
+	default:
+		// null, true, false and names
+		p.write(node.String())
+	}
+}
+
+// elements prints the n elements of a list or dict literal, on one line
+// unless the literal spans several lines in the source, then each element
+// gets a line of its own.
+func (p *printer) elements(node ast.Expression, open, close string, n int, element func(int) (string, ast.Expression)) {
+	if n == 0 {
+		p.write(open + close)
+		return
+	}
+	if node.Start().Line == node.End().Line {
+		p.write(open)
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				p.write(", ")
+			}
+			prefix, e := element(i)
+			p.write(prefix)
+			p.expression(e, 0)
+		}
+		p.write(close)
+		return
+	}
+
+	end := node.End().Offset - 1
+	p.write(open)
+	_, first := element(0)
+	p.trailing(node.Start().Offset, node.Start().Line, first.Start().Offset)
+	p.buf.WriteByte('\n')
+	p.indent++
+	p.line = 0
+	for i := 0; i < n; i++ {
+		prefix, e := element(i)
+		p.leading(e.Start().Offset)
+		p.startLine(e.Start().Line)
+		p.write(prefix)
+		p.expression(e, 0)
+		limit := end
+		if i+1 < n {
+			p.write(",")
+			_, next := element(i + 1)
+			limit = next.Start().Offset
+		}
+		p.line = e.End().Line
+		p.trailing(e.End().Offset, p.line, limit)
+		p.buf.WriteByte('\n')
+	}
+	p.leading(end)
+	p.indent--
+	p.write(strings.Repeat(indentation, p.indent) + close)
+}
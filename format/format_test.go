@@ -0,0 +1,61 @@
+package format_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/janqx/quark-lang/v1/format"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{"x=1+2*3", "x = 1 + 2 * 3\n"},
+		{"x = (1+2)*3\ny = a-(b-c)\nz = (a ? b : c) ? -(-d) : e", "x = (1 + 2) * 3\ny = a - (b - c)\nz = (a ? b : c) ? --d : e\n"},
+		{"fn f(a,b: Int)->Int { return a+b }", "fn f(a, b: Int) -> Int {\n  return a + b\n}\n"},
+		{"if a {\n\n\n  return\n} else if b { } else { x = [1,2] }", "if a {\n  return\n} else if b {} else {\n  x = [1, 2]\n}\n"},
+		{"for ;; { break }\nfor i = 0; i < 3; i = i + 1 {}\nfor k in {b: 1, a: 0x1f} {}", "for {\n  break\n}\nfor i = 0; i < 3; i = i + 1 {}\nfor k in {b: 1, a: 0x1f} {}\n"},
+		{"x = 1\n\n\n\ny = 'a\\n'[1:]", "x = 1\n\ny = 'a\\n'[1:]\n"},
+		{"x = [\n1, 2]", "x = [\n  1,\n  2\n]\n"},
+		{"// a\n\nx = 1   // b\n/* c */ y = 2\nif x { // d\n  // e\n}\n// f", "// a\n\nx = 1 // b\n/* c */\ny = 2\nif x { // d\n  // e\n}\n// f\n"},
+		{"l = [\n  1, // one\n  // two\n  2\n]", "l = [\n  1, // one\n  // two\n  2\n]\n"},
+	}
+	for _, test := range tests {
+		result, err := format.Source("t.qk", []byte(test.source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(result) != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.source, test.expected, result)
+		}
+	}
+
+	if _, err := format.Source("t.qk", []byte("x = (")); err == nil {
+		t.Error("expected a syntax error")
+	}
+}
+
+func TestSource_Idempotent(t *testing.T) {
+	filenames, _ := filepath.Glob("../example/*.qk")
+	for _, filename := range filenames {
+		source, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		formatted, err := format.Source(filename, source)
+		if err != nil {
+			// some examples use syntax that isn't supported yet
+			continue
+		}
+		again, err := format.Source(filename, formatted)
+		if err != nil {
+			t.Fatalf("%s: %v", filename, err)
+		}
+		if string(again) != string(formatted) {
+			t.Errorf("%s: formatting isn't stable:\n%s\n%s", filename, formatted, again)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package quark
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+)
 
 type Opcode uint8
 
@@ -21,6 +24,7 @@ const (
 	OpLoadGlobal
 	OpLoadIndex
 	OpLoadAttribute
+	OpLoadSlice
 
 	OpStoreLocal
 	OpStoreOuter
@@ -44,6 +48,7 @@ const (
 	OpBinaryGTE
 	OpBinaryEQ
 	OpBinaryNEQ
+	OpBinaryIs
 	OpBinaryBitAnd
 	OpBinaryBitOr
 	OpBinaryBitXor
@@ -55,10 +60,14 @@ const (
 	OpJumpIfFalseOrPop
 	OpJumpIfTrueOrPop
 
+	OpIterInit
+	OpIterNext
+
 	OpClosure
 	OpCall
 	OpReturn
 	OpRemoveTop
+	OpCopy
 
 	OpBuildList
 	OpBuildDict
@@ -67,6 +76,18 @@ const (
 	OpExport
 
 	OpDebugger
+
+	// superinstructions, they replace the first instruction of a common
+	// sequence and skip the rest, which stay in place to hold their
+	// operands and keep jump targets valid
+	OpIncLocalConst         // OpLoadLocal a; OpLoadConst k; OpBinaryAdd; OpStoreLocal a
+	OpBinaryLocalConst      // OpLoadLocal a; OpLoadConst k; OpBinary*
+	OpCompareLocalConstJump // OpLoadLocal a; OpLoadConst k; OpBinary<cmp>; OpJumpIfFalse t
+	OpCompareLocalsJump     // OpLoadLocal a; OpLoadLocal b; OpBinary<cmp>; OpJumpIfFalse t
+
+	// OpExtendedArg holds the high bits of the operand of the next
+	// instruction, it is emitted for operands that don't fit in 24 bits
+	OpExtendedArg
 )
 
 var OpcodeToString = [...]string{
@@ -82,6 +103,7 @@ var OpcodeToString = [...]string{
 	OpLoadGlobal:    "OpLoadGlobal",
 	OpLoadIndex:     "OpLoadIndex",
 	OpLoadAttribute: "OpLoadAttribute",
+	OpLoadSlice:     "OpLoadSlice",
 
 	OpStoreLocal:     "OpStoreLocal",
 	OpStoreOuter:     "OpStoreOuter",
@@ -105,6 +127,7 @@ var OpcodeToString = [...]string{
 	OpBinaryGTE:    "OpBinaryGTE",
 	OpBinaryEQ:     "OpBinaryEQ",
 	OpBinaryNEQ:    "OpBinaryNEQ",
+	OpBinaryIs:     "OpBinaryIs",
 	OpBinaryBitAnd: "OpBinaryBitAnd",
 	OpBinaryBitOr:  "OpBinaryBitOr",
 	OpBinaryBitXor: "OpBinaryBitXor",
@@ -116,10 +139,14 @@ var OpcodeToString = [...]string{
 	OpJumpIfFalseOrPop: "OpJumpIfFalseOrPop",
 	OpJumpIfTrueOrPop:  "OpJumpIfTrueOrPop",
 
+	OpIterInit: "OpIterInit",
+	OpIterNext: "OpIterNext",
+
 	OpClosure:   "OpClosure",
 	OpCall:      "OpCall",
 	OpReturn:    "OpReturn",
 	OpRemoveTop: "OpRemoveTop",
+	OpCopy:      "OpCopy",
 
 	OpBuildList: "OpBuildList",
 	OpBuildDict: "OpBuildDict",
@@ -128,6 +155,39 @@ var OpcodeToString = [...]string{
 	OpExport: "OpExport",
 
 	OpDebugger: "OpDebugger",
+
+	OpIncLocalConst:         "OpIncLocalConst",
+	OpBinaryLocalConst:      "OpBinaryLocalConst",
+	OpCompareLocalConstJump: "OpCompareLocalConstJump",
+	OpCompareLocalsJump:     "OpCompareLocalsJump",
+
+	OpExtendedArg: "OpExtendedArg",
+}
+
+// operators maps unary and binary opcodes to their source operator, used
+// in error messages.
+var operators = map[Opcode]string{
+	OpUnaryBitNot:  "~",
+	OpUnaryNot:     "!",
+	OpUnaryPlus:    "+",
+	OpUnaryMinus:   "-",
+	OpBinaryAdd:    "+",
+	OpBinarySub:    "-",
+	OpBinaryMul:    "*",
+	OpBinaryDiv:    "/",
+	OpBinaryMod:    "%",
+	OpBinaryLT:     "<",
+	OpBinaryLTE:    "<=",
+	OpBinaryGT:     ">",
+	OpBinaryGTE:    ">=",
+	OpBinaryEQ:     "==",
+	OpBinaryNEQ:    "!=",
+	OpBinaryIs:     "is",
+	OpBinaryBitAnd: "&",
+	OpBinaryBitOr:  "|",
+	OpBinaryBitXor: "^",
+	OpBinaryBitLhs: "<<",
+	OpBinaryBitRhs: ">>",
 }
 
 func (op Opcode) String() string {
@@ -136,6 +196,10 @@ func (op Opcode) String() string {
 
 var InvalidOperand Operand = 0x00ffffff
 
+// MaxOperand is the largest operand an instruction prefixed by an
+// OpExtendedArg can have.
+const MaxOperand = math.MaxUint32
+
 func (operand Operand) isValid() bool {
 	return operand < InvalidOperand
 }
@@ -0,0 +1,50 @@
+// Package framing reads and writes the JSON messages of the Language
+// Server and Debug Adapter protocols, which are both framed by a
+// Content-Length header.
+package framing
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+)
+
+// MaxMessageSize bounds what a Content-Length header can make a server
+// allocate.
+const MaxMessageSize = 64 << 20
+
+// ReadMessage reads a message framed by a Content-Length header.
+func ReadMessage(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length '%s'", header.Get("Content-Length"))
+	}
+	if length > MaxMessageSize {
+		return nil, fmt.Errorf("message of %d bytes exceeds the limit of %d bytes", length, MaxMessageSize)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// WriteMessage writes message as JSON framed by a Content-Length header.
+func WriteMessage(w io.Writer, message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(data)); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,61 @@
+package quark
+
+import (
+	"sort"
+
+	"github.com/janqx/quark-lang/v1/tokenize"
+)
+
+type LineTableEntry struct {
+	PC     int
+	Line   int
+	Column int
+}
+
+// LineTable maps instruction indexes to source positions. An entry is only
+// recorded when the position changes, it covers every instruction up to the
+// next entry.
+type LineTable struct {
+	Entries []LineTableEntry
+}
+
+func (t *LineTable) add(pc int, position tokenize.Position) {
+	if n := len(t.Entries); n > 0 {
+		last := t.Entries[n-1]
+		if last.Line == position.Line && last.Column == position.Column {
+			return
+		}
+	}
+	t.Entries = append(t.Entries, LineTableEntry{
+		PC:     pc,
+		Line:   position.Line,
+		Column: position.Column,
+	})
+}
+
+// Lookup returns the position of the instruction at pc, line is 0 when
+// the table has no entry for it.
+func (t *LineTable) Lookup(pc int) (line int, column int) {
+	i := sort.Search(len(t.Entries), func(i int) bool {
+		return t.Entries[i].PC > pc
+	})
+	if i == 0 {
+		return 0, 0
+	}
+	return t.Entries[i-1].Line, t.Entries[i-1].Column
+}
+
+// remap moves the entries to the instruction indexes given by newIndex
+// after instructions were removed or inserted. An entry whose instructions
+// were all removed is dropped.
+func (t *LineTable) remap(newIndex []int) {
+	entries := t.Entries
+	t.Entries = nil
+	for _, entry := range entries {
+		pc := newIndex[entry.PC]
+		if n := len(t.Entries); n > 0 && t.Entries[n-1].PC == pc {
+			t.Entries = t.Entries[:n-1]
+		}
+		t.add(pc, tokenize.Position{Line: entry.Line, Column: entry.Column})
+	}
+}
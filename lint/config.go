@@ -0,0 +1,113 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/janqx/quark-lang/v1/diagnostic"
+)
+
+const (
+	RuleUnusedVariable  = "unused-variable"
+	RuleUnusedParameter = "unused-parameter"
+	RuleShadow          = "shadow"
+	RuleBuiltinAssign   = "builtin-assign"
+	RuleNullComparison  = "null-comparison"
+	RuleUnreachable     = "unreachable"
+	RuleExportLast      = "export-last"
+	RuleNesting         = "nesting"
+
+	// RuleSyntax reports syntax errors, it can't be configured.
+	RuleSyntax = "syntax"
+)
+
+// Rules describes every rule.
+var Rules = map[string]string{
+	RuleUnusedVariable:  "local variables that are assigned but never read",
+	RuleUnusedParameter: "parameters that are never read",
+	RuleShadow:          "parameters hiding a variable or a builtin of an enclosing scope",
+	RuleBuiltinAssign:   "assignments replacing a builtin like print",
+	RuleNullComparison:  "comparisons to null with == or != instead of is",
+	RuleUnreachable:     "statements that can never run",
+	RuleExportLast:      "export statements that aren't the last statement of the file",
+	RuleNesting:         "blocks nested deeper than max in a function",
+}
+
+// DefaultMaxNesting is the deepest nesting the nesting rule allows unless
+// configured otherwise.
+const DefaultMaxNesting = 4
+
+const (
+	SeverityOff     = "off"
+	SeverityWarning = "warning"
+	SeverityError   = "error"
+)
+
+// RuleConfig configures a rule, the zero value runs it with its defaults.
+type RuleConfig struct {
+	Severity string `json:"severity,omitempty"` // off, warning or error, warning by default
+	Max      int    `json:"max,omitempty"`      // for nesting
+}
+
+// Config selects the rules to run and how. It is read from JSON such as
+//
+//	{"rules": {"shadow": {"severity": "off"}, "nesting": {"max": 3}}}
+type Config struct {
+	Rules map[string]RuleConfig `json:"rules"`
+}
+
+func DefaultConfig() *Config {
+	return &Config{Rules: map[string]RuleConfig{}}
+}
+
+// LoadConfig reads a configuration file, unknown rules and severities are
+// errors so that a typo doesn't go unnoticed.
+func LoadConfig(filename string) (*Config, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	config := DefaultConfig()
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	if config.Rules == nil {
+		config.Rules = map[string]RuleConfig{}
+	}
+	names := make([]string, 0, len(config.Rules))
+	for name := range config.Rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := Rules[name]; !ok {
+			return nil, fmt.Errorf("%s: unknown rule '%s'", filename, name)
+		}
+		switch config.Rules[name].Severity {
+		case "", SeverityOff, SeverityWarning, SeverityError:
+		default:
+			return nil, fmt.Errorf("%s: rule '%s' has an unknown severity '%s'", filename, name, config.Rules[name].Severity)
+		}
+	}
+	return config, nil
+}
+
+func (c *Config) enabled(rule string) bool {
+	return c.Rules[rule].Severity != SeverityOff
+}
+
+func (c *Config) severity(rule string) diagnostic.Severity {
+	if c.Rules[rule].Severity == SeverityError {
+		return diagnostic.SeverityError
+	}
+	return diagnostic.SeverityWarning
+}
+
+func (c *Config) maxNesting() int {
+	if max := c.Rules[RuleNesting].Max; max > 0 {
+		return max
+	}
+	return DefaultMaxNesting
+}
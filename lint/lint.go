@@ -0,0 +1,455 @@
+// Package lint reports code that is valid but likely wrong or hard to
+// read. Every rule can be configured, see Config, and silenced by a comment
+// on the line of a problem or alone on the line before it:
+//
+//	x = 1 // lint:ignore unused-variable
+//
+//	// lint:ignore unused-variable
+//	x = 1
+//
+// or for the whole file with lint:file-ignore. Without rule names all the
+// rules are silenced.
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/janqx/quark-lang/v1/ast"
+	"github.com/janqx/quark-lang/v1/diagnostic"
+	"github.com/janqx/quark-lang/v1/parser"
+	"github.com/janqx/quark-lang/v1/tokenize"
+	"github.com/janqx/quark-lang/v1/typecheck"
+)
+
+// Problem is a diagnostic of a rule.
+type Problem struct {
+	Rule string
+	diagnostic.Diagnostic
+}
+
+func (p Problem) String() string {
+	s := fmt.Sprintf("%s: %s: %s [%s]", p.Start.String(), p.Severity.String(), p.Message, p.Rule)
+	for _, hint := range p.Hints {
+		s += "\n    hint: " + hint
+	}
+	return s
+}
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		File      string   `json:"file"`
+		Line      int      `json:"line"`
+		Column    int      `json:"column"`
+		EndLine   int      `json:"endLine"`
+		EndColumn int      `json:"endColumn"`
+		Severity  string   `json:"severity"`
+		Rule      string   `json:"rule"`
+		Message   string   `json:"message"`
+		Hints     []string `json:"hints,omitempty"`
+	}{
+		File:      p.Start.Filename,
+		Line:      p.Start.Line,
+		Column:    p.Start.Column,
+		EndLine:   p.End.Line,
+		EndColumn: p.End.Column,
+		Severity:  p.Severity.String(),
+		Rule:      p.Rule,
+		Message:   p.Message,
+		Hints:     p.Hints,
+	})
+}
+
+// Source lints the source of the file filename, syntax errors are
+// returned as problems of RuleSyntax.
+func Source(filename string, source []byte, config *Config) []Problem {
+	p := parser.NewParser(filename, source)
+	p.SetMode(parser.ScanComments)
+	chunk, err := p.Parse()
+	if err != nil {
+		var problems []Problem
+		if diagnostics, ok := err.(diagnostic.Diagnostics); ok {
+			for _, d := range diagnostics {
+				problems = append(problems, Problem{Rule: RuleSyntax, Diagnostic: d})
+			}
+		}
+		return problems
+	}
+	return NewLinter(config).Lint(chunk, source, p.Comments())
+}
+
+type variable struct {
+	name      string
+	start     tokenize.Position
+	end       tokenize.Position
+	parameter bool
+	used      bool
+}
+
+// scope follows the scoping rules of the compiler: assigning a name that
+// isn't visible declares it in the current scope.
+type scope struct {
+	parent    *scope
+	variables map[string]*variable
+	order     []*variable
+}
+
+type Linter struct {
+	config   *Config
+	root     *scope
+	scope    *scope
+	nesting  int // of blocks in the current function
+	problems []Problem
+}
+
+func NewLinter(config *Config) *Linter {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	return &Linter{config: config}
+}
+
+// Lint returns the problems found in chunk sorted by position, the
+// comments of its source are searched for suppressions.
+func (l *Linter) Lint(chunk *ast.Chunk, source []byte, comments []*tokenize.Token) []Problem {
+	l.root = &scope{variables: map[string]*variable{}}
+	l.scope = l.root
+	l.nesting = 0
+	l.problems = nil
+	chunk.Accept(l)
+
+	suppressions := newSuppressions(source, comments)
+	var result []Problem
+	for _, p := range l.problems {
+		if !suppressions.suppressed(p) {
+			result = append(result, p)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Start.Offset < result[j].Start.Offset
+	})
+	return result
+}
+
+func (l *Linter) report(rule string, start, end tokenize.Position, message string, hints ...string) {
+	if !l.config.enabled(rule) {
+		return
+	}
+	l.problems = append(l.problems, Problem{
+		Rule: rule,
+		Diagnostic: diagnostic.Diagnostic{
+			Severity: l.config.severity(rule),
+			Start:    start,
+			End:      end,
+			Message:  message,
+			Hints:    hints,
+		},
+	})
+}
+
+func (l *Linter) pushScope() {
+	l.scope = &scope{parent: l.scope, variables: map[string]*variable{}}
+}
+
+// popScope leaves the current scope and reports its variables that were
+// never read. Variables of the root scope can be read by importers.
+func (l *Linter) popScope() {
+	for _, v := range l.scope.order {
+		if v.used || strings.HasPrefix(v.name, "_") {
+			continue
+		}
+		hint := fmt.Sprintf("rename it to '_%s' if this is intentional", v.name)
+		if v.parameter {
+			l.report(RuleUnusedParameter, v.start, v.end, fmt.Sprintf("parameter '%s' is never used", v.name), hint)
+		} else {
+			l.report(RuleUnusedVariable, v.start, v.end, fmt.Sprintf("variable '%s' is declared but never used", v.name), hint)
+		}
+	}
+	l.scope = l.scope.parent
+}
+
+func (l *Linter) lookup(name string) *variable {
+	for s := l.scope; s != nil; s = s.parent {
+		if v, ok := s.variables[name]; ok {
+			return v
+		}
+	}
+	return nil
+}
+
+// assign resolves the name assigned by node, declaring it if it isn't
+// visible, unless it names a builtin.
+func (l *Linter) assign(name string, node ast.Node) {
+	if l.lookup(name) != nil {
+		return
+	}
+	if _, ok := typecheck.Builtins[name]; ok {
+		l.report(RuleBuiltinAssign, node.Start(), node.End(), fmt.Sprintf("assignment replaces the builtin '%s'", name),
+			"choose another name")
+		return
+	}
+	l.declare(name, node.Start(), node.End())
+}
+
+func (l *Linter) declare(name string, start, end tokenize.Position) *variable {
+	v := &variable{name: name, start: start, end: end}
+	l.scope.variables[name] = v
+	if l.scope != l.root {
+		l.scope.order = append(l.scope.order, v)
+	}
+	return v
+}
+
+// function visits a function in a scope of its own, the parameters are
+// reported at their names if the parser recorded where they are.
+func (l *Linter) function(node ast.Node, parameterNames []string, spans []ast.Span, body ast.Statement) {
+	nesting := l.nesting
+	l.nesting = 0
+	l.pushScope()
+	for i, name := range parameterNames {
+		start, end := node.Start(), node.End()
+		if i < len(spans) {
+			start, end = spans[i].Start, spans[i].End
+		}
+		if v := l.lookup(name); v != nil {
+			l.report(RuleShadow, start, end, fmt.Sprintf("parameter '%s' shadows the variable declared at %s", name, v.start.String()))
+		} else if _, ok := typecheck.Builtins[name]; ok {
+			l.report(RuleShadow, start, end, fmt.Sprintf("parameter '%s' shadows the builtin '%s'", name, name))
+		}
+		l.declare(name, start, end).parameter = true
+	}
+	body.Accept(l)
+	l.popScope()
+	l.nesting = nesting
+}
+
+// nested visits the body of a control statement one level deeper, the
+// statement that goes past the limit is reported, not the ones inside it.
+func (l *Linter) nested(node ast.Node, visit func()) {
+	l.nesting++
+	if max := l.config.maxNesting(); l.nesting == max+1 {
+		l.report(RuleNesting, node.Start(), node.End(), fmt.Sprintf("blocks are nested more than %d deep", max),
+			"return early or move the inner code into a function")
+	}
+	visit()
+	l.nesting--
+}
+
+func nonEmpty(list []ast.Statement) []ast.Statement {
+	result := make([]ast.Statement, 0, len(list))
+	for _, s := range list {
+		if _, ok := s.(*ast.EmptyStatement); !ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func isNull(node ast.Expression) bool {
+	_, ok := node.(*ast.NullLiteralExpression)
+	return ok
+}
+
+func (l *Linter) VisitChunk(node *ast.Chunk) {
+	list := nonEmpty(node.Statements.List)
+	for i, s := range list {
+		if _, ok := s.(*ast.ExportStatement); ok && i < len(list)-1 {
+			l.report(RuleExportLast, s.Start(), s.End(), "'export' isn't the last statement",
+				"move it to the end of the file, a file exports one value")
+		}
+	}
+	node.Statements.Accept(l)
+}
+
+func (l *Linter) VisitStatementList(node *ast.StatementList) {
+	list := nonEmpty(node.List)
+	for i, s := range list {
+		s.Accept(l)
+		// the code after an export is reported by RuleExportLast
+		if _, export := s.(*ast.ExportStatement); !export && ast.Terminates(s) && i < len(list)-1 {
+			l.report(RuleUnreachable, list[i+1].Start(), list[len(list)-1].End(), "unreachable code")
+			return
+		}
+	}
+}
+
+func (l *Linter) VisitContinueStatement(node *ast.ContinueStatement) {
+}
+
+func (l *Linter) VisitBreakStatement(node *ast.BreakStatement) {
+}
+
+func (l *Linter) VisitBlockStatement(node *ast.BlockStatement) {
+	l.pushScope()
+	node.Statements.Accept(l)
+	l.popScope()
+}
+
+func (l *Linter) VisitReturnStatement(node *ast.ReturnStatement) {
+	node.Expressions.Accept(l)
+}
+
+func (l *Linter) VisitIfStatement(node *ast.IfStatement) {
+	l.nested(node, func() {
+		node.Condition.Accept(l)
+		node.ThenBody.Accept(l)
+		for _, elif := range node.Elifs {
+			elif.Condition.Accept(l)
+			elif.Body.Accept(l)
+		}
+		if node.ElseBody != nil {
+			node.ElseBody.Accept(l)
+		}
+	})
+}
+
+func (l *Linter) VisitForStatement(node *ast.ForStatement) {
+	if node.Init != nil {
+		node.Init.Accept(l)
+	}
+	if node.Condition != nil {
+		node.Condition.Accept(l)
+	}
+	l.nested(node, func() {
+		node.Body.Accept(l)
+	})
+	if node.Increment != nil {
+		node.Increment.Accept(l)
+	}
+}
+
+func (l *Linter) VisitForInStatement(node *ast.ForInStatement) {
+	node.Iterable.Accept(l)
+	l.assign(node.Name, node)
+	l.nested(node, func() {
+		node.Body.Accept(l)
+	})
+}
+
+func (l *Linter) VisitFunctionDeclareStatement(node *ast.FunctionDeclareStatement) {
+	l.assign(node.Name, node)
+	l.function(node, node.ParameterNames, node.ParameterSpans, node.Body)
+}
+
+func (l *Linter) VisitImportStatement(node *ast.ImportStatement) {
+}
+
+func (l *Linter) VisitExportStatement(node *ast.ExportStatement) {
+	node.Module.Accept(l)
+}
+
+func (l *Linter) VisitAssignStatement(node *ast.AssignStatement) {
+	node.Expressions.Accept(l)
+	for i := len(node.Assignables) - 1; i >= 0; i-- {
+		node.Assignables[i].Accept(l)
+	}
+}
+
+func (l *Linter) VisitCallFunctionStatement(node *ast.CallFunctionStatement) {
+	node.Args.Accept(l)
+	node.Callable.Accept(l)
+}
+
+func (l *Linter) VisitExpressionStatement(node *ast.ExpressionStatement) {
+	node.Expression.Accept(l)
+}
+
+func (l *Linter) VisitDebuggerStatement(node *ast.DebuggerStatement) {
+}
+
+func (l *Linter) VisitExpressionList(node *ast.ExpressionList) {
+	for _, e := range node.List {
+		e.Accept(l)
+	}
+}
+
+func (l *Linter) VisitNullLiteralExpression(node *ast.NullLiteralExpression) {
+}
+
+func (l *Linter) VisitTrueLiteralExpression(node *ast.TrueLiteralExpression) {
+}
+
+func (l *Linter) VisitFalseLiteralExpression(node *ast.FalseLiteralExpression) {
+}
+
+func (l *Linter) VisitIntLiteralExpression(node *ast.IntLiteralExpression) {
+}
+
+func (l *Linter) VisitFloatLiteralExpression(node *ast.FloatLiteralExpression) {
+}
+
+func (l *Linter) VisitStringLiteralExpression(node *ast.StringLiteralExpression) {
+}
+
+func (l *Linter) VisitBytesLiteralExpression(node *ast.BytesLiteralExpression) {
+}
+
+func (l *Linter) VisitListLiteralExpression(node *ast.ListLiteralExpression) {
+	node.Value.Accept(l)
+}
+
+func (l *Linter) VisitDictLiteralExpression(node *ast.DictLiteralExpression) {
+	for _, key := range node.Keys {
+		node.Value[key].Accept(l)
+	}
+}
+
+func (l *Linter) VisitIdentifierExpression(node *ast.IdentifierExpression) {
+	if node.Assign {
+		l.assign(node.Name, node)
+	} else if v := l.lookup(node.Name); v != nil {
+		v.used = true
+	}
+}
+
+func (l *Linter) VisitIndexAccessExpression(node *ast.IndexAccessExpression) {
+	node.Value.Accept(l)
+	node.Index.Accept(l)
+}
+
+func (l *Linter) VisitSliceExpression(node *ast.SliceExpression) {
+	node.Value.Accept(l)
+	if node.Low != nil {
+		node.Low.Accept(l)
+	}
+	if node.High != nil {
+		node.High.Accept(l)
+	}
+}
+
+func (l *Linter) VisitAttributeAccessExpression(node *ast.AttributeAccessExpression) {
+	node.Value.Accept(l)
+}
+
+func (l *Linter) VisitFunctionDeclareExpression(node *ast.FunctionDeclareExpression) {
+	l.function(node, node.ParameterNames, node.ParameterSpans, node.Body)
+}
+
+func (l *Linter) VisitCallFunctionExpression(node *ast.CallFunctionExpression) {
+	node.Args.Accept(l)
+	node.Callable.Accept(l)
+}
+
+func (l *Linter) VisitUnaryExpression(node *ast.UnaryExpression) {
+	node.Expression.Accept(l)
+}
+
+func (l *Linter) VisitBinaryExpression(node *ast.BinaryExpression) {
+	if (node.Op == tokenize.TokenEQ || node.Op == tokenize.TokenNEQ) && (isNull(node.Left) || isNull(node.Right)) {
+		hint := "use 'x is null' instead"
+		if node.Op == tokenize.TokenNEQ {
+			hint = "use '!(x is null)' instead"
+		}
+		l.report(RuleNullComparison, node.Start(), node.End(), fmt.Sprintf("comparison to null with '%s'", node.Op.String()), hint)
+	}
+	node.Left.Accept(l)
+	node.Right.Accept(l)
+}
+
+func (l *Linter) VisitTernaryExpression(node *ast.TernaryExpression) {
+	node.Cond.Accept(l)
+	node.X.Accept(l)
+	node.Y.Accept(l)
+}
@@ -0,0 +1,109 @@
+package lint_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/janqx/quark-lang/v1/lint"
+)
+
+func problems(config *lint.Config, source string) string {
+	var lines []string
+	for _, p := range lint.Source("t.qk", []byte(source), config) {
+		lines = append(lines, p.Start.String()+" "+p.Rule)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{"x = 1\nfn f(a, _b) {\n  y = 1\n  return a\n}", "t.qk:3:3 unused-variable"},
+		{"fn f(a) { return 1 }", "t.qk:1:6 unused-parameter"},
+		{"x = 1\nfn f(x) { return x }", "t.qk:2:6 shadow"},
+		{"fn f(length) { return length }", "t.qk:1:6 shadow"},
+		{"print = 1\nfn f() { length = 2 }\nfn println(x) { return x }", "t.qk:1:1 builtin-assign\nt.qk:2:10 builtin-assign\nt.qk:3:1 builtin-assign"},
+		{"x = null\nif x == null || null != x { x = x is null }", "t.qk:2:4 null-comparison\nt.qk:2:17 null-comparison"},
+		{"fn f(a) {\n  if a { return 1 } else { return 2 }\n  a = 3\n}", "t.qk:3:3 unreachable"},
+		{"for {\n  break\n  x = 1\n  y = 2\n}", "t.qk:3:3 unreachable"},
+		{"export 1\nx = 1", "t.qk:1:1 export-last"},
+		{"x = 1\nexport x", ""},
+		{"fn f(a) {\n  if a {\n    for {\n      if a {\n        for {\n          if a { break }\n        }\n      }\n    }\n  }\n}", "t.qk:6:11 nesting"},
+		{"fn f(a) {\n  if a { return fn(b) { if b { if b { if b { if b { return 1 } } } } } }\n}", ""},
+		{"x = (", "t.qk:1:6 syntax"},
+	}
+	for _, test := range tests {
+		if s := problems(nil, test.source); s != test.expected {
+			t.Errorf("%q: expected\n%s\ngot\n%s", test.source, test.expected, s)
+		}
+	}
+}
+
+func TestSource_ParameterRange(t *testing.T) {
+	result := lint.Source("t.qk", []byte("fn f(a, unused) {\n  return a\n}"), nil)
+	if len(result) != 1 || result[0].Rule != lint.RuleUnusedParameter {
+		t.Fatalf("unexpected problems: %v", result)
+	}
+	if start, end := result[0].Start, result[0].End; start.Line != 1 || start.Column != 9 || end.Line != 1 || end.Column != 15 {
+		t.Fatalf("unexpected range %s-%s", start.String(), end.String())
+	}
+}
+
+func TestSource_Suppressions(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{"print = 1 // lint:ignore builtin-assign", ""},
+		{"// lint:ignore shadow, builtin-assign\nprint = 1", ""},
+		{"// lint:ignore shadow\nprint = 1", "t.qk:2:1 builtin-assign"},
+		{"/* lint:ignore */ print = 1\nx = 1\nlength = 2", "t.qk:3:1 builtin-assign"},
+		{"// lint:file-ignore builtin-assign\nx = 1\nprint = 1\nlength = 2", ""},
+		{"x = 1 // lint:ignore\nprint = 1", "t.qk:2:1 builtin-assign"},
+		{"  /* lint:ignore\n  */\nprint = 1", ""},
+	}
+	for _, test := range tests {
+		if s := problems(nil, test.source); s != test.expected {
+			t.Errorf("%q: expected\n%s\ngot\n%s", test.source, test.expected, s)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quark-lint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, ".quarklint.json")
+	ioutil.WriteFile(filename, []byte(`{"rules": {"shadow": {"severity": "off"}, "null-comparison": {"severity": "error"}, "nesting": {"max": 1}}}`), 0644)
+	config, err := lint.LoadConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := "x = 1\nfn f(x) {\n  if x { if x == null { return } }\n}"
+	result := lint.Source("t.qk", []byte(source), config)
+	if len(result) != 2 || result[0].Rule != lint.RuleNesting || result[1].Rule != lint.RuleNullComparison || result[1].Severity.String() != "error" {
+		t.Fatalf("unexpected problems: %v", result)
+	}
+	data, err := json.Marshal(result[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"file":"t.qk","line":3,"column":13,"endLine":3,"endColumn":22,"severity":"error","rule":"null-comparison","message":"comparison to null with '=='","hints":["use 'x is null' instead"]}`
+	if string(data) != expected {
+		t.Fatalf("expected %s, got %s", expected, data)
+	}
+
+	ioutil.WriteFile(filename, []byte(`{"rules": {"shadows": {}}}`), 0644)
+	if _, err := lint.LoadConfig(filename); err == nil || !strings.Contains(err.Error(), "unknown rule 'shadows'") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
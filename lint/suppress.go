@@ -0,0 +1,102 @@
+package lint
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/janqx/quark-lang/v1/tokenize"
+)
+
+const (
+	directiveIgnore     = "lint:ignore"
+	directiveFileIgnore = "lint:file-ignore"
+)
+
+// rules is a set of rule names, nil stands for all the rules.
+type rules map[string]bool
+
+func (r rules) has(rule string) bool {
+	return r == nil || r[rule]
+}
+
+type suppressions struct {
+	file  []rules
+	lines map[int][]rules
+}
+
+// newSuppressions reads the lint directives of the comments of source, a
+// lint:ignore comment applies to its line and, if no code shares the line,
+// to the next one.
+func newSuppressions(source []byte, comments []*tokenize.Token) *suppressions {
+	s := &suppressions{lines: map[int][]rules{}}
+	for _, comment := range comments {
+		text := comment.Value.(string)
+		if strings.HasPrefix(text, "/*") {
+			text = strings.TrimSuffix(text[2:], "*/")
+		} else {
+			text = text[2:]
+		}
+		text = strings.TrimSpace(text)
+		switch {
+		case strings.HasPrefix(text, directiveFileIgnore):
+			s.file = append(s.file, parseRules(text[len(directiveFileIgnore):]))
+		case strings.HasPrefix(text, directiveIgnore):
+			r := parseRules(text[len(directiveIgnore):])
+			s.lines[comment.End.Line] = append(s.lines[comment.End.Line], r)
+			if ownLine(source, comment) {
+				s.lines[comment.End.Line+1] = append(s.lines[comment.End.Line+1], r)
+			}
+		}
+	}
+	return s
+}
+
+// ownLine reports whether only blanks surround comment on its lines.
+func ownLine(source []byte, comment *tokenize.Token) bool {
+	start, end := comment.Position.Offset, comment.End.Offset
+	if start < 0 || end > len(source) || start > end {
+		return false
+	}
+	before := source[:start]
+	if i := bytes.LastIndexByte(before, '\n'); i >= 0 {
+		before = before[i+1:]
+	}
+	after := source[end:]
+	if i := bytes.IndexByte(after, '\n'); i >= 0 {
+		after = after[:i]
+	}
+	return len(bytes.TrimSpace(before)) == 0 && len(bytes.TrimSpace(after)) == 0
+}
+
+// parseRules reads the rule names following a directive, separated by
+// commas or spaces.
+func parseRules(s string) rules {
+	names := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+	if len(names) == 0 {
+		return nil
+	}
+	result := rules{}
+	for _, name := range names {
+		result[name] = true
+	}
+	return result
+}
+
+func (s *suppressions) suppressed(p Problem) bool {
+	if p.Rule == RuleSyntax {
+		return false
+	}
+	for _, r := range s.file {
+		if r.has(p.Rule) {
+			return true
+		}
+	}
+	for _, r := range s.lines[p.Start.Line] {
+		if r.has(p.Rule) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package lsp
+
+import (
+	"net/url"
+	"sort"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/janqx/quark-lang/v1"
+	"github.com/janqx/quark-lang/v1/diagnostic"
+	"github.com/janqx/quark-lang/v1/parser"
+	"github.com/janqx/quark-lang/v1/typecheck"
+)
+
+// document is an open file, analyzed whenever it changes.
+type document struct {
+	uri        string
+	filename   string
+	version    int
+	text       string
+	lineStarts []int // byte offsets
+
+	diagnostics diagnostic.Diagnostics
+	*resolution
+}
+
+func newDocument(ctx *quark.Context, uri string, version int, text string) *document {
+	d := &document{
+		uri:      uri,
+		filename: uri,
+		version:  version,
+		text:     text,
+	}
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+		d.filename = u.Path
+	}
+	d.lineStarts = []int{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			d.lineStarts = append(d.lineStarts, i+1)
+		}
+	}
+
+	// a chunk with syntax errors lacks the broken statements, the other
+	// checks would report what they declare as missing
+	chunk, err := parser.NewParser(d.filename, []byte(text)).Parse()
+	if err != nil {
+		d.diagnostics, _ = err.(diagnostic.Diagnostics)
+	} else {
+		d.diagnostics = append(quark.NewChecker(ctx).Check(chunk), typecheck.Check(chunk)...)
+		d.diagnostics.Sort()
+	}
+	d.resolution = resolve(text, chunk)
+	return d
+}
+
+// position converts a byte offset.
+func (d *document) position(offset int) Position {
+	if offset > len(d.text) {
+		offset = len(d.text)
+	}
+	line := sort.Search(len(d.lineStarts), func(i int) bool {
+		return d.lineStarts[i] > offset
+	}) - 1
+	character := 0
+	for _, r := range d.text[d.lineStarts[line]:offset] {
+		character += len(utf16.Encode([]rune{r}))
+	}
+	return Position{Line: line, Character: character}
+}
+
+// offset converts a position, positions past the end of their line are
+// moved to its end.
+func (d *document) offset(position Position) int {
+	if position.Line < 0 {
+		return 0
+	}
+	if position.Line >= len(d.lineStarts) {
+		return len(d.text)
+	}
+	offset := d.lineStarts[position.Line]
+	for character := 0; character < position.Character && offset < len(d.text) && d.text[offset] != '\n'; {
+		r, size := utf8.DecodeRuneInString(d.text[offset:])
+		character += len(utf16.Encode([]rune{r}))
+		offset += size
+	}
+	return offset
+}
+
+func (d *document) rangeOf(start, end int) Range {
+	return Range{Start: d.position(start), End: d.position(end)}
+}
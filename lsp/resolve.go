@@ -0,0 +1,405 @@
+package lsp
+
+import (
+	"sort"
+
+	"github.com/janqx/quark-lang/v1"
+	"github.com/janqx/quark-lang/v1/ast"
+)
+
+type definitionKind uint8
+
+const (
+	kindVariable definitionKind = iota
+	kindParameter
+	kindFunction
+	kindBuiltin
+)
+
+// definition is where a symbol is declared, builtins have no position.
+type definition struct {
+	name       string
+	kind       definitionKind
+	start, end int      // byte offsets of the name
+	parameters []string // of a function
+	module     string   // of a variable assigned import("module")
+}
+
+// occurrence is a name in the source referring to a definition.
+type occurrence struct {
+	start, end int
+	definition *definition
+}
+
+// scope is the symbol table of a function or a block and the text it
+// covers.
+type scope struct {
+	start, end int
+	table      *quark.SymbolTable
+}
+
+type resolution struct {
+	definitions map[*quark.Symbol]*definition
+	origins     map[*quark.Symbol]*quark.Symbol // outer symbols to the captured ones
+	occurrences []*occurrence                   // by offset
+	scopes      []*scope
+	symbols     []*DocumentSymbol
+}
+
+// resolver binds the names of a chunk to their definitions. It builds the
+// same symbol tables as the compiler, so names resolve the way they do
+// when the code runs.
+type resolver struct {
+	*resolution
+	source    string
+	table     *quark.SymbolTable
+	container *[]*DocumentSymbol // receives the symbols declared in the current function
+}
+
+func resolve(source string, chunk *ast.Chunk) *resolution {
+	r := &resolver{
+		resolution: &resolution{
+			definitions: map[*quark.Symbol]*definition{},
+			origins:     map[*quark.Symbol]*quark.Symbol{},
+		},
+		source: source,
+	}
+	globals := quark.NewSymbolTable(nil, quark.TypeFunction)
+	for _, name := range quark.BuiltinNames() {
+		r.definitions[globals.AddGlobalSymbol(name)] = &definition{name: name, kind: kindBuiltin, start: -1, end: -1}
+	}
+	r.table = globals
+	r.container = &r.symbols
+	r.push(quark.TypeFunction, 0, len(source))
+	chunk.Accept(r)
+	sort.SliceStable(r.occurrences, func(i, j int) bool {
+		return r.occurrences[i].start < r.occurrences[j].start
+	})
+	return r.resolution
+}
+
+func (r *resolver) push(stt quark.SymbolTableType, start, end int) {
+	parent := r.table
+	r.table = parent.Push(stt)
+	for name, symbol := range r.table.Symbols {
+		if captured := parent.Symbols[name]; captured != symbol {
+			r.origins[symbol] = captured
+		}
+	}
+	r.scopes = append(r.scopes, &scope{start: start, end: end, table: r.table})
+}
+
+func (r *resolver) pop() {
+	r.table = r.table.Pop()
+}
+
+func (r *resolution) definition(symbol *quark.Symbol) *definition {
+	for r.origins[symbol] != nil {
+		symbol = r.origins[symbol]
+	}
+	return r.definitions[symbol]
+}
+
+// occurrence returns the name at or just before offset, or nil.
+func (r *resolution) occurrence(offset int) *occurrence {
+	i := sort.Search(len(r.occurrences), func(i int) bool {
+		return r.occurrences[i].end >= offset
+	})
+	if i < len(r.occurrences) && r.occurrences[i].start <= offset {
+		return r.occurrences[i]
+	}
+	return nil
+}
+
+// scope returns the innermost scope around offset.
+func (r *resolution) scope(offset int) *scope {
+	// scopes are in the order they are entered, so those around offset
+	// come from the outermost to the innermost
+	var result *scope
+	for _, s := range r.scopes {
+		if s.start <= offset && offset <= s.end {
+			result = s
+		}
+	}
+	return result
+}
+
+// find returns the offset of the first occurrence of name as a whole word
+// at or after from, or -1.
+func (r *resolver) find(name string, from int) int {
+	for i := from; i >= 0 && i+len(name) <= len(r.source); i++ {
+		if r.source[i:i+len(name)] == name && (i == 0 || !isNameByte(r.source[i-1])) &&
+			(i+len(name) == len(r.source) || !isNameByte(r.source[i+len(name)])) {
+			return i
+		}
+	}
+	return -1
+}
+
+func isNameByte(b byte) bool {
+	return b == '_' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b >= 0x80
+}
+
+func (r *resolver) occur(start int, name string, d *definition) {
+	if start >= 0 && d != nil {
+		r.occurrences = append(r.occurrences, &occurrence{start: start, end: start + len(name), definition: d})
+	}
+}
+
+// declare resolves an assigned name at start, which is declared in the
+// current scope unless it is visible already. The definition is returned
+// with whether it is new.
+func (r *resolver) declare(name string, start int, kind definitionKind) (*definition, bool) {
+	if symbol := r.table.FindSymbol(name); symbol != nil {
+		d := r.definition(symbol)
+		r.occur(start, name, d)
+		return d, false
+	}
+	d := &definition{name: name, kind: kind, start: start, end: start + len(name)}
+	r.definitions[r.table.AddLocalSymbol(name)] = d
+	r.occur(start, name, d)
+	if kind != kindParameter && start >= 0 {
+		*r.container = append(*r.container, &DocumentSymbol{
+			Name:      name,
+			Kind:      SymbolVariable,
+			start:     start,
+			end:       start + len(name),
+			nameStart: start,
+			nameEnd:   start + len(name),
+		})
+	}
+	return d, true
+}
+
+// function resolves a function whose parameter list follows from.
+func (r *resolver) function(node ast.Node, from int, parameterNames []string, body ast.Statement, symbol *DocumentSymbol) {
+	container := r.container
+	var discarded []*DocumentSymbol
+	r.container = &discarded
+	if symbol != nil {
+		r.container = &symbol.Children
+	}
+	r.push(quark.TypeFunction, node.Start().Offset, node.End().Offset)
+	for _, name := range parameterNames {
+		start := r.find(name, from)
+		if start >= 0 {
+			from = start + len(name)
+		}
+		r.declare(name, start, kindParameter)
+	}
+	body.Accept(r)
+	r.pop()
+	r.container = container
+}
+
+func (r *resolver) VisitChunk(node *ast.Chunk) {
+	node.Statements.Accept(r)
+}
+
+func (r *resolver) VisitStatementList(node *ast.StatementList) {
+	for _, s := range node.List {
+		s.Accept(r)
+	}
+}
+
+func (r *resolver) VisitContinueStatement(node *ast.ContinueStatement) {
+}
+
+func (r *resolver) VisitBreakStatement(node *ast.BreakStatement) {
+}
+
+func (r *resolver) VisitBlockStatement(node *ast.BlockStatement) {
+	r.push(quark.TypeBlock, node.Start().Offset, node.End().Offset)
+	node.Statements.Accept(r)
+	r.pop()
+}
+
+func (r *resolver) VisitReturnStatement(node *ast.ReturnStatement) {
+	node.Expressions.Accept(r)
+}
+
+func (r *resolver) VisitIfStatement(node *ast.IfStatement) {
+	node.Condition.Accept(r)
+	node.ThenBody.Accept(r)
+	for _, elif := range node.Elifs {
+		elif.Condition.Accept(r)
+		elif.Body.Accept(r)
+	}
+	if node.ElseBody != nil {
+		node.ElseBody.Accept(r)
+	}
+}
+
+func (r *resolver) VisitForStatement(node *ast.ForStatement) {
+	if node.Init != nil {
+		node.Init.Accept(r)
+	}
+	if node.Condition != nil {
+		node.Condition.Accept(r)
+	}
+	node.Body.Accept(r)
+	if node.Increment != nil {
+		node.Increment.Accept(r)
+	}
+}
+
+func (r *resolver) VisitForInStatement(node *ast.ForInStatement) {
+	node.Iterable.Accept(r)
+	r.declare(node.Name, r.find(node.Name, node.Start().Offset+len("for")), kindVariable)
+	node.Body.Accept(r)
+}
+
+func (r *resolver) VisitFunctionDeclareStatement(node *ast.FunctionDeclareStatement) {
+	start := r.find(node.Name, node.Start().Offset+len("fn"))
+	d, created := r.declare(node.Name, start, kindFunction)
+	var symbol *DocumentSymbol
+	if created {
+		d.parameters = node.ParameterNames
+	}
+	if created && start >= 0 {
+		symbol = (*r.container)[len(*r.container)-1]
+		symbol.Kind = SymbolFunction
+		symbol.Detail = signature(d)
+		symbol.start, symbol.end = node.Start().Offset, node.End().Offset
+	}
+	from := node.Start().Offset
+	if start >= 0 {
+		from = start + len(node.Name)
+	}
+	r.function(node, from, node.ParameterNames, node.Body, symbol)
+}
+
+func (r *resolver) VisitImportStatement(node *ast.ImportStatement) {
+}
+
+func (r *resolver) VisitExportStatement(node *ast.ExportStatement) {
+	node.Module.Accept(r)
+}
+
+func (r *resolver) VisitAssignStatement(node *ast.AssignStatement) {
+	node.Expressions.Accept(r)
+	for i := len(node.Assignables) - 1; i >= 0; i-- {
+		identifier, ok := node.Assignables[i].(*ast.IdentifierExpression)
+		if !ok {
+			node.Assignables[i].Accept(r)
+			continue
+		}
+		d, created := r.declare(identifier.Name, identifier.Start().Offset, kindVariable)
+		if !created || len(node.Assignables) != len(node.Expressions.List) {
+			continue
+		}
+		switch value := node.Expressions.List[i].(type) {
+		case *ast.FunctionDeclareExpression:
+			d.kind = kindFunction
+			d.parameters = value.ParameterNames
+		case *ast.CallFunctionExpression:
+			callable, ok := value.Callable.(*ast.IdentifierExpression)
+			if !ok || callable.Name != "import" || len(value.Args.List) != 1 {
+				break
+			}
+			if path, ok := value.Args.List[0].(*ast.StringLiteralExpression); ok {
+				d.module = path.Value
+			}
+		}
+	}
+}
+
+func (r *resolver) VisitCallFunctionStatement(node *ast.CallFunctionStatement) {
+	node.Args.Accept(r)
+	node.Callable.Accept(r)
+}
+
+func (r *resolver) VisitExpressionStatement(node *ast.ExpressionStatement) {
+	node.Expression.Accept(r)
+}
+
+func (r *resolver) VisitDebuggerStatement(node *ast.DebuggerStatement) {
+}
+
+func (r *resolver) VisitExpressionList(node *ast.ExpressionList) {
+	for _, e := range node.List {
+		e.Accept(r)
+	}
+}
+
+func (r *resolver) VisitNullLiteralExpression(node *ast.NullLiteralExpression) {
+}
+
+func (r *resolver) VisitTrueLiteralExpression(node *ast.TrueLiteralExpression) {
+}
+
+func (r *resolver) VisitFalseLiteralExpression(node *ast.FalseLiteralExpression) {
+}
+
+func (r *resolver) VisitIntLiteralExpression(node *ast.IntLiteralExpression) {
+}
+
+func (r *resolver) VisitFloatLiteralExpression(node *ast.FloatLiteralExpression) {
+}
+
+func (r *resolver) VisitStringLiteralExpression(node *ast.StringLiteralExpression) {
+}
+
+func (r *resolver) VisitBytesLiteralExpression(node *ast.BytesLiteralExpression) {
+}
+
+func (r *resolver) VisitListLiteralExpression(node *ast.ListLiteralExpression) {
+	node.Value.Accept(r)
+}
+
+func (r *resolver) VisitDictLiteralExpression(node *ast.DictLiteralExpression) {
+	for _, key := range node.Keys {
+		node.Value[key].Accept(r)
+	}
+}
+
+func (r *resolver) VisitIdentifierExpression(node *ast.IdentifierExpression) {
+	if node.Assign {
+		r.declare(node.Name, node.Start().Offset, kindVariable)
+	} else if symbol := r.table.FindSymbol(node.Name); symbol != nil {
+		r.occur(node.Start().Offset, node.Name, r.definition(symbol))
+	}
+}
+
+func (r *resolver) VisitIndexAccessExpression(node *ast.IndexAccessExpression) {
+	node.Value.Accept(r)
+	node.Index.Accept(r)
+}
+
+func (r *resolver) VisitSliceExpression(node *ast.SliceExpression) {
+	node.Value.Accept(r)
+	if node.Low != nil {
+		node.Low.Accept(r)
+	}
+	if node.High != nil {
+		node.High.Accept(r)
+	}
+}
+
+func (r *resolver) VisitAttributeAccessExpression(node *ast.AttributeAccessExpression) {
+	node.Value.Accept(r)
+}
+
+func (r *resolver) VisitFunctionDeclareExpression(node *ast.FunctionDeclareExpression) {
+	r.function(node, node.Start().Offset+len("fn"), node.ParameterNames, node.Body, nil)
+}
+
+func (r *resolver) VisitCallFunctionExpression(node *ast.CallFunctionExpression) {
+	node.Args.Accept(r)
+	node.Callable.Accept(r)
+}
+
+func (r *resolver) VisitUnaryExpression(node *ast.UnaryExpression) {
+	node.Expression.Accept(r)
+}
+
+func (r *resolver) VisitBinaryExpression(node *ast.BinaryExpression) {
+	node.Left.Accept(r)
+	node.Right.Accept(r)
+}
+
+func (r *resolver) VisitTernaryExpression(node *ast.TernaryExpression) {
+	node.Cond.Accept(r)
+	node.X.Accept(r)
+	node.Y.Accept(r)
+}
@@ -0,0 +1,359 @@
+// Package lsp implements a language server for quark, editors start it with
+// quark lsp and talk to it over its standard input and output.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/janqx/quark-lang/v1"
+	"github.com/janqx/quark-lang/v1/diagnostic"
+	"github.com/janqx/quark-lang/v1/format"
+	"github.com/janqx/quark-lang/v1/internal/framing"
+	"github.com/janqx/quark-lang/v1/stdlib"
+	"github.com/janqx/quark-lang/v1/typecheck"
+)
+
+type Server struct {
+	in        *bufio.Reader
+	out       io.Writer
+	ctx       *quark.Context
+	modules   map[string]map[string]quark.Object
+	documents map[string]*document
+	shutdown  bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	modules := stdlib.LoadModules()
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		ctx:       quark.NewContext(quark.ModeNormal, modules),
+		modules:   modules,
+		documents: map[string]*document{},
+	}
+}
+
+// Run serves the client until it asks the server to exit or closes the
+// input. An error is returned if the client exits without shutting the
+// server down first.
+func (s *Server) Run() error {
+	for {
+		data, err := framing.ReadMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(data, &req); err != nil {
+			if err := s.respond(nil, nil, &responseError{Code: codeParseError, Message: err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit before shutdown")
+			}
+			return nil
+		}
+		result, rerr := s.handle(&req)
+		if req.ID == nil {
+			continue
+		}
+		if err := s.respond(req.ID, result, rerr); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) respond(id *json.RawMessage, result interface{}, err *responseError) error {
+	if err != nil {
+		result = nil
+	}
+	return framing.WriteMessage(s.out, &response{JSONRPC: "2.0", ID: id, Result: result, Error: err})
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	return framing.WriteMessage(s.out, &notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *Server) handle(req *request) (interface{}, *responseError) {
+	switch req.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":           1, // full
+				"definitionProvider":         true,
+				"referencesProvider":         true,
+				"hoverProvider":              true,
+				"completionProvider":         map[string]interface{}{"triggerCharacters": []string{"."}},
+				"documentSymbolProvider":     true,
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]interface{}{"name": "quark"},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		item := params.TextDocument
+		s.open(newDocument(s.ctx, item.URI, item.Version, item.Text))
+		return nil, nil
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		if n := len(params.ContentChanges); n > 0 {
+			text := params.ContentChanges[n-1].Text
+			s.open(newDocument(s.ctx, params.TextDocument.URI, params.TextDocument.Version, text))
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		delete(s.documents, params.TextDocument.URI)
+		s.notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		})
+		return nil, nil
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.definition(&params), nil
+	case "textDocument/references":
+		var params ReferenceParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.references(&params), nil
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.hover(&params), nil
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.completion(&params), nil
+	case "textDocument/documentSymbol":
+		var params DocumentParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.documentSymbols(&params), nil
+	case "textDocument/formatting":
+		var params DocumentParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.formatting(&params), nil
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + req.Method}
+}
+
+func decode(data json.RawMessage, params interface{}) *responseError {
+	if err := json.Unmarshal(data, params); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// open replaces the analysis of a document and publishes its diagnostics.
+func (s *Server) open(d *document) {
+	s.documents[d.uri] = d
+	diagnostics := make([]Diagnostic, 0, len(d.diagnostics))
+	for _, diag := range d.diagnostics {
+		severity := SeverityError
+		if diag.Severity == diagnostic.SeverityWarning {
+			severity = SeverityWarning
+		}
+		message := diag.Message
+		for _, hint := range diag.Hints {
+			message += "\n" + hint
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    d.rangeOf(diag.Start.Offset, diag.End.Offset),
+			Severity: severity,
+			Source:   "quark",
+			Message:  message,
+		})
+	}
+	s.notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{
+		URI:         d.uri,
+		Version:     d.version,
+		Diagnostics: diagnostics,
+	})
+}
+
+// lookup returns the document and the name at a position, the name is nil
+// if there is none.
+func (s *Server) lookup(params *TextDocumentPositionParams) (*document, *occurrence) {
+	d := s.documents[params.TextDocument.URI]
+	if d == nil {
+		return nil, nil
+	}
+	return d, d.occurrence(d.offset(params.Position))
+}
+
+func (s *Server) definition(params *TextDocumentPositionParams) interface{} {
+	d, o := s.lookup(params)
+	if o == nil || o.definition.start < 0 {
+		return nil
+	}
+	return &Location{URI: d.uri, Range: d.rangeOf(o.definition.start, o.definition.end)}
+}
+
+func (s *Server) references(params *ReferenceParams) []Location {
+	locations := []Location{}
+	d, o := s.lookup(&params.TextDocumentPositionParams)
+	if o == nil {
+		return locations
+	}
+	for _, other := range d.occurrences {
+		if other.definition != o.definition {
+			continue
+		}
+		if !params.Context.IncludeDeclaration && other.start == o.definition.start {
+			continue
+		}
+		locations = append(locations, Location{URI: d.uri, Range: d.rangeOf(other.start, other.end)})
+	}
+	return locations
+}
+
+func (s *Server) hover(params *TextDocumentPositionParams) interface{} {
+	d, o := s.lookup(params)
+	if o == nil {
+		return nil
+	}
+	return &Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: "```quark\n" + describe(o.definition) + "\n```"},
+		Range:    d.rangeOf(o.start, o.end),
+	}
+}
+
+// signature returns the declaration of a function.
+func signature(d *definition) string {
+	return "fn " + d.name + "(" + strings.Join(d.parameters, ", ") + ")"
+}
+
+func describe(d *definition) string {
+	switch d.kind {
+	case kindFunction:
+		return signature(d)
+	case kindBuiltin:
+		if typ := typecheck.Builtins[d.name]; typ != nil {
+			return "fn " + d.name + strings.TrimPrefix(typ.String(), "fn")
+		}
+		return "(builtin) " + d.name
+	case kindParameter:
+		return "(parameter) " + d.name
+	}
+	if d.module != "" {
+		return "(variable) " + d.name + " = import(\"" + d.module + "\")"
+	}
+	return "(variable) " + d.name
+}
+
+// completion offers the members of a module after a dot, or else the
+// names visible at the position.
+func (s *Server) completion(params *TextDocumentPositionParams) []CompletionItem {
+	items := []CompletionItem{}
+	d := s.documents[params.TextDocument.URI]
+	if d == nil {
+		return items
+	}
+	offset := d.offset(params.Position)
+	start := offset
+	for start > 0 && isNameByte(d.text[start-1]) {
+		start--
+	}
+	if start > 0 && d.text[start-1] == '.' {
+		o := d.occurrence(start - 1)
+		if o == nil || o.end != start-1 || o.definition.module == "" {
+			return items
+		}
+		for name, member := range s.modules[o.definition.module] {
+			item := CompletionItem{Label: name, Kind: CompletionVariable}
+			if _, ok := member.(*quark.BuiltinFunctionObject); ok {
+				item.Kind = CompletionFunction
+			}
+			items = append(items, item)
+		}
+	} else if scope := d.scope(offset); scope != nil {
+		for _, symbol := range scope.table.Symbols {
+			def := d.definition(symbol)
+			if def == nil {
+				continue
+			}
+			item := CompletionItem{Label: def.name, Kind: CompletionVariable, Detail: describe(def)}
+			switch {
+			case def.kind == kindFunction || def.kind == kindBuiltin:
+				item.Kind = CompletionFunction
+			case def.module != "":
+				item.Kind = CompletionModule
+			}
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Label < items[j].Label
+	})
+	return items
+}
+
+func (s *Server) documentSymbols(params *DocumentParams) []*DocumentSymbol {
+	d := s.documents[params.TextDocument.URI]
+	if d == nil {
+		return []*DocumentSymbol{}
+	}
+	var convert func(symbols []*DocumentSymbol)
+	convert = func(symbols []*DocumentSymbol) {
+		for _, symbol := range symbols {
+			symbol.Range = d.rangeOf(symbol.start, symbol.end)
+			symbol.SelectionRange = d.rangeOf(symbol.nameStart, symbol.nameEnd)
+			convert(symbol.Children)
+		}
+	}
+	convert(d.symbols)
+	if d.symbols == nil {
+		return []*DocumentSymbol{}
+	}
+	return d.symbols
+}
+
+// formatting replaces the whole document, nothing is changed if it has
+// syntax errors.
+func (s *Server) formatting(params *DocumentParams) []TextEdit {
+	d := s.documents[params.TextDocument.URI]
+	if d == nil {
+		return []TextEdit{}
+	}
+	formatted, err := format.Source(d.filename, []byte(d.text))
+	if err != nil || string(formatted) == d.text {
+		return []TextEdit{}
+	}
+	return []TextEdit{{Range: d.rangeOf(0, len(d.text)), NewText: string(formatted)}}
+}
@@ -0,0 +1,302 @@
+package lsp_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/janqx/quark-lang/v1/lsp"
+)
+
+// client drives a server the way an editor does.
+type client struct {
+	t      *testing.T
+	in     *io.PipeWriter
+	out    *bufio.Reader
+	nextID int
+	done   chan error
+}
+
+func newClient(t *testing.T) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	c := &client{t: t, in: clientOut, out: bufio.NewReader(clientIn), done: make(chan error, 1)}
+	go func() {
+		err := lsp.NewServer(serverIn, serverOut).Run()
+		serverOut.Close()
+		c.done <- err
+	}()
+	return c
+}
+
+func (c *client) send(message map[string]interface{}) {
+	message["jsonrpc"] = "2.0"
+	data, _ := json.Marshal(message)
+	if _, err := fmt.Fprintf(c.in, "Content-Length: %d\r\n\r\n%s", len(data), data); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) receive() map[string]interface{} {
+	header, err := textproto.NewReader(c.out).ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	length, _ := strconv.Atoi(header.Get("Content-Length"))
+	data := make([]byte, length)
+	if _, err := io.ReadFull(c.out, data); err != nil {
+		c.t.Fatal(err)
+	}
+	var message map[string]interface{}
+	if err := json.Unmarshal(data, &message); err != nil {
+		c.t.Fatal(err)
+	}
+	return message
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.send(map[string]interface{}{"method": method, "params": params})
+}
+
+func (c *client) request(method string, params interface{}) interface{} {
+	c.nextID++
+	c.send(map[string]interface{}{"id": c.nextID, "method": method, "params": params})
+	message := c.receive()
+	if message["id"] != float64(c.nextID) {
+		c.t.Fatalf("%s: unexpected message %v", method, message)
+	}
+	if message["error"] != nil {
+		c.t.Fatalf("%s: %v", method, message["error"])
+	}
+	return message["result"]
+}
+
+// decode converts a result to the type of v.
+func decode(t *testing.T, result interface{}, v interface{}) {
+	data, _ := json.Marshal(result)
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const uri = "file:///work/test.qk"
+
+const source = `math = import("math")
+fn area(radius) {
+  return math.PI * radius * radius
+}
+r = 2
+println(area(r))
+total = 0
+for x in [1, 2] {
+  total = total + x
+}
+`
+
+func position(line, character int) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri},
+		"position":     map[string]interface{}{"line": line, "character": character},
+	}
+}
+
+func document() map[string]interface{} {
+	return map[string]interface{}{"textDocument": map[string]interface{}{"uri": uri}}
+}
+
+func open(c *client, text string, version int) []lsp.Diagnostic {
+	if version == 1 {
+		c.notify("textDocument/didOpen", map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri, "version": version, "text": text},
+		})
+	} else {
+		c.notify("textDocument/didChange", map[string]interface{}{
+			"textDocument":   map[string]interface{}{"uri": uri, "version": version},
+			"contentChanges": []interface{}{map[string]interface{}{"text": text}},
+		})
+	}
+	message := c.receive()
+	if message["method"] != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("unexpected message %v", message)
+	}
+	var params lsp.PublishDiagnosticsParams
+	decode(c.t, message["params"], &params)
+	if params.URI != uri || params.Version != version {
+		c.t.Fatalf("unexpected diagnostics %v", params)
+	}
+	return params.Diagnostics
+}
+
+func TestServer(t *testing.T) {
+	c := newClient(t)
+	var initialize struct {
+		Capabilities map[string]interface{} `json:"capabilities"`
+	}
+	decode(t, c.request("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}}), &initialize)
+	for _, capability := range []string{"definitionProvider", "referencesProvider", "hoverProvider", "completionProvider", "documentSymbolProvider", "documentFormattingProvider"} {
+		if initialize.Capabilities[capability] == nil {
+			t.Errorf("capability %s missing", capability)
+		}
+	}
+	c.notify("initialized", map[string]interface{}{})
+
+	diagnostics := open(c, "x = (1\n", 1)
+	if len(diagnostics) == 0 || diagnostics[0].Severity != lsp.SeverityError || diagnostics[0].Range.Start.Line != 0 {
+		t.Errorf("syntax error not reported, got %v", diagnostics)
+	}
+	diagnostics = open(c, "break\n", 2)
+	if len(diagnostics) != 1 || diagnostics[0].Range != (lsp.Range{End: lsp.Position{Character: 5}}) {
+		t.Errorf("compile error not reported, got %v", diagnostics)
+	}
+	if diagnostics = open(c, source, 3); len(diagnostics) != 0 {
+		t.Errorf("unexpected diagnostics %v", diagnostics)
+	}
+
+	t.Run("definition", func(t *testing.T) {
+		var location lsp.Location
+		decode(t, c.request("textDocument/definition", position(5, 10)), &location)
+		want := lsp.Location{URI: uri, Range: lsp.Range{Start: lsp.Position{Line: 1, Character: 3}, End: lsp.Position{Line: 1, Character: 7}}}
+		if location != want {
+			t.Errorf("area: got %v, want %v", location, want)
+		}
+		decode(t, c.request("textDocument/definition", position(2, 22)), &location)
+		want.Range = lsp.Range{Start: lsp.Position{Line: 1, Character: 8}, End: lsp.Position{Line: 1, Character: 14}}
+		if location != want {
+			t.Errorf("radius: got %v, want %v", location, want)
+		}
+		if result := c.request("textDocument/definition", position(5, 2)); result != nil {
+			t.Errorf("builtin: got %v, want null", result)
+		}
+	})
+
+	t.Run("references", func(t *testing.T) {
+		params := position(6, 0)
+		params["context"] = map[string]interface{}{"includeDeclaration": true}
+		var locations []lsp.Location
+		decode(t, c.request("textDocument/references", params), &locations)
+		var lines []int
+		for _, location := range locations {
+			lines = append(lines, location.Range.Start.Line)
+		}
+		if !reflect.DeepEqual(lines, []int{6, 8, 8}) {
+			t.Errorf("total: got lines %v", lines)
+		}
+		params["context"] = map[string]interface{}{"includeDeclaration": false}
+		decode(t, c.request("textDocument/references", params), &locations)
+		if len(locations) != 2 {
+			t.Errorf("total without declaration: got %v", locations)
+		}
+	})
+
+	t.Run("hover", func(t *testing.T) {
+		tests := []struct {
+			line, character int
+			want            string
+		}{
+			{5, 9, "fn area(radius)"},
+			{1, 10, "(parameter) radius"},
+			{4, 0, "(variable) r"},
+			{0, 1, `(variable) math = import("math")`},
+			{5, 0, "fn println(Any) -> Null"},
+		}
+		for _, tt := range tests {
+			var hover lsp.Hover
+			decode(t, c.request("textDocument/hover", position(tt.line, tt.character)), &hover)
+			if want := "```quark\n" + tt.want + "\n```"; hover.Contents.Value != want {
+				t.Errorf("%d:%d: got %q, want %q", tt.line, tt.character, hover.Contents.Value, want)
+			}
+		}
+		if result := c.request("textDocument/hover", position(3, 0)); result != nil {
+			t.Errorf("got %v, want null", result)
+		}
+	})
+
+	t.Run("completion", func(t *testing.T) {
+		labels := func(result interface{}) map[string]int {
+			var items []lsp.CompletionItem
+			decode(t, result, &items)
+			kinds := map[string]int{}
+			for _, item := range items {
+				kinds[item.Label] = item.Kind
+			}
+			return kinds
+		}
+		kinds := labels(c.request("textDocument/completion", position(2, 27)))
+		for name, kind := range map[string]int{
+			"radius":  lsp.CompletionVariable,
+			"area":    lsp.CompletionFunction,
+			"math":    lsp.CompletionModule,
+			"println": lsp.CompletionFunction,
+		} {
+			if kinds[name] != kind {
+				t.Errorf("%s: got kind %d, want %d", name, kinds[name], kind)
+			}
+		}
+		if _, ok := kinds["total"]; ok {
+			t.Errorf("total is declared after area and isn't visible in it")
+		}
+		kinds = labels(c.request("textDocument/completion", position(2, 14)))
+		if kinds["PI"] != lsp.CompletionVariable || kinds["abs"] != lsp.CompletionFunction || kinds["area"] != 0 {
+			t.Errorf("math members: got %v", kinds)
+		}
+	})
+
+	t.Run("documentSymbol", func(t *testing.T) {
+		var symbols []lsp.DocumentSymbol
+		decode(t, c.request("textDocument/documentSymbol", document()), &symbols)
+		var names []string
+		for _, symbol := range symbols {
+			names = append(names, symbol.Name)
+		}
+		if !reflect.DeepEqual(names, []string{"math", "area", "r", "total", "x"}) {
+			t.Fatalf("got %v", names)
+		}
+		area := symbols[1]
+		if area.Kind != lsp.SymbolFunction || area.Detail != "fn area(radius)" ||
+			area.Range != (lsp.Range{Start: lsp.Position{Line: 1}, End: lsp.Position{Line: 3, Character: 1}}) ||
+			area.SelectionRange.Start != (lsp.Position{Line: 1, Character: 3}) {
+			t.Errorf("got %+v", area)
+		}
+	})
+
+	t.Run("formatting", func(t *testing.T) {
+		open(c, "x=1\nif x {print(x)}\n", 4)
+		var edits []lsp.TextEdit
+		decode(t, c.request("textDocument/formatting", document()), &edits)
+		want := []lsp.TextEdit{{
+			Range:   lsp.Range{End: lsp.Position{Line: 2}},
+			NewText: "x = 1\nif x {\n  print(x)\n}\n",
+		}}
+		if !reflect.DeepEqual(edits, want) {
+			t.Errorf("got %v, want %v", edits, want)
+		}
+	})
+
+	c.nextID++
+	c.send(map[string]interface{}{"id": c.nextID, "method": "textDocument/unknown", "params": document()})
+	if message := c.receive(); message["error"] == nil {
+		t.Errorf("unknown method: got %v", message)
+	}
+
+	c.request("shutdown", nil)
+	c.notify("exit", nil)
+	if err := <-c.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServer_MessageTooLarge(t *testing.T) {
+	c := newClient(t)
+	if _, err := fmt.Fprintf(c.in, "Content-Length: %d\r\n\r\n", 1<<40); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-c.done; err == nil || !strings.Contains(err.Error(), "exceeds the limit") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,455 @@
+package quark
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// BuiltinMethod implements a method of a builtin type, self is the object
+// the method was looked up on.
+type BuiltinMethod func(ctx *Context, self Object, args []Object) (Object, error)
+
+type Method struct {
+	Fn            BuiltinMethod
+	MinParameters int
+	MaxParameters int
+}
+
+// MethodTable maps method names to their implementations. The tables of
+// the builtin types are exported so that embedders can extend them.
+type MethodTable map[string]*Method
+
+// Bind looks up a method and binds it to self, the result is a builtin
+// function that can be called like any other callable object.
+func (t MethodTable) Bind(self Object, name string) (*BuiltinFunctionObject, bool) {
+	method, ok := t[name]
+	if !ok {
+		return nil, false
+	}
+	numParameters := method.MinParameters
+	if method.MinParameters != method.MaxParameters {
+		numParameters = VariadicParameters
+	}
+	fn := func(ctx *Context, args []Object) (Object, error) {
+		if len(args) < method.MinParameters || len(args) > method.MaxParameters {
+			return nil, ErrWrongNumberArguments
+		}
+		return method.Fn(ctx, self, args)
+	}
+	return NewBuiltinFunction(self.TypeName()+"."+name, fn, numParameters), true
+}
+
+var StringMethods = MethodTable{
+	"upper":      {Fn: _string_upper, MinParameters: 0, MaxParameters: 0},
+	"lower":      {Fn: _string_lower, MinParameters: 0, MaxParameters: 0},
+	"split":      {Fn: _string_split, MinParameters: 0, MaxParameters: 1},
+	"join":       {Fn: _string_join, MinParameters: 1, MaxParameters: 1},
+	"trim":       {Fn: _string_trim, MinParameters: 0, MaxParameters: 1},
+	"trimLeft":   {Fn: _string_trimLeft, MinParameters: 0, MaxParameters: 1},
+	"trimRight":  {Fn: _string_trimRight, MinParameters: 0, MaxParameters: 1},
+	"replace":    {Fn: _string_replace, MinParameters: 2, MaxParameters: 3},
+	"find":       {Fn: _string_find, MinParameters: 1, MaxParameters: 1},
+	"contains":   {Fn: _string_contains, MinParameters: 1, MaxParameters: 1},
+	"startsWith": {Fn: _string_startsWith, MinParameters: 1, MaxParameters: 1},
+	"endsWith":   {Fn: _string_endsWith, MinParameters: 1, MaxParameters: 1},
+	"repeat":     {Fn: _string_repeat, MinParameters: 1, MaxParameters: 1},
+	"encode":     {Fn: _string_encode, MinParameters: 0, MaxParameters: 0},
+}
+
+var BytesMethods = MethodTable{
+	"decode": {Fn: _bytes_decode, MinParameters: 0, MaxParameters: 0},
+	"hex":    {Fn: _bytes_hex, MinParameters: 0, MaxParameters: 0},
+}
+
+var ListMethods = MethodTable{
+	"push":     {Fn: _list_push, MinParameters: 1, MaxParameters: 1},
+	"pop":      {Fn: _list_pop, MinParameters: 0, MaxParameters: 1},
+	"insert":   {Fn: _list_insert, MinParameters: 2, MaxParameters: 2},
+	"remove":   {Fn: _list_remove, MinParameters: 1, MaxParameters: 1},
+	"index":    {Fn: _list_index, MinParameters: 1, MaxParameters: 1},
+	"contains": {Fn: _list_contains, MinParameters: 1, MaxParameters: 1},
+	"sort":     {Fn: _list_sort, MinParameters: 0, MaxParameters: 0},
+	"reverse":  {Fn: _list_reverse, MinParameters: 0, MaxParameters: 0},
+	"clear":    {Fn: _list_clear, MinParameters: 0, MaxParameters: 0},
+}
+
+// Dict keys take precedence over these methods when accessed as attributes.
+var DictMethods = MethodTable{
+	"keys":     {Fn: _dict_keys, MinParameters: 0, MaxParameters: 0},
+	"values":   {Fn: _dict_values, MinParameters: 0, MaxParameters: 0},
+	"items":    {Fn: _dict_items, MinParameters: 0, MaxParameters: 0},
+	"get":      {Fn: _dict_get, MinParameters: 1, MaxParameters: 2},
+	"pop":      {Fn: _dict_pop, MinParameters: 1, MaxParameters: 2},
+	"merge":    {Fn: _dict_merge, MinParameters: 1, MaxParameters: 1},
+	"contains": {Fn: _dict_contains, MinParameters: 1, MaxParameters: 1},
+	"clear":    {Fn: _dict_clear, MinParameters: 0, MaxParameters: 0},
+}
+
+func stringArgument(args []Object, index int, name string) (string, error) {
+	value, ok := args[index].(*StringObject)
+	if !ok {
+		return "", ErrInvalidArgument{
+			Name:     name,
+			Expected: "String",
+			Found:    args[index].TypeName(),
+		}
+	}
+	return value.Value, nil
+}
+
+func intArgument(args []Object, index int, name string) (int64, error) {
+	value, ok := args[index].(*IntObject)
+	if !ok {
+		return 0, ErrInvalidArgument{
+			Name:     name,
+			Expected: "Int",
+			Found:    args[index].TypeName(),
+		}
+	}
+	return value.Value, nil
+}
+
+func _string_upper(ctx *Context, self Object, args []Object) (Object, error) {
+	return NewString(strings.ToUpper(self.(*StringObject).Value)), nil
+}
+
+func _string_lower(ctx *Context, self Object, args []Object) (Object, error) {
+	return NewString(strings.ToLower(self.(*StringObject).Value)), nil
+}
+
+// split without a separator splits around runs of white space.
+func _string_split(ctx *Context, self Object, args []Object) (Object, error) {
+	var parts []string
+	if len(args) == 0 {
+		parts = strings.Fields(self.(*StringObject).Value)
+	} else {
+		sep, err := stringArgument(args, 0, "sep")
+		if err != nil {
+			return nil, err
+		}
+		parts = strings.Split(self.(*StringObject).Value, sep)
+	}
+	result := make([]Object, len(parts))
+	for i, part := range parts {
+		result[i] = NewString(part)
+	}
+	return NewList(result), nil
+}
+
+// join concatenates the elements of a list with the string as separator.
+func _string_join(ctx *Context, self Object, args []Object) (Object, error) {
+	list, ok := args[0].(*ListObject)
+	if !ok {
+		return nil, ErrInvalidArgument{
+			Name:     "list",
+			Expected: "List",
+			Found:    args[0].TypeName(),
+		}
+	}
+	parts := make([]string, len(list.Value))
+	for i, item := range list.Value {
+		parts[i] = item.ToString()
+	}
+	return NewString(strings.Join(parts, self.(*StringObject).Value)), nil
+}
+
+func _string_trim(ctx *Context, self Object, args []Object) (Object, error) {
+	if len(args) == 0 {
+		return NewString(strings.TrimSpace(self.(*StringObject).Value)), nil
+	}
+	cutset, err := stringArgument(args, 0, "cutset")
+	if err != nil {
+		return nil, err
+	}
+	return NewString(strings.Trim(self.(*StringObject).Value, cutset)), nil
+}
+
+func _string_trimLeft(ctx *Context, self Object, args []Object) (Object, error) {
+	cutset := " \t\n\v\f\r"
+	if len(args) > 0 {
+		var err error
+		if cutset, err = stringArgument(args, 0, "cutset"); err != nil {
+			return nil, err
+		}
+	}
+	return NewString(strings.TrimLeft(self.(*StringObject).Value, cutset)), nil
+}
+
+func _string_trimRight(ctx *Context, self Object, args []Object) (Object, error) {
+	cutset := " \t\n\v\f\r"
+	if len(args) > 0 {
+		var err error
+		if cutset, err = stringArgument(args, 0, "cutset"); err != nil {
+			return nil, err
+		}
+	}
+	return NewString(strings.TrimRight(self.(*StringObject).Value, cutset)), nil
+}
+
+// replace(old, new, count?) replaces all occurrences unless count is given.
+func _string_replace(ctx *Context, self Object, args []Object) (Object, error) {
+	old, err := stringArgument(args, 0, "old")
+	if err != nil {
+		return nil, err
+	}
+	new, err := stringArgument(args, 1, "new")
+	if err != nil {
+		return nil, err
+	}
+	count := int64(-1)
+	if len(args) > 2 {
+		if count, err = intArgument(args, 2, "count"); err != nil {
+			return nil, err
+		}
+	}
+	return NewString(strings.Replace(self.(*StringObject).Value, old, new, int(count))), nil
+}
+
+// find returns the rune index of the first occurrence, or -1.
+func _string_find(ctx *Context, self Object, args []Object) (Object, error) {
+	sub, err := stringArgument(args, 0, "sub")
+	if err != nil {
+		return nil, err
+	}
+	value := self.(*StringObject).Value
+	index := strings.Index(value, sub)
+	if index < 0 {
+		return NewInt(-1), nil
+	}
+	return NewInt(int64(utf8.RuneCountInString(value[:index]))), nil
+}
+
+func _string_contains(ctx *Context, self Object, args []Object) (Object, error) {
+	sub, err := stringArgument(args, 0, "sub")
+	if err != nil {
+		return nil, err
+	}
+	return FromBool(strings.Contains(self.(*StringObject).Value, sub)), nil
+}
+
+func _string_startsWith(ctx *Context, self Object, args []Object) (Object, error) {
+	prefix, err := stringArgument(args, 0, "prefix")
+	if err != nil {
+		return nil, err
+	}
+	return FromBool(strings.HasPrefix(self.(*StringObject).Value, prefix)), nil
+}
+
+func _string_endsWith(ctx *Context, self Object, args []Object) (Object, error) {
+	suffix, err := stringArgument(args, 0, "suffix")
+	if err != nil {
+		return nil, err
+	}
+	return FromBool(strings.HasSuffix(self.(*StringObject).Value, suffix)), nil
+}
+
+func _string_repeat(ctx *Context, self Object, args []Object) (Object, error) {
+	count, err := intArgument(args, 0, "count")
+	if err != nil {
+		return nil, err
+	}
+	if count < 0 {
+		return nil, ErrIndexOutOfRange
+	}
+	return NewString(strings.Repeat(self.(*StringObject).Value, int(count))), nil
+}
+
+func _string_encode(ctx *Context, self Object, args []Object) (Object, error) {
+	return _encode(ctx, []Object{self})
+}
+
+func _bytes_decode(ctx *Context, self Object, args []Object) (Object, error) {
+	return _decode(ctx, []Object{self})
+}
+
+func _bytes_hex(ctx *Context, self Object, args []Object) (Object, error) {
+	const hex = "0123456789abcdef"
+	value := self.(*BytesObject).Value
+	result := make([]byte, 0, len(value)*2)
+	for _, b := range value {
+		result = append(result, hex[b>>4], hex[b&0x0f])
+	}
+	return NewString(string(result)), nil
+}
+
+func _list_push(ctx *Context, self Object, args []Object) (Object, error) {
+	list := self.(*ListObject)
+	list.Value = append(list.Value, args[0])
+	return Null, nil
+}
+
+// pop removes and returns the last element, or the one at the given index.
+func _list_pop(ctx *Context, self Object, args []Object) (Object, error) {
+	list := self.(*ListObject)
+	index := int64(len(list.Value) - 1)
+	if len(args) > 0 {
+		var err error
+		if index, err = intArgument(args, 0, "index"); err != nil {
+			return nil, err
+		}
+	}
+	if index < 0 || index >= int64(len(list.Value)) {
+		return nil, ErrIndexOutOfRange
+	}
+	value := list.Value[index]
+	list.Value = append(list.Value[:index], list.Value[index+1:]...)
+	return value, nil
+}
+
+func _list_insert(ctx *Context, self Object, args []Object) (Object, error) {
+	list := self.(*ListObject)
+	index, err := intArgument(args, 0, "index")
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 || index > int64(len(list.Value)) {
+		return nil, ErrIndexOutOfRange
+	}
+	list.Value = append(list.Value, nil)
+	copy(list.Value[index+1:], list.Value[index:])
+	list.Value[index] = args[1]
+	return Null, nil
+}
+
+func listIndex(list *ListObject, value Object) int {
+	for i, item := range list.Value {
+		if Equals(item, value) {
+			return i
+		}
+	}
+	return -1
+}
+
+// remove deletes the first element equal to the argument and reports
+// whether one was found.
+func _list_remove(ctx *Context, self Object, args []Object) (Object, error) {
+	list := self.(*ListObject)
+	index := listIndex(list, args[0])
+	if index < 0 {
+		return False, nil
+	}
+	list.Value = append(list.Value[:index], list.Value[index+1:]...)
+	return True, nil
+}
+
+func _list_index(ctx *Context, self Object, args []Object) (Object, error) {
+	return NewInt(int64(listIndex(self.(*ListObject), args[0]))), nil
+}
+
+func _list_contains(ctx *Context, self Object, args []Object) (Object, error) {
+	return FromBool(listIndex(self.(*ListObject), args[0]) >= 0), nil
+}
+
+// sort orders the list in place, see Compare for the order used.
+func _list_sort(ctx *Context, self Object, args []Object) (Object, error) {
+	list := self.(*ListObject)
+	sort.SliceStable(list.Value, func(i, j int) bool {
+		return Compare(list.Value[i], list.Value[j]) < 0
+	})
+	return Null, nil
+}
+
+func _list_reverse(ctx *Context, self Object, args []Object) (Object, error) {
+	list := self.(*ListObject)
+	for i, j := 0, len(list.Value)-1; i < j; i, j = i+1, j-1 {
+		list.Value[i], list.Value[j] = list.Value[j], list.Value[i]
+	}
+	return Null, nil
+}
+
+func _list_clear(ctx *Context, self Object, args []Object) (Object, error) {
+	self.(*ListObject).Value = []Object{}
+	return Null, nil
+}
+
+func sortedKeys(dict *DictObject) []string {
+	keys := make([]string, 0, len(dict.Value))
+	for key := range dict.Value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// keys, values and items are all ordered by key.
+func _dict_keys(ctx *Context, self Object, args []Object) (Object, error) {
+	keys := sortedKeys(self.(*DictObject))
+	result := make([]Object, len(keys))
+	for i, key := range keys {
+		result[i] = NewString(key)
+	}
+	return NewList(result), nil
+}
+
+func _dict_values(ctx *Context, self Object, args []Object) (Object, error) {
+	dict := self.(*DictObject)
+	keys := sortedKeys(dict)
+	result := make([]Object, len(keys))
+	for i, key := range keys {
+		result[i] = dict.Value[key]
+	}
+	return NewList(result), nil
+}
+
+func _dict_items(ctx *Context, self Object, args []Object) (Object, error) {
+	dict := self.(*DictObject)
+	keys := sortedKeys(dict)
+	result := make([]Object, len(keys))
+	for i, key := range keys {
+		result[i] = NewList([]Object{NewString(key), dict.Value[key]})
+	}
+	return NewList(result), nil
+}
+
+// get(key, default?) returns default, or null, for missing keys.
+func _dict_get(ctx *Context, self Object, args []Object) (Object, error) {
+	if value, ok := self.(*DictObject).Value[args[0].ToString()]; ok {
+		return value, nil
+	}
+	if len(args) > 1 {
+		return args[1], nil
+	}
+	return Null, nil
+}
+
+// pop(key, default?) removes the key and returns its value.
+func _dict_pop(ctx *Context, self Object, args []Object) (Object, error) {
+	dict := self.(*DictObject)
+	key := args[0].ToString()
+	if value, ok := dict.Value[key]; ok {
+		delete(dict.Value, key)
+		return value, nil
+	}
+	if len(args) > 1 {
+		return args[1], nil
+	}
+	return Null, nil
+}
+
+// merge copies all entries of another dict into this one and returns it.
+func _dict_merge(ctx *Context, self Object, args []Object) (Object, error) {
+	other, ok := args[0].(*DictObject)
+	if !ok {
+		return nil, ErrInvalidArgument{
+			Name:     "other",
+			Expected: "Dict",
+			Found:    args[0].TypeName(),
+		}
+	}
+	dict := self.(*DictObject)
+	for key, value := range other.Value {
+		dict.Value[key] = value
+	}
+	return dict, nil
+}
+
+func _dict_contains(ctx *Context, self Object, args []Object) (Object, error) {
+	_, ok := self.(*DictObject).Value[args[0].ToString()]
+	return FromBool(ok), nil
+}
+
+func _dict_clear(ctx *Context, self Object, args []Object) (Object, error) {
+	self.(*DictObject).Value = make(map[string]Object)
+	return Null, nil
+}
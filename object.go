@@ -3,7 +3,9 @@ package quark
 import (
 	"fmt"
 	"hash/fnv"
+	"sort"
 	"strconv"
+	"unicode/utf8"
 )
 
 type Object interface {
@@ -22,6 +24,9 @@ type Object interface {
 	AttributeGet(name string) (Object, error)
 	AttributeSet(name string, value Object) error
 
+	Slice(low, high Object) (Object, error)
+	Iterate() (*IteratorObject, error)
+
 	UnaryBitNot() (Object, error)
 	UnaryNot() (Object, error)
 	UnaryPlus() (Object, error)
@@ -47,47 +52,54 @@ type Object interface {
 	BinaryBitRhs(x Object) (Object, error)
 }
 
+// ObjectImpl provides defaults for every Object method, embed it and
+// override what the type supports. Unsupported operations return
+// ErrNotImplemented, which the VM reports as a TypeError naming the
+// operation and operand types.
 type ObjectImpl struct {
 }
 
-func (o *ObjectImpl) TypeName() string      { panic(ErrNotImplemented) }
-func (o *ObjectImpl) Length() (int, error)  { panic(ErrNotImplemented) }
-func (o *ObjectImpl) Callable() bool        { panic(ErrNotImplemented) }
-func (o *ObjectImpl) HashCode() int         { panic(ErrNotImplemented) }
-func (o *ObjectImpl) Copy() (Object, error) { panic(ErrNotImplemented) }
+func (o *ObjectImpl) TypeName() string      { return "Object" }
+func (o *ObjectImpl) Length() (int, error)  { return 0, ErrNotImplemented }
+func (o *ObjectImpl) Callable() bool        { return false }
+func (o *ObjectImpl) HashCode() int         { return 0 }
+func (o *ObjectImpl) Copy() (Object, error) { return nil, ErrNotImplemented }
+
+func (o *ObjectImpl) ToBool() bool     { return true }
+func (o *ObjectImpl) ToString() string { return "<object>" }
 
-func (o *ObjectImpl) ToBool() bool     { panic(ErrNotImplemented) }
-func (o *ObjectImpl) ToString() string { panic(ErrNotImplemented) }
+func (o *ObjectImpl) IndexGet(index Object) (Object, error) { return nil, ErrNotImplemented }
+func (o *ObjectImpl) IndexSet(index, value Object) error    { return ErrNotImplemented }
 
-func (o *ObjectImpl) IndexGet(index Object) (Object, error) { panic(ErrNotImplemented) }
-func (o *ObjectImpl) IndexSet(index, value Object) error    { panic(ErrNotImplemented) }
+func (o *ObjectImpl) AttributeGet(name string) (Object, error)     { return nil, ErrNotImplemented }
+func (o *ObjectImpl) AttributeSet(name string, value Object) error { return ErrNotImplemented }
 
-func (o *ObjectImpl) AttributeGet(name string) (Object, error)     { panic(ErrNotImplemented) }
-func (o *ObjectImpl) AttributeSet(name string, value Object) error { panic(ErrNotImplemented) }
+func (o *ObjectImpl) Slice(low, high Object) (Object, error) { return nil, ErrNotImplemented }
+func (o *ObjectImpl) Iterate() (*IteratorObject, error)      { return nil, ErrNotImplemented }
 
-func (o *ObjectImpl) UnaryBitNot() (Object, error) { panic(ErrNotImplemented) }
-func (o *ObjectImpl) UnaryNot() (Object, error)    { panic(ErrNotImplemented) }
-func (o *ObjectImpl) UnaryPlus() (Object, error)   { panic(ErrNotImplemented) }
-func (o *ObjectImpl) UnaryMinus() (Object, error)  { panic(ErrNotImplemented) }
+func (o *ObjectImpl) UnaryBitNot() (Object, error) { return nil, ErrNotImplemented }
+func (o *ObjectImpl) UnaryNot() (Object, error)    { return nil, ErrNotImplemented }
+func (o *ObjectImpl) UnaryPlus() (Object, error)   { return nil, ErrNotImplemented }
+func (o *ObjectImpl) UnaryMinus() (Object, error)  { return nil, ErrNotImplemented }
 
-func (o *ObjectImpl) BinaryAdd(x Object) (Object, error) { panic(ErrNotImplemented) }
-func (o *ObjectImpl) BinarySub(x Object) (Object, error) { panic(ErrNotImplemented) }
-func (o *ObjectImpl) BinaryMul(x Object) (Object, error) { panic(ErrNotImplemented) }
-func (o *ObjectImpl) BinaryDiv(x Object) (Object, error) { panic(ErrNotImplemented) }
-func (o *ObjectImpl) BinaryMod(x Object) (Object, error) { panic(ErrNotImplemented) }
+func (o *ObjectImpl) BinaryAdd(x Object) (Object, error) { return nil, ErrNotImplemented }
+func (o *ObjectImpl) BinarySub(x Object) (Object, error) { return nil, ErrNotImplemented }
+func (o *ObjectImpl) BinaryMul(x Object) (Object, error) { return nil, ErrNotImplemented }
+func (o *ObjectImpl) BinaryDiv(x Object) (Object, error) { return nil, ErrNotImplemented }
+func (o *ObjectImpl) BinaryMod(x Object) (Object, error) { return nil, ErrNotImplemented }
 
-func (o *ObjectImpl) BinaryLt(x Object) (Object, error)  { panic(ErrNotImplemented) }
-func (o *ObjectImpl) BinaryLte(x Object) (Object, error) { panic(ErrNotImplemented) }
-func (o *ObjectImpl) BinaryGt(x Object) (Object, error)  { panic(ErrNotImplemented) }
-func (o *ObjectImpl) BinaryGte(x Object) (Object, error) { panic(ErrNotImplemented) }
-func (o *ObjectImpl) BinaryEq(x Object) (Object, error)  { panic(ErrNotImplemented) }
-func (o *ObjectImpl) BinaryNeq(x Object) (Object, error) { panic(ErrNotImplemented) }
+func (o *ObjectImpl) BinaryLt(x Object) (Object, error)  { return nil, ErrNotImplemented }
+func (o *ObjectImpl) BinaryLte(x Object) (Object, error) { return nil, ErrNotImplemented }
+func (o *ObjectImpl) BinaryGt(x Object) (Object, error)  { return nil, ErrNotImplemented }
+func (o *ObjectImpl) BinaryGte(x Object) (Object, error) { return nil, ErrNotImplemented }
+func (o *ObjectImpl) BinaryEq(x Object) (Object, error)  { return nil, ErrNotImplemented }
+func (o *ObjectImpl) BinaryNeq(x Object) (Object, error) { return nil, ErrNotImplemented }
 
-func (o *ObjectImpl) BinaryBitAnd(x Object) (Object, error) { panic(ErrNotImplemented) }
-func (o *ObjectImpl) BinaryBitOr(x Object) (Object, error)  { panic(ErrNotImplemented) }
-func (o *ObjectImpl) BinaryBitXor(x Object) (Object, error) { panic(ErrNotImplemented) }
-func (o *ObjectImpl) BinaryBitLhs(x Object) (Object, error) { panic(ErrNotImplemented) }
-func (o *ObjectImpl) BinaryBitRhs(x Object) (Object, error) { panic(ErrNotImplemented) }
+func (o *ObjectImpl) BinaryBitAnd(x Object) (Object, error) { return nil, ErrNotImplemented }
+func (o *ObjectImpl) BinaryBitOr(x Object) (Object, error)  { return nil, ErrNotImplemented }
+func (o *ObjectImpl) BinaryBitXor(x Object) (Object, error) { return nil, ErrNotImplemented }
+func (o *ObjectImpl) BinaryBitLhs(x Object) (Object, error) { return nil, ErrNotImplemented }
+func (o *ObjectImpl) BinaryBitRhs(x Object) (Object, error) { return nil, ErrNotImplemented }
 
 type NullObject struct {
 	ObjectImpl
@@ -113,6 +125,30 @@ func (o *NullObject) HashCode() int {
 	return 0
 }
 
+func (o *NullObject) BinaryLt(x Object) (Object, error) {
+	return FromBool(Compare(o, x) < 0), nil
+}
+
+func (o *NullObject) BinaryLte(x Object) (Object, error) {
+	return FromBool(Compare(o, x) <= 0), nil
+}
+
+func (o *NullObject) BinaryGt(x Object) (Object, error) {
+	return FromBool(Compare(o, x) > 0), nil
+}
+
+func (o *NullObject) BinaryGte(x Object) (Object, error) {
+	return FromBool(Compare(o, x) >= 0), nil
+}
+
+func (o *NullObject) BinaryEq(x Object) (Object, error) {
+	return FromBool(Equals(o, x)), nil
+}
+
+func (o *NullObject) BinaryNeq(x Object) (Object, error) {
+	return FromBool(!Equals(o, x)), nil
+}
+
 type BoolObject struct {
 	ObjectImpl
 	Value bool
@@ -143,9 +179,28 @@ func (o *BoolObject) HashCode() int {
 	return 0
 }
 
+func (o *BoolObject) BinaryLt(x Object) (Object, error) {
+	return FromBool(Compare(o, x) < 0), nil
+}
+
+func (o *BoolObject) BinaryLte(x Object) (Object, error) {
+	return FromBool(Compare(o, x) <= 0), nil
+}
+
+func (o *BoolObject) BinaryGt(x Object) (Object, error) {
+	return FromBool(Compare(o, x) > 0), nil
+}
+
+func (o *BoolObject) BinaryGte(x Object) (Object, error) {
+	return FromBool(Compare(o, x) >= 0), nil
+}
+
 func (o *BoolObject) BinaryEq(x Object) (Object, error) {
-	value, _ := FromInterface(o == x)
-	return value, nil
+	return FromBool(Equals(o, x)), nil
+}
+
+func (o *BoolObject) BinaryNeq(x Object) (Object, error) {
+	return FromBool(!Equals(o, x)), nil
 }
 
 type IntObject struct {
@@ -177,6 +232,18 @@ func (o *IntObject) HashCode() int {
 	return int(o.Value)
 }
 
+func (o *IntObject) UnaryBitNot() (Object, error) {
+	return NewInt(^o.Value), nil
+}
+
+func (o *IntObject) UnaryPlus() (Object, error) {
+	return o, nil
+}
+
+func (o *IntObject) UnaryMinus() (Object, error) {
+	return NewInt(-o.Value), nil
+}
+
 func (o *IntObject) BinaryAdd(x Object) (Object, error) {
 	switch x := x.(type) {
 	case *IntObject:
@@ -184,7 +251,7 @@ func (o *IntObject) BinaryAdd(x Object) (Object, error) {
 	case *FloatObject:
 		return NewInt(o.Value + int64(x.Value)), nil
 	default:
-		return nil, fmt.Errorf("unsupported operand type(s) for +: '%s' and '%s'", o.TypeName(), x.TypeName())
+		return nil, ErrNotImplemented
 	}
 }
 
@@ -195,7 +262,7 @@ func (o *IntObject) BinarySub(x Object) (Object, error) {
 	case *FloatObject:
 		return NewInt(o.Value - int64(x.Value)), nil
 	default:
-		return nil, fmt.Errorf("unsupported operand type(s) for -: '%s' and '%s'", o.TypeName(), x.TypeName())
+		return nil, ErrNotImplemented
 	}
 }
 
@@ -206,94 +273,61 @@ func (o *IntObject) BinaryMul(x Object) (Object, error) {
 	case *FloatObject:
 		return NewInt(o.Value * int64(x.Value)), nil
 	default:
-		return nil, fmt.Errorf("unsupported operand type(s) for /: '%s' and '%s'", o.TypeName(), x.TypeName())
+		return nil, ErrNotImplemented
 	}
 }
 
 func (o *IntObject) BinaryDiv(x Object) (Object, error) {
 	switch x := x.(type) {
 	case *IntObject:
+		if x.Value == 0 {
+			return nil, ErrDivisionByZero
+		}
 		return NewInt(o.Value / x.Value), nil
 	case *FloatObject:
+		if int64(x.Value) == 0 {
+			return nil, ErrDivisionByZero
+		}
 		return NewInt(o.Value / int64(x.Value)), nil
 	default:
-		return nil, fmt.Errorf("unsupported operand type(s) for *: '%s' and '%s'", o.TypeName(), x.TypeName())
+		return nil, ErrNotImplemented
 	}
 }
 
 func (o *IntObject) BinaryMod(x Object) (Object, error) {
 	switch x := x.(type) {
 	case *IntObject:
+		if x.Value == 0 {
+			return nil, ErrDivisionByZero
+		}
 		return NewInt(o.Value % x.Value), nil
 	default:
-		return nil, fmt.Errorf("unsupported operand type(s) for %%: '%s' and '%s'", o.TypeName(), x.TypeName())
+		return nil, ErrNotImplemented
 	}
 }
 
 func (o *IntObject) BinaryLt(x Object) (Object, error) {
-	switch x := x.(type) {
-	case *IntObject:
-		return FromBool(o.Value < x.Value), nil
-	case *FloatObject:
-		return FromBool(o.Value < int64(x.Value)), nil
-	default:
-		return nil, fmt.Errorf("unsupported operand type(s) for <: '%s' and '%s'", o.TypeName(), x.TypeName())
-	}
+	return FromBool(Compare(o, x) < 0), nil
 }
 
 func (o *IntObject) BinaryLte(x Object) (Object, error) {
-	switch x := x.(type) {
-	case *IntObject:
-		return FromBool(o.Value <= x.Value), nil
-	case *FloatObject:
-		return FromBool(o.Value <= int64(x.Value)), nil
-	default:
-		return nil, fmt.Errorf("unsupported operand type(s) for <=: '%s' and '%s'", o.TypeName(), x.TypeName())
-	}
+	return FromBool(Compare(o, x) <= 0), nil
 }
 
 func (o *IntObject) BinaryGt(x Object) (Object, error) {
-	switch x := x.(type) {
-	case *IntObject:
-		return FromBool(o.Value > x.Value), nil
-	case *FloatObject:
-		return FromBool(o.Value > int64(x.Value)), nil
-	default:
-		return nil, fmt.Errorf("unsupported operand type(s) for >: '%s' and '%s'", o.TypeName(), x.TypeName())
-	}
+	return FromBool(Compare(o, x) > 0), nil
 }
 
 func (o *IntObject) BinaryGte(x Object) (Object, error) {
-	switch x := x.(type) {
-	case *IntObject:
-		return FromBool(o.Value >= x.Value), nil
-	case *FloatObject:
-		return FromBool(o.Value >= int64(x.Value)), nil
-	default:
-		return nil, fmt.Errorf("unsupported operand type(s) for >=: '%s' and '%s'", o.TypeName(), x.TypeName())
-	}
+	return FromBool(Compare(o, x) >= 0), nil
 }
 
 func (o *IntObject) BinaryEq(x Object) (Object, error) {
-	switch x := x.(type) {
-	case *IntObject:
-		return FromBool(o.Value == x.Value), nil
-	case *FloatObject:
-		return FromBool(o.Value == int64(x.Value)), nil
-	default:
-		return nil, fmt.Errorf("unsupported operand type(s) for ==: '%s' and '%s'", o.TypeName(), x.TypeName())
-	}
+	return FromBool(Equals(o, x)), nil
 }
 
 func (o *IntObject) BinaryNeq(x Object) (Object, error) {
-	switch x := x.(type) {
-	case *IntObject:
-		return FromBool(o.Value != x.Value), nil
-	case *FloatObject:
-		return FromBool(o.Value != int64(x.Value)), nil
-	default:
-		return nil, fmt.Errorf("unsupported operand type(s) for !=: '%s' and '%s'", o.TypeName(), x.TypeName())
-	}
+	return FromBool(!Equals(o, x)), nil
 }
 
 var _int_cache map[int64]*IntObject = nil
@@ -325,6 +359,58 @@ func (o *FloatObject) ToString() string {
 	return fmt.Sprintf("%.12f", o.Value)
 }
 
+func (o *FloatObject) TypeName() string {
+	return "Float"
+}
+
+func (o *FloatObject) ToBool() bool {
+	return o.Value != 0
+}
+
+func (o *FloatObject) Copy() (Object, error) {
+	return NewFloat(o.Value), nil
+}
+
+func (o *FloatObject) Callable() bool {
+	return false
+}
+
+func (o *FloatObject) HashCode() int {
+	return floatHashCode(o.Value)
+}
+
+func (o *FloatObject) UnaryPlus() (Object, error) {
+	return o, nil
+}
+
+func (o *FloatObject) UnaryMinus() (Object, error) {
+	return NewFloat(-o.Value), nil
+}
+
+func (o *FloatObject) BinaryLt(x Object) (Object, error) {
+	return FromBool(Compare(o, x) < 0), nil
+}
+
+func (o *FloatObject) BinaryLte(x Object) (Object, error) {
+	return FromBool(Compare(o, x) <= 0), nil
+}
+
+func (o *FloatObject) BinaryGt(x Object) (Object, error) {
+	return FromBool(Compare(o, x) > 0), nil
+}
+
+func (o *FloatObject) BinaryGte(x Object) (Object, error) {
+	return FromBool(Compare(o, x) >= 0), nil
+}
+
+func (o *FloatObject) BinaryEq(x Object) (Object, error) {
+	return FromBool(Equals(o, x)), nil
+}
+
+func (o *FloatObject) BinaryNeq(x Object) (Object, error) {
+	return FromBool(!Equals(o, x)), nil
+}
+
 func NewFloat(value float64) *FloatObject {
 	return &FloatObject{
 		Value: value,
@@ -334,6 +420,7 @@ func NewFloat(value float64) *FloatObject {
 type StringObject struct {
 	ObjectImpl
 	Value string
+	index *runeIndex
 }
 
 func (o *StringObject) TypeName() string {
@@ -344,12 +431,17 @@ func (o *StringObject) ToString() string {
 	return o.Value
 }
 
+func (o *StringObject) ToBool() bool {
+	return len(o.Value) != 0
+}
+
 func (o *StringObject) Copy() (Object, error) {
 	return NewString(o.Value), nil
 }
 
+// Length returns the number of runes, not bytes.
 func (o *StringObject) Length() (int, error) {
-	return len(o.Value), nil
+	return o.runeIndex().length, nil
 }
 
 func (o *StringObject) Callable() bool {
@@ -357,9 +449,7 @@ func (o *StringObject) Callable() bool {
 }
 
 func (o *StringObject) HashCode() int {
-	h := fnv.New32a()
-	h.Write([]byte(o.Value))
-	return int(h.Sum32())
+	return hashString(o.Value)
 }
 
 func (o *StringObject) BinaryAdd(x Object) (Object, error) {
@@ -367,44 +457,236 @@ func (o *StringObject) BinaryAdd(x Object) (Object, error) {
 	case *StringObject:
 		return NewString(o.Value + x.Value), nil
 	default:
-		return nil, fmt.Errorf("unsupported operand type(s) for +: '%s' and '%s'", o.TypeName(), x.TypeName())
+		return nil, ErrNotImplemented
 	}
 }
 
+func (o *StringObject) BinaryLt(x Object) (Object, error) {
+	return FromBool(Compare(o, x) < 0), nil
+}
+
+func (o *StringObject) BinaryLte(x Object) (Object, error) {
+	return FromBool(Compare(o, x) <= 0), nil
+}
+
+func (o *StringObject) BinaryGt(x Object) (Object, error) {
+	return FromBool(Compare(o, x) > 0), nil
+}
+
+func (o *StringObject) BinaryGte(x Object) (Object, error) {
+	return FromBool(Compare(o, x) >= 0), nil
+}
+
 func (o *StringObject) BinaryEq(x Object) (Object, error) {
-	switch x := x.(type) {
-	case *StringObject:
-		return FromBool(o.Value == x.Value), nil
-	default:
-		return nil, fmt.Errorf("unsupported operand type(s) for ==: '%s' and '%s'", o.TypeName(), x.TypeName())
-	}
+	return FromBool(Equals(o, x)), nil
 }
 
 func (o *StringObject) BinaryNeq(x Object) (Object, error) {
+	return FromBool(!Equals(o, x)), nil
+}
+
+func (o *StringObject) IndexGet(index Object) (Object, error) {
+	if index, ok := index.(*IntObject); !ok {
+		return nil, ErrInvalidIndexType
+	} else if index.Value < 0 || index.Value >= int64(o.runeIndex().length) {
+		return nil, ErrIndexOutOfRange
+	} else {
+		offset := o.index.offset(o.Value, int(index.Value))
+		_, size := utf8.DecodeRuneInString(o.Value[offset:])
+		return NewString(o.Value[offset : offset+size]), nil
+	}
+}
+
+func (o *StringObject) AttributeGet(name string) (Object, error) {
+	if method, ok := StringMethods.Bind(o, name); ok {
+		return method, nil
+	}
+	return nil, NewErrUnknownAttribute(o.TypeName(), name)
+}
+
+func (o *StringObject) Slice(low, high Object) (Object, error) {
+	index := o.runeIndex()
+	lo, hi, err := sliceBounds(low, high, index.length)
+	if err != nil {
+		return nil, err
+	}
+	return NewString(o.Value[index.offset(o.Value, lo):index.offset(o.Value, hi)]), nil
+}
+
+func (o *StringObject) Iterate() (*IteratorObject, error) {
+	offset := 0
+	return NewIterator(func() (Object, bool) {
+		if offset >= len(o.Value) {
+			return nil, false
+		}
+		_, size := utf8.DecodeRuneInString(o.Value[offset:])
+		value := NewString(o.Value[offset : offset+size])
+		offset += size
+		return value, true
+	}), nil
+}
+
+// runeIndex is built on first use and reused afterwards, strings are
+// immutable so the index never has to be invalidated.
+func (o *StringObject) runeIndex() *runeIndex {
+	if o.index == nil {
+		o.index = newRuneIndex(o.Value)
+	}
+	return o.index
+}
+
+func NewString(value string) *StringObject {
+	return &StringObject{
+		Value: value,
+	}
+}
+
+type BytesObject struct {
+	ObjectImpl
+	Value []byte
+}
+
+func (o *BytesObject) TypeName() string {
+	return "Bytes"
+}
+
+func (o *BytesObject) ToString() string {
+	return quoteBytes(o.Value)
+}
+
+func (o *BytesObject) ToBool() bool {
+	return len(o.Value) != 0
+}
+
+func (o *BytesObject) Copy() (Object, error) {
+	return NewBytes(append([]byte{}, o.Value...)), nil
+}
+
+func (o *BytesObject) Length() (int, error) {
+	return len(o.Value), nil
+}
+
+func (o *BytesObject) Callable() bool {
+	return false
+}
+
+func (o *BytesObject) HashCode() int {
+	h := fnv.New32a()
+	h.Write(o.Value)
+	return int(h.Sum32())
+}
+
+func (o *BytesObject) BinaryAdd(x Object) (Object, error) {
 	switch x := x.(type) {
-	case *StringObject:
-		return FromBool(o.Value != x.Value), nil
+	case *BytesObject:
+		value := make([]byte, 0, len(o.Value)+len(x.Value))
+		return NewBytes(append(append(value, o.Value...), x.Value...)), nil
 	default:
-		return nil, fmt.Errorf("unsupported operand type(s) for !=: '%s' and '%s'", o.TypeName(), x.TypeName())
+		return nil, ErrNotImplemented
 	}
 }
 
-func (o *StringObject) IndexGet(index Object) (Object, error) {
+func (o *BytesObject) BinaryLt(x Object) (Object, error) {
+	return FromBool(Compare(o, x) < 0), nil
+}
+
+func (o *BytesObject) BinaryLte(x Object) (Object, error) {
+	return FromBool(Compare(o, x) <= 0), nil
+}
+
+func (o *BytesObject) BinaryGt(x Object) (Object, error) {
+	return FromBool(Compare(o, x) > 0), nil
+}
+
+func (o *BytesObject) BinaryGte(x Object) (Object, error) {
+	return FromBool(Compare(o, x) >= 0), nil
+}
+
+func (o *BytesObject) BinaryEq(x Object) (Object, error) {
+	return FromBool(Equals(o, x)), nil
+}
+
+func (o *BytesObject) BinaryNeq(x Object) (Object, error) {
+	return FromBool(!Equals(o, x)), nil
+}
+
+func (o *BytesObject) IndexGet(index Object) (Object, error) {
 	if index, ok := index.(*IntObject); !ok {
 		return nil, ErrInvalidIndexType
 	} else if index.Value < 0 || int(index.Value) >= len(o.Value) {
 		return nil, ErrIndexOutOfRange
 	} else {
-		return NewString(string(o.Value[index.Value])), nil
+		return NewInt(int64(o.Value[index.Value])), nil
 	}
 }
 
-func NewString(value string) *StringObject {
-	return &StringObject{
+func (o *BytesObject) IndexSet(index, value Object) error {
+	if index, ok := index.(*IntObject); !ok {
+		return ErrInvalidIndexType
+	} else if index.Value < 0 || int(index.Value) >= len(o.Value) {
+		return ErrIndexOutOfRange
+	} else if value, ok := value.(*IntObject); !ok || value.Value < 0 || value.Value > 255 {
+		return ErrInvalidByteValue
+	} else {
+		o.Value[index.Value] = byte(value.Value)
+		return nil
+	}
+}
+
+func (o *BytesObject) AttributeGet(name string) (Object, error) {
+	if method, ok := BytesMethods.Bind(o, name); ok {
+		return method, nil
+	}
+	return nil, NewErrUnknownAttribute(o.TypeName(), name)
+}
+
+func (o *BytesObject) Slice(low, high Object) (Object, error) {
+	lo, hi, err := sliceBounds(low, high, len(o.Value))
+	if err != nil {
+		return nil, err
+	}
+	return NewBytes(append([]byte{}, o.Value[lo:hi]...)), nil
+}
+
+func (o *BytesObject) Iterate() (*IteratorObject, error) {
+	index := 0
+	return NewIterator(func() (Object, bool) {
+		if index >= len(o.Value) {
+			return nil, false
+		}
+		index++
+		return NewInt(int64(o.Value[index-1])), true
+	}), nil
+}
+
+func NewBytes(value []byte) *BytesObject {
+	return &BytesObject{
 		Value: value,
 	}
 }
 
+func quoteBytes(value []byte) string {
+	const hex = "0123456789abcdef"
+	result := []byte{'b', '"'}
+	for _, b := range value {
+		switch {
+		case b == '"' || b == '\\':
+			result = append(result, '\\', b)
+		case b == '\n':
+			result = append(result, '\\', 'n')
+		case b == '\r':
+			result = append(result, '\\', 'r')
+		case b == '\t':
+			result = append(result, '\\', 't')
+		case b >= 0x20 && b < 0x7f:
+			result = append(result, b)
+		default:
+			result = append(result, '\\', 'x', hex[b>>4], hex[b&0x0f])
+		}
+	}
+	return string(append(result, '"'))
+}
+
 type ListObject struct {
 	ObjectImpl
 	Value []Object
@@ -415,14 +697,56 @@ func (o *ListObject) TypeName() string {
 }
 
 func (o *ListObject) ToString() string {
-	result := "["
-	for i, obj := range o.Value {
-		result += obj.ToString()
-		if i < len(o.Value)-1 {
-			result += ", "
+	return toString(o, nil)
+}
+
+// toString formats obj, a list or dict containing itself shows [...] or
+// {...} where it repeats. seen holds the containers being formatted.
+func toString(obj Object, seen map[Object]bool) string {
+	switch obj := obj.(type) {
+	case *ListObject:
+		if seen[obj] {
+			return "[...]"
+		}
+		if seen == nil {
+			seen = make(map[Object]bool)
+		}
+		seen[obj] = true
+		defer delete(seen, obj)
+		result := "["
+		for i, value := range obj.Value {
+			result += toString(value, seen)
+			if i < len(obj.Value)-1 {
+				result += ", "
+			}
+		}
+		return result + "]"
+	case *DictObject:
+		if len(obj.Value) == 0 {
+			return "{}"
+		}
+		if seen[obj] {
+			return "{...}"
 		}
+		if seen == nil {
+			seen = make(map[Object]bool)
+		}
+		seen[obj] = true
+		defer delete(seen, obj)
+		result := "{ "
+		index := 0
+		for key, value := range obj.Value {
+			result += key + ": "
+			result += toString(value, seen)
+			if index < len(obj.Value)-1 {
+				result += ", "
+			}
+			index++
+		}
+		return result + " }"
+	default:
+		return obj.ToString()
 	}
-	return result + "]"
 }
 
 func (o *ListObject) Length() (int, error) {
@@ -434,13 +758,41 @@ func (o *ListObject) ToBool() bool {
 }
 
 func (o *ListObject) Copy() (Object, error) {
-	return NewList(o.Value), nil
+	return NewList(append([]Object{}, o.Value...)), nil
 }
 
 func (o *ListObject) Callable() bool {
 	return false
 }
 
+func (o *ListObject) HashCode() int {
+	return hashCode(o, 0)
+}
+
+func (o *ListObject) BinaryLt(x Object) (Object, error) {
+	return FromBool(Compare(o, x) < 0), nil
+}
+
+func (o *ListObject) BinaryLte(x Object) (Object, error) {
+	return FromBool(Compare(o, x) <= 0), nil
+}
+
+func (o *ListObject) BinaryGt(x Object) (Object, error) {
+	return FromBool(Compare(o, x) > 0), nil
+}
+
+func (o *ListObject) BinaryGte(x Object) (Object, error) {
+	return FromBool(Compare(o, x) >= 0), nil
+}
+
+func (o *ListObject) BinaryEq(x Object) (Object, error) {
+	return FromBool(Equals(o, x)), nil
+}
+
+func (o *ListObject) BinaryNeq(x Object) (Object, error) {
+	return FromBool(!Equals(o, x)), nil
+}
+
 func (o *ListObject) IndexGet(index Object) (Object, error) {
 	if index, ok := index.(*IntObject); !ok {
 		return nil, ErrInvalidIndexType
@@ -462,6 +814,32 @@ func (o *ListObject) IndexSet(index, value Object) error {
 	}
 }
 
+func (o *ListObject) AttributeGet(name string) (Object, error) {
+	if method, ok := ListMethods.Bind(o, name); ok {
+		return method, nil
+	}
+	return nil, NewErrUnknownAttribute(o.TypeName(), name)
+}
+
+func (o *ListObject) Slice(low, high Object) (Object, error) {
+	lo, hi, err := sliceBounds(low, high, len(o.Value))
+	if err != nil {
+		return nil, err
+	}
+	return NewList(append([]Object{}, o.Value[lo:hi]...)), nil
+}
+
+func (o *ListObject) Iterate() (*IteratorObject, error) {
+	index := 0
+	return NewIterator(func() (Object, bool) {
+		if index >= len(o.Value) {
+			return nil, false
+		}
+		index++
+		return o.Value[index-1], true
+	}), nil
+}
+
 func NewList(value []Object) *ListObject {
 	return &ListObject{
 		Value: value,
@@ -478,20 +856,7 @@ func (o *DictObject) TypeName() string {
 }
 
 func (o *DictObject) ToString() string {
-	if len(o.Value) == 0 {
-		return "{}"
-	}
-	result := "{ "
-	index := 0
-	for key, value := range o.Value {
-		result += key + ": "
-		result += value.ToString()
-		if index < len(o.Value)-1 {
-			result += ", "
-		}
-		index++
-	}
-	return result + " }"
+	return toString(o, nil)
 }
 
 func (o *DictObject) Length() (int, error) {
@@ -502,6 +867,46 @@ func (o *DictObject) ToBool() bool {
 	return len(o.Value) != 0
 }
 
+func (o *DictObject) Copy() (Object, error) {
+	value := make(map[string]Object, len(o.Value))
+	for key, item := range o.Value {
+		value[key] = item
+	}
+	return NewDict(value), nil
+}
+
+func (o *DictObject) Callable() bool {
+	return false
+}
+
+func (o *DictObject) HashCode() int {
+	return hashCode(o, 0)
+}
+
+func (o *DictObject) BinaryLt(x Object) (Object, error) {
+	return FromBool(Compare(o, x) < 0), nil
+}
+
+func (o *DictObject) BinaryLte(x Object) (Object, error) {
+	return FromBool(Compare(o, x) <= 0), nil
+}
+
+func (o *DictObject) BinaryGt(x Object) (Object, error) {
+	return FromBool(Compare(o, x) > 0), nil
+}
+
+func (o *DictObject) BinaryGte(x Object) (Object, error) {
+	return FromBool(Compare(o, x) >= 0), nil
+}
+
+func (o *DictObject) BinaryEq(x Object) (Object, error) {
+	return FromBool(Equals(o, x)), nil
+}
+
+func (o *DictObject) BinaryNeq(x Object) (Object, error) {
+	return FromBool(!Equals(o, x)), nil
+}
+
 func (o *DictObject) IndexGet(index Object) (Object, error) {
 	key, err := ToString(index)
 	if err != nil {
@@ -529,6 +934,8 @@ func (o *DictObject) AttributeGet(name string) (Object, error) {
 	}
 	if value, ok := o.Value[name]; ok {
 		return value, nil
+	} else if method, ok := DictMethods.Bind(o, name); ok {
+		return method, nil
 	} else {
 		return Null, nil
 	}
@@ -542,6 +949,23 @@ func (o *DictObject) AttributeSet(name string, value Object) error {
 	return nil
 }
 
+// Iterate walks over a snapshot of the keys in sorted order.
+func (o *DictObject) Iterate() (*IteratorObject, error) {
+	keys := make([]string, 0, len(o.Value))
+	for key := range o.Value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	index := 0
+	return NewIterator(func() (Object, bool) {
+		if index >= len(keys) {
+			return nil, false
+		}
+		index++
+		return NewString(keys[index-1]), true
+	}), nil
+}
+
 func NewDict(value map[string]Object) *DictObject {
 	return &DictObject{
 		Value: value,
@@ -571,6 +995,18 @@ func (o *BuiltinFunctionObject) Callable() bool {
 	return true
 }
 
+func (o *BuiltinFunctionObject) HashCode() int {
+	return hashIdentity(o)
+}
+
+func (o *BuiltinFunctionObject) BinaryEq(x Object) (Object, error) {
+	return FromBool(Equals(o, x)), nil
+}
+
+func (o *BuiltinFunctionObject) BinaryNeq(x Object) (Object, error) {
+	return FromBool(!Equals(o, x)), nil
+}
+
 func NewBuiltinFunction(name string, fn CallableFunction, numParameters int) *BuiltinFunctionObject {
 	return &BuiltinFunctionObject{
 		Name:          name,
@@ -583,8 +1019,16 @@ type CompiledFunctionObject struct {
 	ObjectImpl
 	Name           string
 	Instructions   []Instruction
+	Constants      []Object // shared by the functions compiled together
 	ParameterNames []string
 	SymbolTable    *SymbolTable
+	Filename       string
+	Lines          LineTable
+
+	source   []string      // lines of the source, nil for bytecode loaded without it
+	code     []instruction // while it is being compiled
+	verified bool          // by Context.Verify
+	maxDepth int           // of the operands above the locals, set by Context.Verify
 }
 
 func (o *CompiledFunctionObject) TypeName() string {
@@ -599,8 +1043,13 @@ func (o *CompiledFunctionObject) Copy() (Object, error) {
 	return &CompiledFunctionObject{
 		Name:           o.Name,
 		Instructions:   o.Instructions,
+		Constants:      o.Constants,
 		ParameterNames: o.ParameterNames,
 		SymbolTable:    o.SymbolTable,
+		Filename:       o.Filename,
+		Lines:          o.Lines,
+		verified:       o.verified,
+		maxDepth:       o.maxDepth,
 	}, nil
 }
 
@@ -608,6 +1057,18 @@ func (o *CompiledFunctionObject) Callable() bool {
 	return true
 }
 
+func (o *CompiledFunctionObject) HashCode() int {
+	return hashIdentity(o)
+}
+
+func (o *CompiledFunctionObject) BinaryEq(x Object) (Object, error) {
+	return FromBool(Equals(o, x)), nil
+}
+
+func (o *CompiledFunctionObject) BinaryNeq(x Object) (Object, error) {
+	return FromBool(!Equals(o, x)), nil
+}
+
 type ClosureObject struct {
 	ObjectImpl
 	Fn     *CompiledFunctionObject
@@ -633,6 +1094,67 @@ func (o *ClosureObject) Callable() bool {
 	return true
 }
 
+func (o *ClosureObject) HashCode() int {
+	return hashIdentity(o)
+}
+
+func (o *ClosureObject) BinaryEq(x Object) (Object, error) {
+	return FromBool(Equals(o, x)), nil
+}
+
+func (o *ClosureObject) BinaryNeq(x Object) (Object, error) {
+	return FromBool(!Equals(o, x)), nil
+}
+
+type IteratorObject struct {
+	ObjectImpl
+	next func() (Object, bool)
+}
+
+func (o *IteratorObject) TypeName() string {
+	return "Iterator"
+}
+
+func (o *IteratorObject) ToString() string {
+	return "<iterator>"
+}
+
+func (o *IteratorObject) ToBool() bool {
+	return true
+}
+
+func (o *IteratorObject) Callable() bool {
+	return false
+}
+
+func (o *IteratorObject) HashCode() int {
+	return hashIdentity(o)
+}
+
+func (o *IteratorObject) BinaryEq(x Object) (Object, error) {
+	return FromBool(Equals(o, x)), nil
+}
+
+func (o *IteratorObject) BinaryNeq(x Object) (Object, error) {
+	return FromBool(!Equals(o, x)), nil
+}
+
+func (o *IteratorObject) Iterate() (*IteratorObject, error) {
+	return o, nil
+}
+
+// Next returns the next value, the second result is false once the
+// iterator is exhausted.
+func (o *IteratorObject) Next() (Object, bool) {
+	return o.next()
+}
+
+func NewIterator(next func() (Object, bool)) *IteratorObject {
+	return &IteratorObject{
+		next: next,
+	}
+}
+
 type ObjectRef struct {
 	ObjectImpl
 	Value Object
@@ -0,0 +1,318 @@
+package quark
+
+import (
+	"math"
+
+	"github.com/janqx/quark-lang/v1/ast"
+	"github.com/janqx/quark-lang/v1/tokenize"
+)
+
+type OptimizationLevel uint8
+
+const (
+	OptimizeNone OptimizationLevel = iota
+	// OptimizeBasic folds constant expressions and doesn't compile code
+	// that can never run.
+	OptimizeBasic
+	// OptimizeFull also removes OpNops, threads jumps to jumps and fuses
+	// common sequences into superinstructions.
+	OptimizeFull
+)
+
+const DefaultOptimizationLevel = OptimizeFull
+
+// evaluate computes the value of a constant expression at compile time,
+// ok is false if the expression isn't constant or fails, failures are
+// left to the VM so they are reported at runtime as before.
+func (c *Compiler) evaluate(node ast.Expression) (result Object, ok bool) {
+	switch node := node.(type) {
+	case *ast.NullLiteralExpression:
+		return Null, true
+	case *ast.TrueLiteralExpression:
+		return True, true
+	case *ast.FalseLiteralExpression:
+		return False, true
+	case *ast.IntLiteralExpression:
+		return NewInt(node.Value), true
+	case *ast.FloatLiteralExpression:
+		return NewFloat(node.Value), true
+	case *ast.StringLiteralExpression:
+		return NewString(node.Value), true
+	case *ast.BytesLiteralExpression:
+		return NewBytes(node.Value), true
+	case *ast.UnaryExpression:
+		x, ok := c.evaluate(node.Expression)
+		if !ok {
+			return nil, false
+		}
+		result, err := unaryOp(unaryOpcode(node.Op), x)
+		return result, err == nil
+	case *ast.BinaryExpression:
+		// identity depends on how the operands are stored
+		if node.Op == tokenize.TokenIs {
+			return nil, false
+		}
+		left, ok := c.evaluate(node.Left)
+		if !ok {
+			return nil, false
+		}
+		switch node.Op {
+		case tokenize.TokenLogicAnd:
+			if !left.ToBool() {
+				return left, true
+			}
+			return c.evaluate(node.Right)
+		case tokenize.TokenLogicOr:
+			if left.ToBool() {
+				return left, true
+			}
+			return c.evaluate(node.Right)
+		}
+		right, ok := c.evaluate(node.Right)
+		if !ok {
+			return nil, false
+		}
+		result, err := binaryOp(binaryOpcode(node.Op), left, right)
+		return result, err == nil
+	case *ast.TernaryExpression:
+		cond, ok := c.evaluate(node.Cond)
+		if !ok {
+			return nil, false
+		}
+		if cond.ToBool() {
+			return c.evaluate(node.X)
+		}
+		return c.evaluate(node.Y)
+	default:
+		return nil, false
+	}
+}
+
+// emitConstant loads value, it reports false for values that can't be
+// stored in the constant pool.
+func (c *Compiler) emitConstant(value Object) bool {
+	switch value := value.(type) {
+	case *NullObject:
+		c.emit1(OpLoadNull)
+	case *BoolObject:
+		if value.Value {
+			c.emit1(OpLoadTrue)
+		} else {
+			c.emit1(OpLoadFalse)
+		}
+	case *IntObject:
+		c.emit2(OpLoadConst, Operand(c.constants.addInt(value.Value)))
+	case *FloatObject:
+		// the pool can't tell -0.0 from 0.0
+		if value.Value == 0 && math.Signbit(value.Value) {
+			return false
+		}
+		c.emit2(OpLoadConst, Operand(c.constants.addFloat(value.Value)))
+	case *StringObject:
+		c.emit2(OpLoadConst, Operand(c.constants.addString(value.Value)))
+	case *BytesObject:
+		// like a literal, every evaluation gets its own copy
+		c.emit2(OpLoadConst, Operand(c.constants.addBytes(value.Value)))
+		c.emit1(OpCopy)
+	default:
+		return false
+	}
+	return true
+}
+
+// foldConstant loads the value of node if it is a constant expression.
+func (c *Compiler) foldConstant(node ast.Expression) bool {
+	if c.OptimizationLevel < OptimizeBasic {
+		return false
+	}
+	value, ok := c.evaluate(node)
+	return ok && c.emitConstant(value)
+}
+
+// constantCondition reports whether cond is constant and its truth value.
+func (c *Compiler) constantCondition(cond ast.Expression) (value bool, ok bool) {
+	if c.OptimizationLevel < OptimizeBasic {
+		return false, false
+	}
+	result, ok := c.evaluate(cond)
+	if !ok {
+		return false, false
+	}
+	return result.ToBool(), true
+}
+
+// pruneBranches drops the branches of an if statement that can never be
+// taken, the first branch that is always taken becomes the else branch.
+// result is nil when no conditional branch is left, then only the else
+// branch, which may be nil, has to be compiled.
+func (c *Compiler) pruneBranches(node *ast.IfStatement) (result *ast.IfStatement, elseBody ast.Statement) {
+	branches := append([]ast.Elif{{Condition: node.Condition, Body: node.ThenBody}}, node.Elifs...)
+	elseBody = node.ElseBody
+	kept := make([]ast.Elif, 0, len(branches))
+	for _, branch := range branches {
+		if value, ok := c.constantCondition(branch.Condition); ok {
+			if value {
+				elseBody = branch.Body
+				break
+			}
+			continue
+		}
+		kept = append(kept, branch)
+	}
+	if len(kept) == 0 {
+		return nil, elseBody
+	}
+	result = &ast.IfStatement{
+		Condition: kept[0].Condition,
+		ThenBody:  kept[0].Body,
+		Elifs:     kept[1:],
+		ElseBody:  elseBody,
+	}
+	result.SetPosition(node.Start(), node.End())
+	return result, elseBody
+}
+
+func isJump(opcode Opcode) bool {
+	switch opcode {
+	case OpJump, OpJumpIfFalse, OpJumpIfFalseOrPop, OpJumpIfTrueOrPop, OpIterNext:
+		return true
+	default:
+		return false
+	}
+}
+
+// optimizeInstructions threads jumps whose target is a jump or OpNop to
+// their final target, then removes OpNops, jumps to the next instruction
+// and instructions that can't be reached.
+func optimizeInstructions(fn *CompiledFunctionObject) {
+	code := fn.code
+	for i, inst := range code {
+		if isJump(inst.opcode) {
+			code[i].operand = Operand(finalTarget(code, int(inst.operand)))
+		}
+	}
+
+	reachable := reachableInstructions(code)
+	removed := make([]bool, len(code))
+	for i, inst := range code {
+		if !reachable[i] {
+			removed[i] = true
+			continue
+		}
+		switch inst.opcode {
+		case OpNop:
+			removed[i] = true
+		case OpJump:
+			target := int(inst.operand)
+			removed[i] = target > i
+			for k := i + 1; k < target && removed[i]; k++ {
+				removed[i] = code[k].opcode == OpNop || !reachable[k]
+			}
+		}
+	}
+
+	// newIndex maps an instruction to its index once the removed ones are
+	// gone, a removed instruction maps to the next one that is kept
+	newIndex := make([]int, len(code)+1)
+	result := make([]instruction, 0, len(code))
+	for i, inst := range code {
+		newIndex[i] = len(result)
+		if !removed[i] {
+			result = append(result, inst)
+		}
+	}
+	newIndex[len(code)] = len(result)
+
+	for i, inst := range result {
+		if isJump(inst.opcode) {
+			result[i].operand = Operand(newIndex[inst.operand])
+		}
+	}
+	fn.code = result
+	fn.Lines.remap(newIndex)
+}
+
+func reachableInstructions(code []instruction) []bool {
+	reachable := make([]bool, len(code))
+	pending := []int{0}
+	for len(pending) > 0 {
+		i := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		for ; i < len(code) && !reachable[i]; i++ {
+			reachable[i] = true
+			inst := code[i]
+			if isJump(inst.opcode) {
+				pending = append(pending, int(inst.operand))
+			}
+			if op := inst.opcode; op == OpJump || op == OpReturn || op == OpExport {
+				break
+			}
+		}
+	}
+	return reachable
+}
+
+// finalTarget follows unconditional jumps and OpNops from target, a jump
+// cycle, i.e. an empty infinite loop, stops the search.
+func finalTarget(code []instruction, target int) int {
+	for steps := 0; target < len(code) && steps < len(code); steps++ {
+		switch inst := code[target]; inst.opcode {
+		case OpNop:
+			target++
+		case OpJump:
+			target = int(inst.operand)
+		default:
+			return target
+		}
+	}
+	return target
+}
+
+func isComparison(opcode Opcode) bool {
+	switch opcode {
+	case OpBinaryLT, OpBinaryLTE, OpBinaryGT, OpBinaryGTE, OpBinaryEQ, OpBinaryNEQ:
+		return true
+	default:
+		return false
+	}
+}
+
+func isBinary(opcode Opcode) bool {
+	return opcode >= OpBinaryAdd && opcode <= OpBinaryBitRhs
+}
+
+// fuseInstructions replaces the first instruction of common sequences by
+// a superinstruction. The rest of a sequence is left untouched, so a jump
+// into its middle still runs the original instructions. It runs on the
+// assembled instructions, a sequence with extended operands isn't fused.
+func fuseInstructions(fn *CompiledFunctionObject) {
+	code := fn.Instructions
+	opcode := func(i int) Opcode {
+		if i < len(code) {
+			return code[i].Opcode()
+		}
+		return OpNop
+	}
+	for i := 0; i < len(code); i++ {
+		if opcode(i) != OpLoadLocal || (i > 0 && opcode(i-1) == OpExtendedArg) {
+			continue
+		}
+		var fused Opcode
+		length := 0
+		switch {
+		case opcode(i+1) == OpLoadConst && opcode(i+2) == OpBinaryAdd &&
+			opcode(i+3) == OpStoreLocal && code[i+3].Operand() == code[i].Operand():
+			fused, length = OpIncLocalConst, 4
+		case opcode(i+1) == OpLoadConst && isComparison(opcode(i+2)) && opcode(i+3) == OpJumpIfFalse:
+			fused, length = OpCompareLocalConstJump, 4
+		case opcode(i+1) == OpLoadLocal && isComparison(opcode(i+2)) && opcode(i+3) == OpJumpIfFalse:
+			fused, length = OpCompareLocalsJump, 4
+		case opcode(i+1) == OpLoadConst && isBinary(opcode(i+2)):
+			fused, length = OpBinaryLocalConst, 3
+		default:
+			continue
+		}
+		code[i] = NewInstruction(fused, code[i].Operand())
+		i += length - 1
+	}
+}
@@ -0,0 +1,95 @@
+package quark
+
+import (
+	"testing"
+
+	"github.com/janqx/quark-lang/v1/parser"
+)
+
+func compileString(t *testing.T, level OptimizationLevel, source string) *compiled {
+	ctx := NewContext(ModeNormal, nil)
+	ctx.OptimizationLevel = level
+	chunk, err := parser.NewParser("<test>", []byte(source)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := NewCompiler(ctx, nil).Compile(chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestOptimizer_Instructions(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected []Opcode
+	}{
+		{"return 60 * 60 * 24", []Opcode{OpLoadConst, OpReturn}},
+		{"return -(1 + 2) == -3 && \"a\" + \"b\"", []Opcode{OpLoadConst, OpReturn}},
+		{"return 1 / 0", []Opcode{OpLoadConst, OpLoadConst, OpBinaryDiv, OpReturn}},
+		{"if false { return 1 } else { return 2 }", []Opcode{OpLoadConst, OpReturn}},
+		{"for ; false; { return 1 }", []Opcode{OpLoadNull, OpReturn}},
+		{"return 1\nreturn 2", []Opcode{OpLoadConst, OpReturn}},
+		{"x = 1\nif x { x = 2 }", []Opcode{
+			OpLoadConst, OpStoreLocal, OpLoadLocal, OpJumpIfFalse,
+			OpLoadConst, OpStoreLocal, OpLoadNull, OpReturn,
+		}},
+	}
+	for _, test := range tests {
+		fn := compileString(t, OptimizeFull, test.source).entryFunction
+		opcodes := make([]Opcode, len(fn.Instructions))
+		for i, inst := range fn.Instructions {
+			opcodes[i] = inst.Opcode()
+		}
+		if len(opcodes) != len(test.expected) {
+			t.Errorf("%q: unexpected instructions %v", test.source, opcodes)
+			continue
+		}
+		for i := range opcodes {
+			if opcodes[i] != test.expected[i] {
+				t.Errorf("%q: unexpected instructions %v", test.source, opcodes)
+				break
+			}
+		}
+	}
+}
+
+func TestOptimizer_JumpThreading(t *testing.T) {
+	fn := compileString(t, OptimizeFull, "for i in [1, 2] {\n  if i == 2 { break }\n}").entryFunction
+	for pc, inst := range fn.Instructions {
+		if inst.Opcode() == OpBinaryEQ {
+			if line, _ := fn.Lines.Lookup(pc); line != 2 {
+				t.Errorf("#%d: unexpected line %d", pc, line)
+			}
+		}
+		if !isJump(inst.Opcode()) {
+			continue
+		}
+		switch target := fn.Instructions[inst.Operand()].Opcode(); target {
+		case OpJump, OpNop:
+			t.Errorf("#%d: %s targets %s", pc, inst, target)
+		}
+	}
+}
+
+func TestOptimizer_Superinstructions(t *testing.T) {
+	result := compileString(t, OptimizeFull, `fn f(n) {
+  total = 0
+  for i = 0; i < n; i = i + 1 {
+    if total != i { total = total * 2 }
+  }
+  return total
+}`)
+	found := make(map[Opcode]bool)
+	for _, fn := range result.compiledFunctions {
+		for _, inst := range fn.Instructions {
+			found[inst.Opcode()] = true
+		}
+	}
+	for _, opcode := range []Opcode{OpIncLocalConst, OpBinaryLocalConst, OpCompareLocalsJump} {
+		if !found[opcode] {
+			t.Errorf("%s not emitted", opcode)
+		}
+	}
+}
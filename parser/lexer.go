@@ -6,21 +6,34 @@ import (
 	"strconv"
 	"unicode"
 
+	"github.com/janqx/quark-lang/v1/diagnostic"
 	"github.com/janqx/quark-lang/v1/tokenize"
 )
 
 const EOF rune = -1
 
+// Mode selects what the lexer and the parser keep besides the syntax.
+type Mode uint
+
+const (
+	// ScanComments makes the lexer return comments as TokenComment tokens
+	// instead of skipping them, the parser collects them, see Comments.
+	ScanComments Mode = 1 << iota
+)
+
 type Lexer struct {
 	filename        string
 	reader          io.RuneReader
 	ch              rune
+	width           int // size of ch in bytes
 	offset          int
 	line, column    int
 	lines           map[int]int // number of columns per line
 	currentToken    *tokenize.Token
 	lookaheadToken  *tokenize.Token
 	currentPosition *tokenize.Position
+	diagnostics     diagnostic.Diagnostics
+	mode            Mode
 }
 
 func NewLexer(filename string, reader io.RuneReader) *Lexer {
@@ -30,7 +43,7 @@ func NewLexer(filename string, reader io.RuneReader) *Lexer {
 		ch:       0,
 		offset:   0,
 		line:     1,
-		column:   1,
+		column:   0,
 		lines:    make(map[int]int),
 	}
 	l.currentToken = nil
@@ -39,46 +52,70 @@ func NewLexer(filename string, reader io.RuneReader) *Lexer {
 	return l
 }
 
+// advance moves to the next character, offset, line and column always
+// describe the position of l.ch.
 func (l *Lexer) advance() rune {
-	var err error
-	l.ch, _, err = l.reader.ReadRune()
-	if err == nil {
-		l.offset++
-		if l.ch == '\n' {
-			l.lines[l.line] = l.column
-			l.line++
-			l.column = 1
-		} else {
-			l.column++
-		}
+	if l.ch == '\n' {
+		l.lines[l.line] = l.column
+		l.line++
+		l.column = 1
 	} else {
+		l.column++
+	}
+	l.offset += l.width
+	var err error
+	l.ch, l.width, err = l.reader.ReadRune()
+	if err != nil {
 		l.ch = EOF
+		l.width = 0
 	}
 	return l.ch
 }
 
-func (l *Lexer) skipComment() {
+func (l *Lexer) SetMode(mode Mode) {
+	l.mode = mode
+}
+
+// Diagnostics returns the problems found so far. The lexer never stops on
+// errors, it reports them and produces the most plausible token.
+func (l *Lexer) Diagnostics() diagnostic.Diagnostics {
+	return l.diagnostics
+}
+
+func (l *Lexer) error(start *tokenize.Position, message string, hints ...string) {
+	l.diagnostics = append(l.diagnostics, diagnostic.NewError(*start, *l.makePosition(), message, hints...))
+}
+
+// skipComment skips a comment whose '/' was consumed and returns its text
+// and where it ends. The newline ending a line comment is skipped as well
+// but isn't part of the comment.
+func (l *Lexer) skipComment() (string, *tokenize.Position) {
 	first := l.ch
+	text := []rune{'/', first}
 	l.advance()
 	for l.ch != EOF {
 		if first == '*' {
 			if l.ch == '*' {
 				if l.advance() == '/' {
 					l.advance()
-					break
+					return string(append(text, '*', '/')), l.makePosition()
 				}
+				text = append(text, '*')
 			} else {
+				text = append(text, l.ch)
 				l.advance()
 			}
 		} else {
 			if l.ch == '\n' {
+				end := l.makePosition()
 				l.advance()
-				break
-			} else {
-				l.advance()
+				return string(text), end
 			}
+			text = append(text, l.ch)
+			l.advance()
 		}
 	}
+	return string(text), l.makePosition()
 }
 
 func (l *Lexer) lexNumber() *tokenize.Token {
@@ -122,7 +159,7 @@ func (l *Lexer) lexNumber() *tokenize.Token {
 		}
 		value, err := strconv.ParseFloat(string(s), 64)
 		if err != nil {
-			panic(err)
+			l.error(token.Position, fmt.Sprintf("invalid float literal '%s'", string(s)))
 		}
 		token.Type = tokenize.TokenLiteralFloat
 		token.Value = float64(value)
@@ -135,69 +172,91 @@ func (l *Lexer) lexNumber() *tokenize.Token {
 			value, err = strconv.ParseInt(string(s), 10, 64)
 		}
 		if err != nil {
-			panic(err)
+			l.error(token.Position, fmt.Sprintf("integer literal '%s' out of range", string(s)))
 		}
 		token.Value = int64(value)
 	}
 	return token
 }
 
-func (l *Lexer) readEscape() (rune, error) {
+func (l *Lexer) readEscape(s []byte) ([]byte, error) {
 	l.advance() // skip '\'
 	switch l.ch {
 	case 'n':
-		return '\n', nil
+		return append(s, '\n'), nil
 	case 'r':
-		return '\r', nil
+		return append(s, '\r'), nil
 	case 't':
-		return '\t', nil
+		return append(s, '\t'), nil
 	case 'v':
-		return '\v', nil
+		return append(s, '\v'), nil
 	case 'b':
-		return '\b', nil
+		return append(s, '\b'), nil
 	case 'f':
-		return '\f', nil
+		return append(s, '\f'), nil
 	case 'a':
-		return '\a', nil
+		return append(s, '\a'), nil
 	case '\\':
-		return '\\', nil
+		return append(s, '\\'), nil
 	case '\'':
-		return '\'', nil
+		return append(s, '\''), nil
 	case '"':
-		return '"', nil
+		return append(s, '"'), nil
 	case '0':
-		return 0, nil
+		return append(s, 0), nil
+	case 'x':
+		// \xNN, a single raw byte
+		var value byte
+		for i := 0; i < 2; i++ {
+			l.advance()
+			switch {
+			case l.ch >= '0' && l.ch <= '9':
+				value = value<<4 | byte(l.ch-'0')
+			case l.ch >= 'a' && l.ch <= 'f':
+				value = value<<4 | byte(l.ch-'a'+10)
+			case l.ch >= 'A' && l.ch <= 'F':
+				value = value<<4 | byte(l.ch-'A'+10)
+			default:
+				return s, fmt.Errorf("illegal escape sequence")
+			}
+		}
+		return append(s, value), nil
 	default:
-		return EOF, fmt.Errorf("illegal escape sequence")
+		return s, fmt.Errorf("illegal escape sequence")
 	}
 }
 
-func (l *Lexer) lexSimpleString() *tokenize.Token {
+// lexSimpleString scans a quoted string, the token value keeps the prefix
+// and the quotes, escape sequences are already resolved.
+func (l *Lexer) lexSimpleString(tokenType tokenize.TokenType, prefix string) *tokenize.Token {
 	first := l.ch
-	s := []rune{l.ch}
-	token := l.makeToken(tokenize.TokenLiteralString)
+	s := append([]byte(prefix), string(l.ch)...)
+	token := l.makeToken(tokenType)
 	l.advance()
 	for l.ch != EOF {
 		if l.ch == '\\' {
-			ch, err := l.readEscape()
-			if err != nil {
-				panic(err)
+			escape := l.makePosition()
+			var err error
+			if s, err = l.readEscape(s); err != nil {
+				l.error(escape, err.Error(), `valid escapes are \n \r \t \v \b \f \a \\ \' \" \0 and \xNN`)
 			}
-			l.ch = ch
 			l.advance()
 			continue
 		}
-		s = append(s, l.ch)
+		if l.ch == '\n' {
+			break
+		}
+		s = append(s, string(l.ch)...)
 		if l.ch == first {
 			l.advance()
 			token.Value = string(s)
 			return token
-		} else if l.ch == '\n' {
-			break
 		}
 		l.advance()
 	}
-	panic(fmt.Errorf("%s:%d string literal not terminated", l.filename, token.Position.Line))
+	l.error(token.Position, "string literal not terminated", fmt.Sprintf("close the string with %c", first))
+	token.Value = string(append(s, string(first)...))
+	return token
 }
 
 func (l *Lexer) lexLongString() *tokenize.Token {
@@ -213,7 +272,9 @@ func (l *Lexer) lexLongString() *tokenize.Token {
 		}
 		l.advance()
 	}
-	panic(fmt.Errorf("%s:%d string literal not terminated", l.filename, token.Position.Line))
+	l.error(token.Position, "string literal not terminated", "close the string with `")
+	token.Value = string(append(s, '`'))
+	return token
 }
 
 func (l *Lexer) makePosition() *tokenize.Position {
@@ -245,21 +306,33 @@ func (l *Lexer) scan() *tokenize.Token {
 		case '/':
 			l.advance()
 			if l.ch == '/' || l.ch == '*' {
-				l.skipComment()
+				text, end := l.skipComment()
+				if l.mode&ScanComments != 0 {
+					token := l.makeToken(tokenize.TokenComment)
+					token.Value = text
+					token.End = end
+					return token
+				}
 			} else {
 				return l.makeToken(tokenize.TokenDiv)
 			}
 		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
 			return l.lexNumber()
 		case 0x27, '"':
-			return l.lexSimpleString()
+			return l.lexSimpleString(tokenize.TokenLiteralString, "")
 		case '`':
 			return l.lexLongString()
 		case '[', ']', '(', ')', '{', '}', ',', ';', ':', '?', '.':
 			ch := l.ch
 			l.advance()
 			return l.makeToken(tokenize.SeparatorToTokenType[ch])
-		case '+', '-', '*', '%', '~', '^':
+		case '-':
+			if l.advance() == '>' {
+				l.advance()
+				return l.makeToken(tokenize.TokenArrow)
+			}
+			return l.makeToken(tokenize.TokenMinus)
+		case '+', '*', '%', '~', '^':
 			ch := l.ch
 			l.advance()
 			return l.makeToken(tokenize.SingleOperatorToTokenType[ch])
@@ -324,6 +397,9 @@ func (l *Lexer) scan() *tokenize.Token {
 					s = append(s, l.ch)
 					l.advance()
 				}
+				if len(s) == 1 && s[0] == 'b' && (l.ch == 0x27 || l.ch == '"') {
+					return l.lexSimpleString(tokenize.TokenLiteralBytes, "b")
+				}
 				token.Value = string(s)
 				if ktype, ok := tokenize.KeywordToTokenType[token.Value.(string)]; ok {
 					token.Type = ktype
@@ -332,7 +408,9 @@ func (l *Lexer) scan() *tokenize.Token {
 				}
 				return token
 			} else {
-				panic(fmt.Errorf("unrecognized character: '%c'", l.ch))
+				ch := l.ch
+				l.advance()
+				l.error(l.currentPosition, fmt.Sprintf("unrecognized character: '%c'", ch))
 			}
 		}
 	}
@@ -343,14 +421,22 @@ func (l *Lexer) Next() *tokenize.Token {
 		l.currentToken = l.lookaheadToken
 		l.lookaheadToken = nil
 	} else {
-		l.currentToken = l.scan()
+		l.currentToken = l.lex()
 	}
 	return l.currentToken
 }
 
 func (l *Lexer) Lookahead() *tokenize.Token {
 	if l.lookaheadToken == nil {
-		l.lookaheadToken = l.scan()
+		l.lookaheadToken = l.lex()
 	}
 	return l.lookaheadToken
 }
+
+func (l *Lexer) lex() *tokenize.Token {
+	token := l.scan()
+	if token.End == nil {
+		token.End = l.makePosition()
+	}
+	return token
+}
@@ -5,17 +5,25 @@ import (
 	"strings"
 
 	"github.com/janqx/quark-lang/v1/ast"
+	"github.com/janqx/quark-lang/v1/diagnostic"
 	"github.com/janqx/quark-lang/v1/tokenize"
 )
 
 type Parser struct {
-	filename string
-	source   []byte
-	lexer    *Lexer
-	token    *tokenize.Token
-	err      error
+	filename    string
+	source      []byte
+	lexer       *Lexer
+	token       *tokenize.Token
+	prevEnd     tokenize.Position // end of the last consumed token
+	diagnostics diagnostic.Diagnostics
+	mode        Mode
+	comments    []*tokenize.Token
 }
 
+// bailout is raised after a syntax error was recorded, it unwinds to the
+// statement being parsed, see parseStatementOrSync.
+type bailout struct{}
+
 func NewParser(filename string, source []byte) *Parser {
 	return &Parser{
 		filename: filename,
@@ -23,36 +31,61 @@ func NewParser(filename string, source []byte) *Parser {
 	}
 }
 
+func (p *Parser) SetMode(mode Mode) {
+	p.mode = mode
+}
+
+// Comments returns the comments of the source in order, they are only
+// collected in ScanComments mode.
+func (p *Parser) Comments() []*tokenize.Token {
+	return p.comments
+}
+
+// Parse parses the whole source. Syntax errors don't stop the parser, all
+// of them are returned as diagnostic.Diagnostics, together with the chunk
+// where the broken statements are left out.
 func (p *Parser) Parse() (*ast.Chunk, error) {
 	chunk := p.parse()
-	if p.err != nil {
-		return nil, fmt.Errorf("in file \"%s\"\n%s", p.filename, p.err.Error())
+	diagnostics := append(p.lexer.Diagnostics(), p.diagnostics...)
+	if len(diagnostics) > 0 {
+		diagnostics.Sort()
+		return chunk, diagnostics
 	}
 	return chunk, nil
 }
 
 func (p *Parser) parse() *ast.Chunk {
 	p.lexer = NewLexer(p.filename, strings.NewReader(string(p.source)))
+	p.lexer.SetMode(p.mode)
 	p.token = nil
-	p.err = nil
+	p.diagnostics = nil
+	p.comments = nil
 	p.next()
+	start := p.start()
 	chunk := &ast.Chunk{}
 	chunk.Statements = p.parseStatementList()
+	for p.test(tokenize.TokenCloseBrace) {
+		p.report(p.token, "unexpected '}'", "remove it or add the matching '{'")
+		p.next()
+		chunk.Statements.List = append(chunk.Statements.List, p.parseStatementList().List...)
+	}
 	p.expect(tokenize.TokenEof)
+	p.finish(chunk, start)
 	return chunk
 }
 
 func (p *Parser) parseStatement() ast.Statement {
+	start := p.start()
 	switch p.token.Type {
 	case tokenize.TokenDebugger:
 		p.next()
-		return &ast.DebuggerStatement{}
+		return p.finishStatement(&ast.DebuggerStatement{}, start)
 	case tokenize.TokenContinue:
 		p.next()
-		return &ast.ContinueStatement{}
+		return p.finishStatement(&ast.ContinueStatement{}, start)
 	case tokenize.TokenBreak:
 		p.next()
-		return &ast.BreakStatement{}
+		return p.finishStatement(&ast.BreakStatement{}, start)
 	case tokenize.TokenReturn:
 		return p.parseReturnStatement()
 	case tokenize.TokenIf:
@@ -79,29 +112,78 @@ func (p *Parser) parseStatement() ast.Statement {
 
 // statement+
 func (p *Parser) parseStatementList() *ast.StatementList {
+	start := p.start()
 	result := &ast.StatementList{
-		List: []ast.Statement{p.parseStatement()},
+		List: []ast.Statement{p.parseStatementOrSync()},
 	}
 	for {
 		if p.test(tokenize.TokenEof, tokenize.TokenCloseBrace) {
 			break
 		}
-		result.List = append(result.List, p.parseStatement())
+		result.List = append(result.List, p.parseStatementOrSync())
 	}
+	p.finish(result, start)
 	return result
 }
 
+// parseStatementOrSync parses a statement, on a syntax error the rest of the
+// statement is skipped and an empty statement takes its place.
+func (p *Parser) parseStatementOrSync() (result ast.Statement) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(bailout); !ok {
+				panic(r)
+			}
+			p.synchronize()
+			result = ast.SingletonEmptyStatement
+		}
+	}()
+	return p.parseStatement()
+}
+
+// synchronize skips to the next statement boundary: after a newline, or
+// before a '}' closing the enclosing block. Brackets opened meanwhile are
+// skipped as a whole.
+func (p *Parser) synchronize() {
+	depth := 0
+	for !p.empty() {
+		switch p.token.Type {
+		case tokenize.TokenOpenBrace, tokenize.TokenOpenParen, tokenize.TokenOpenBracket:
+			depth++
+		case tokenize.TokenCloseParen, tokenize.TokenCloseBracket:
+			if depth > 0 {
+				depth--
+			}
+		case tokenize.TokenCloseBrace:
+			if depth == 0 {
+				return
+			}
+			depth--
+		case tokenize.TokenNewline:
+			if depth == 0 {
+				p.next()
+				return
+			}
+		}
+		p.next()
+	}
+}
+
 func (p *Parser) parseReturnStatement() ast.Statement {
+	start := p.start()
 	p.expect(tokenize.TokenReturn)
 	var expressions *ast.ExpressionList = nil
 	if p.test(tokenize.TokenCloseBrace) || p.token.IsNewLine() {
+		// the implicit null sits on the 'return' keyword
+		null := p.finishExpression(&ast.NullLiteralExpression{}, start)
 		expressions = &ast.ExpressionList{
-			List: []ast.Expression{&ast.NullLiteralExpression{}},
+			List: []ast.Expression{null},
 		}
+		p.finish(expressions, start)
 	} else {
 		expressions = p.parseExpressionList(false)
 	}
-	return &ast.ReturnStatement{Expressions: expressions}
+	return p.finishStatement(&ast.ReturnStatement{Expressions: expressions}, start)
 }
 
 /*
@@ -112,6 +194,7 @@ if cond {
 }
 */
 func (p *Parser) parseIfStatement() ast.Statement {
+	start := p.start()
 	p.expect(tokenize.TokenIf)
 	result := &ast.IfStatement{}
 	result.Condition = p.parseExpression()
@@ -130,16 +213,23 @@ func (p *Parser) parseIfStatement() ast.Statement {
 			break
 		}
 	}
-	return result
+	return p.finishStatement(result, start)
 }
 
 /*
 for { }
 for cond { }
 for init?; cond?; post? { }
+for name in iterable { }
 */
 func (p *Parser) parseForStatement() ast.Statement {
+	start := p.start()
 	p.expect(tokenize.TokenFor)
+
+	if p.test(tokenize.TokenIdentifier) && p.lookahead().Type == tokenize.TokenIn {
+		return p.parseForInStatement(start)
+	}
+
 	result := &ast.ForStatement{}
 
 	var x ast.Statement = nil
@@ -178,94 +268,143 @@ func (p *Parser) parseForStatement() ast.Statement {
 
 L_body:
 	result.Body = p.parseBlockStatement()
-	return result
+	return p.finishStatement(result, start)
+}
+
+func (p *Parser) parseForInStatement(start tokenize.Position) ast.Statement {
+	result := &ast.ForInStatement{}
+	result.Name = p.expect(tokenize.TokenIdentifier).Value.(string)
+	p.expect(tokenize.TokenIn)
+	result.Iterable = p.parseExpression()
+	result.Body = p.parseBlockStatement()
+	return p.finishStatement(result, start)
 }
 
 func (p *Parser) parseFunctionDeclareStatement() ast.Statement {
+	start := p.start()
 	p.expect(tokenize.TokenFunction)
 	result := &ast.FunctionDeclareStatement{}
 	result.Name = p.expect(tokenize.TokenIdentifier).Value.(string)
-	p.expect(tokenize.TokenOpenParen)
+	open := p.expect(tokenize.TokenOpenParen)
 	if !p.test(tokenize.TokenCloseParen) {
-		result.ParameterNames = p.parseIdentifierList()
+		result.ParameterNames, result.ParameterSpans, result.ParameterTypes = p.parseParameterList()
 	}
-	p.expect(tokenize.TokenCloseParen)
+	p.expectClosing(tokenize.TokenCloseParen, open)
+	result.ReturnType = p.parseReturnType()
 	result.Body = p.parseBlockStatement()
-	return result
+	return p.finishStatement(result, start)
 }
 
 func (p *Parser) parseBlockStatement() ast.Statement {
-	p.expect(tokenize.TokenOpenBrace)
+	start := p.start()
+	open := p.expect(tokenize.TokenOpenBrace)
 	result := &ast.BlockStatement{Statements: ast.EmptyStatementList}
 	if !p.test(tokenize.TokenCloseBrace) {
 		result.Statements = p.parseStatementList()
 	}
-	p.expect(tokenize.TokenCloseBrace)
-	return result
+	p.expectClosing(tokenize.TokenCloseBrace, open)
+	return p.finishStatement(result, start)
 }
 
 // export expression
 func (p *Parser) parseExportStatement() ast.Statement {
+	start := p.start()
 	p.expect(tokenize.TokenExport)
 	result := &ast.ExportStatement{
 		Module: p.parseExpression(),
 	}
-	return result
+	return p.finishStatement(result, start)
 }
 
 var __cast_assignable = func(expression ast.Expression) ast.Expression {
+	var result ast.Expression
 	switch expression := expression.(type) {
 	case *ast.IdentifierExpression:
-		return &ast.IdentifierExpression{
+		result = &ast.IdentifierExpression{
 			Assign: true,
 			Name:   expression.Name,
 		}
 	case *ast.IndexAccessExpression:
-		return &ast.IndexAccessExpression{
+		result = &ast.IndexAccessExpression{
 			Assign: true,
 			Value:  expression.Value,
 			Index:  expression.Index,
 		}
 	case *ast.AttributeAccessExpression:
-		return &ast.AttributeAccessExpression{
+		result = &ast.AttributeAccessExpression{
 			Assign: true,
 			Value:  expression.Value,
 			Name:   expression.Name,
 		}
+	default:
+		return expression
 	}
-	return expression
+	result.SetPosition(expression.Start(), expression.End())
+	return result
 }
 
 // assign or call
 // a, b, c... = 1, 2, 3...
 // func(a, b, c...)
 func (p *Parser) parseOtherStatement() ast.Statement {
+	start := p.start()
 	expression := p.parseExpression()
 
 	// assignable
-	if p.test(tokenize.TokenComma, tokenize.TokenAssign) {
+	if p.test(tokenize.TokenComma, tokenize.TokenAssign, tokenize.TokenColon) {
 		assign := &ast.AssignStatement{
 			Assignables: make([]ast.Expression, 0),
 			Expressions: ast.EmptyExpressionList,
 		}
 
 		// parse more assignables
-		assign.Assignables = append(assign.Assignables, __cast_assignable(expression))
+		assign.Assignables = append(assign.Assignables, p.castAssignable(expression))
+		p.annotate(assign)
 		for p.test(tokenize.TokenComma) {
 			p.next()
-			assign.Assignables = append(assign.Assignables, __cast_assignable(p.parseExpression()))
+			assign.Assignables = append(assign.Assignables, p.castAssignable(p.parseExpression()))
+			p.annotate(assign)
 		}
 		p.expect(tokenize.TokenAssign)
 
 		// parse expressions
 		assign.Expressions = p.parseExpressionList(false)
 
-		return assign
+		return p.finishStatement(assign, start)
 	}
 
-	return &ast.ExpressionStatement{
+	return p.finishStatement(&ast.ExpressionStatement{
 		Expression: expression,
+	}, start)
+}
+
+// annotate parses the optional type annotation of the last assignable,
+// only names can be annotated.
+func (p *Parser) annotate(assign *ast.AssignStatement) {
+	annotation := p.parseTypeAnnotation()
+	if annotation == nil {
+		return
+	}
+	assignable := assign.Assignables[len(assign.Assignables)-1]
+	if _, ok := assignable.(*ast.IdentifierExpression); !ok {
+		p.diagnose(diagnostic.NewError(assignable.Start(), annotation.End,
+			fmt.Sprintf("cannot annotate '%s'", assignable.String()),
+			"only names can have a type annotation"))
+	}
+	for len(assign.Types) < len(assign.Assignables)-1 {
+		assign.Types = append(assign.Types, nil)
 	}
+	assign.Types = append(assign.Types, annotation)
+}
+
+func (p *Parser) castAssignable(expression ast.Expression) ast.Expression {
+	result := __cast_assignable(expression)
+	if result == expression {
+		p.diagnose(diagnostic.NewError(expression.Start(), expression.End(),
+			fmt.Sprintf("cannot assign to '%s'", expression.String()),
+			"only names, index and attribute expressions can be assigned"))
+	}
+	return result
 }
 
 func (p *Parser) parseExpression() ast.Expression {
@@ -282,11 +421,11 @@ func (p *Parser) parseTernaryExpression() ast.Expression {
 		p.expect(tokenize.TokenColon)
 		y := p.parseTernaryExpression()
 
-		return &ast.TernaryExpression{
+		return p.finishExpression(&ast.TernaryExpression{
 			Cond: cond,
 			X:    x,
 			Y:    y,
-		}
+		}, cond.Start())
 	}
 	return cond
 }
@@ -296,11 +435,11 @@ func (p *Parser) parseLogicOrExpression() ast.Expression {
 	for p.test(tokenize.TokenLogicOr) {
 		p.next()
 		right := p.parseLogicAndExpression()
-		left = &ast.BinaryExpression{
+		left = p.finishExpression(&ast.BinaryExpression{
 			Op:    tokenize.TokenLogicOr,
 			Left:  left,
 			Right: right,
-		}
+		}, left.Start())
 	}
 	return left
 }
@@ -311,11 +450,11 @@ func (p *Parser) parseLogicAndExpression() ast.Expression {
 	for p.test(tokenize.TokenLogicAnd) {
 		p.next()
 		right := p.parseBitOrExpression()
-		left = &ast.BinaryExpression{
+		left = p.finishExpression(&ast.BinaryExpression{
 			Op:    tokenize.TokenLogicAnd,
 			Left:  left,
 			Right: right,
-		}
+		}, left.Start())
 	}
 	return left
 }
@@ -325,11 +464,11 @@ func (p *Parser) parseBitOrExpression() ast.Expression {
 	for p.test(tokenize.TokenBitOr) {
 		p.next()
 		right := p.parseBitXorExpression()
-		left = &ast.BinaryExpression{
+		left = p.finishExpression(&ast.BinaryExpression{
 			Op:    tokenize.TokenBitOr,
 			Left:  left,
 			Right: right,
-		}
+		}, left.Start())
 	}
 	return left
 }
@@ -339,11 +478,11 @@ func (p *Parser) parseBitXorExpression() ast.Expression {
 	for p.test(tokenize.TokenBitXor) {
 		p.next()
 		right := p.parseBitAndExpression()
-		left = &ast.BinaryExpression{
+		left = p.finishExpression(&ast.BinaryExpression{
 			Op:    tokenize.TokenBitXor,
 			Left:  left,
 			Right: right,
-		}
+		}, left.Start())
 	}
 	return left
 }
@@ -353,30 +492,30 @@ func (p *Parser) parseBitAndExpression() ast.Expression {
 	for p.test(tokenize.TokenBitAnd) {
 		p.next()
 		right := p.parseEqualityExpression()
-		left = &ast.BinaryExpression{
+		left = p.finishExpression(&ast.BinaryExpression{
 			Op:    tokenize.TokenBitAnd,
 			Left:  left,
 			Right: right,
-		}
+		}, left.Start())
 	}
 	return left
 }
 
-// x op=(== | !=) y
+// x op=(== | != | is) y
 func (p *Parser) parseEqualityExpression() ast.Expression {
 	left := p.parseRelationalExpression()
 	for {
 		op := p.token
-		if !p.test(tokenize.TokenEQ, tokenize.TokenNEQ) {
+		if !p.test(tokenize.TokenEQ, tokenize.TokenNEQ, tokenize.TokenIs) {
 			break
 		}
 		p.next()
 		right := p.parseRelationalExpression()
-		left = &ast.BinaryExpression{
+		left = p.finishExpression(&ast.BinaryExpression{
 			Op:    op.Type,
 			Left:  left,
 			Right: right,
-		}
+		}, left.Start())
 	}
 	return left
 }
@@ -390,11 +529,11 @@ func (p *Parser) parseRelationalExpression() ast.Expression {
 		}
 		p.next()
 		right := p.parseBitShiftExpression()
-		left = &ast.BinaryExpression{
+		left = p.finishExpression(&ast.BinaryExpression{
 			Op:    op.Type,
 			Left:  left,
 			Right: right,
-		}
+		}, left.Start())
 	}
 	return left
 }
@@ -408,11 +547,11 @@ func (p *Parser) parseBitShiftExpression() ast.Expression {
 		}
 		p.next()
 		right := p.parseAdditiveExpression()
-		left = &ast.BinaryExpression{
+		left = p.finishExpression(&ast.BinaryExpression{
 			Op:    op.Type,
 			Left:  left,
 			Right: right,
-		}
+		}, left.Start())
 	}
 	return left
 }
@@ -426,11 +565,11 @@ func (p *Parser) parseAdditiveExpression() ast.Expression {
 		}
 		p.next()
 		right := p.parseMultiplicativeExpression()
-		left = &ast.BinaryExpression{
+		left = p.finishExpression(&ast.BinaryExpression{
 			Op:    op.Type,
 			Left:  left,
 			Right: right,
-		}
+		}, left.Start())
 	}
 	return left
 }
@@ -444,23 +583,24 @@ func (p *Parser) parseMultiplicativeExpression() ast.Expression {
 		}
 		p.next()
 		right := p.parseUnaryExpression()
-		left = &ast.BinaryExpression{
+		left = p.finishExpression(&ast.BinaryExpression{
 			Op:    op.Type,
 			Left:  left,
 			Right: right,
-		}
+		}, left.Start())
 	}
 	return left
 }
 
 func (p *Parser) parseUnaryExpression() ast.Expression {
+	start := p.start()
 	op := p.token
 	if p.test(tokenize.TokenPlus, tokenize.TokenMinus, tokenize.TokenNot, tokenize.TokenBitNot) {
 		p.next()
-		return &ast.UnaryExpression{
+		return p.finishExpression(&ast.UnaryExpression{
 			Op:         op.Type,
 			Expression: p.parseUnaryExpression(),
-		}
+		}, start)
 	}
 	return p.parsePrimaryExpression()
 }
@@ -471,6 +611,7 @@ loop:
 	for {
 		switch p.token.Type {
 		case tokenize.TokenOpenParen:
+			open := p.token
 			p.next()
 			var args *ast.ExpressionList
 			if p.test(tokenize.TokenCloseParen) {
@@ -478,26 +619,45 @@ loop:
 			} else {
 				args = p.parseExpressionList(false)
 			}
-			p.expect(tokenize.TokenCloseParen)
-			left = &ast.CallFunctionExpression{
+			p.expectClosing(tokenize.TokenCloseParen, open)
+			left = p.finishExpression(&ast.CallFunctionExpression{
 				Callable: left,
 				Args:     args,
-			}
+			}, left.Start())
 		case tokenize.TokenOpenBracket:
+			open := p.token
 			p.next()
-			left = &ast.IndexAccessExpression{
-				Value:  left,
-				Index:  p.parseExpression(),
-				Assign: false,
+			var result ast.Expression
+			var index ast.Expression = nil
+			if !p.test(tokenize.TokenColon) {
+				index = p.parseExpression()
 			}
-			p.expect(tokenize.TokenCloseBracket)
+			if p.test(tokenize.TokenColon) {
+				p.next()
+				slice := &ast.SliceExpression{
+					Value: left,
+					Low:   index,
+				}
+				if !p.test(tokenize.TokenCloseBracket) {
+					slice.High = p.parseExpression()
+				}
+				result = slice
+			} else {
+				result = &ast.IndexAccessExpression{
+					Value:  left,
+					Index:  index,
+					Assign: false,
+				}
+			}
+			p.expectClosing(tokenize.TokenCloseBracket, open)
+			left = p.finishExpression(result, left.Start())
 		case tokenize.TokenDot:
 			p.next()
-			left = &ast.AttributeAccessExpression{
+			left = p.finishExpression(&ast.AttributeAccessExpression{
 				Value:  left,
 				Name:   p.expect(tokenize.TokenIdentifier).Value.(string),
 				Assign: false,
-			}
+			}, left.Start())
 		default:
 			break loop
 		}
@@ -507,39 +667,47 @@ loop:
 
 func (p *Parser) parseAtomExpression() ast.Expression {
 	if p.empty() {
-		panic(fmt.Errorf("<expression> expected near '<eof>"))
+		p.errorMessage("expression expected, but got: '<eof>'")
 	}
 
+	start := p.start()
 	switch token := p.token; token.Type {
 	case tokenize.TokenNull:
 		p.next()
-		return &ast.NullLiteralExpression{}
+		return p.finishExpression(&ast.NullLiteralExpression{}, start)
 	case tokenize.TokenTrue:
 		p.next()
-		return &ast.TrueLiteralExpression{}
+		return p.finishExpression(&ast.TrueLiteralExpression{}, start)
 	case tokenize.TokenFalse:
 		p.next()
-		return &ast.FalseLiteralExpression{}
+		return p.finishExpression(&ast.FalseLiteralExpression{}, start)
 	case tokenize.TokenLiteralInt:
 		p.next()
-		return &ast.IntLiteralExpression{Value: token.Value.(int64)}
+		return p.finishExpression(&ast.IntLiteralExpression{Value: token.Value.(int64)}, start)
 	case tokenize.TokenLiteralFloat:
 		p.next()
-		return &ast.FloatLiteralExpression{Value: token.Value.(float64)}
+		return p.finishExpression(&ast.FloatLiteralExpression{Value: token.Value.(float64)}, start)
 	case tokenize.TokenLiteralString:
 		p.next()
 		proto := token.Value.(string)
-		return &ast.StringLiteralExpression{
+		return p.finishExpression(&ast.StringLiteralExpression{
 			Value: proto[1 : len(proto)-1],
 			Proto: proto,
-		}
+		}, start)
+	case tokenize.TokenLiteralBytes:
+		p.next()
+		proto := token.Value.(string)
+		return p.finishExpression(&ast.BytesLiteralExpression{
+			Value: []byte(proto[2 : len(proto)-1]),
+			Proto: proto,
+		}, start)
 	case tokenize.TokenIdentifier:
 		p.next()
-		return &ast.IdentifierExpression{Name: token.Value.(string), Assign: false}
+		return p.finishExpression(&ast.IdentifierExpression{Name: token.Value.(string), Assign: false}, start)
 	case tokenize.TokenOpenParen:
 		p.next()
 		expression := p.parseExpression()
-		p.expect(tokenize.TokenCloseParen)
+		p.expectClosing(tokenize.TokenCloseParen, token)
 		return expression
 	case tokenize.TokenOpenBracket:
 		p.next()
@@ -549,30 +717,32 @@ func (p *Parser) parseAtomExpression() ast.Expression {
 		if !p.test(tokenize.TokenCloseBracket) {
 			result.Value = p.parseExpressionList(true)
 		}
-		p.expect(tokenize.TokenCloseBracket)
-		return result
+		p.expectClosing(tokenize.TokenCloseBracket, token)
+		return p.finishExpression(result, start)
 	case tokenize.TokenOpenBrace:
 		p.next()
 		result := &ast.DictLiteralExpression{}
 		if p.test(tokenize.TokenCloseBrace) {
 			result.Value = map[string]ast.Expression{}
 		} else {
-			result.Value = p.parseDictLiteral()
+			result.Value, result.Keys = p.parseDictLiteral()
 		}
-		p.expect(tokenize.TokenCloseBrace)
-		return result
+		p.expectClosing(tokenize.TokenCloseBrace, token)
+		return p.finishExpression(result, start)
 	case tokenize.TokenFunction:
 		p.next()
-		p.expect(tokenize.TokenOpenParen)
+		open := p.expect(tokenize.TokenOpenParen)
 		result := &ast.FunctionDeclareExpression{}
 		if !p.test(tokenize.TokenCloseParen) {
-			result.ParameterNames = p.parseIdentifierList()
+			result.ParameterNames, result.ParameterSpans, result.ParameterTypes = p.parseParameterList()
 		}
-		p.expect(tokenize.TokenCloseParen)
+		p.expectClosing(tokenize.TokenCloseParen, open)
+		result.ReturnType = p.parseReturnType()
 		result.Body = p.parseBlockStatement()
-		return result
+		return p.finishExpression(result, start)
 	default:
-		panic(fmt.Errorf("unexpected token near '%s'", token.Type.String()))
+		p.errorMessage("unexpected token near '%s'", token.Type.String())
+		return nil
 	}
 }
 
@@ -581,6 +751,7 @@ func (p *Parser) parseExpressionList(skipNewline bool) *ast.ExpressionList {
 	if skipNewline {
 		p.skipNewline()
 	}
+	start := p.start()
 	result := &ast.ExpressionList{
 		List: []ast.Expression{p.parseExpression()},
 	}
@@ -591,45 +762,143 @@ func (p *Parser) parseExpressionList(skipNewline bool) *ast.ExpressionList {
 		}
 		result.List = append(result.List, p.parseExpression())
 	}
+	p.finish(result, start)
 	if skipNewline {
 		p.skipNewline()
 	}
 	return result
 }
 
-// identifier (',' identifier)*
-func (p *Parser) parseIdentifierList() []string {
-	result := []string{p.expect(tokenize.TokenIdentifier).Value.(string)}
-	for p.test(tokenize.TokenComma) {
+// identifier (':' type)? (',' identifier (':' type)?)*
+func (p *Parser) parseParameterList() (names []string, spans []ast.Span, types []*ast.Type) {
+	annotated := false
+	for {
+		start := p.start()
+		names = append(names, p.expect(tokenize.TokenIdentifier).Value.(string))
+		spans = append(spans, ast.Span{Start: start, End: p.prevEnd})
+		types = append(types, p.parseTypeAnnotation())
+		annotated = annotated || types[len(types)-1] != nil
+		if !p.test(tokenize.TokenComma) {
+			break
+		}
 		p.next()
-		result = append(result, p.expect(tokenize.TokenIdentifier).Value.(string))
 	}
+	if !annotated {
+		types = nil
+	}
+	return names, spans, types
+}
+
+// (':' type)?
+func (p *Parser) parseTypeAnnotation() *ast.Type {
+	if !p.test(tokenize.TokenColon) {
+		return nil
+	}
+	p.next()
+	return p.parseType()
+}
+
+// ('->' type)?
+func (p *Parser) parseReturnType() *ast.Type {
+	if !p.test(tokenize.TokenArrow) {
+		return nil
+	}
+	p.next()
+	return p.parseType()
+}
+
+// identifier ('[' type (',' type)* ']')? '?'?
+func (p *Parser) parseType() *ast.Type {
+	start := p.start()
+	result := &ast.Type{Start: start}
+	if p.test(tokenize.TokenNull) {
+		p.next()
+		result.Name = "Null"
+	} else {
+		result.Name = p.expect(tokenize.TokenIdentifier).Value.(string)
+	}
+	if p.test(tokenize.TokenOpenBracket) {
+		open := p.token
+		p.next()
+		result.Arguments = append(result.Arguments, p.parseType())
+		for p.test(tokenize.TokenComma) {
+			p.next()
+			result.Arguments = append(result.Arguments, p.parseType())
+		}
+		p.expectClosing(tokenize.TokenCloseBracket, open)
+	}
+	if p.test(tokenize.TokenQuestion) {
+		p.next()
+		result.Nullable = true
+	}
+	result.End = p.prevEnd
 	return result
 }
 
 // identifier ':' expression (',' identifier ':' expression)*
-func (p *Parser) parseDictLiteral() map[string]ast.Expression {
+func (p *Parser) parseDictLiteral() (map[string]ast.Expression, []string) {
 	result := make(map[string]ast.Expression)
+	var keys []string
 	p.skipNewline()
-	key := p.expect(tokenize.TokenIdentifier).Value.(string)
-	p.expect(tokenize.TokenColon)
-	result[key] = p.parseExpression()
-	for p.test(tokenize.TokenComma) {
-		p.next()
-		p.skipNewline()
-		key = p.expect(tokenize.TokenIdentifier).Value.(string)
+	for {
+		key := p.expect(tokenize.TokenIdentifier).Value.(string)
 		p.expect(tokenize.TokenColon)
+		if _, ok := result[key]; !ok {
+			keys = append(keys, key)
+		}
 		result[key] = p.parseExpression()
+		if !p.test(tokenize.TokenComma) {
+			break
+		}
+		p.next()
+		p.skipNewline()
 	}
 	p.skipNewline()
-	return result
+	return result, keys
 }
 
 func (p *Parser) next() *tokenize.Token {
+	if p.token != nil {
+		p.prevEnd = *p.token.End
+	}
 	p.token = p.lexer.Next()
+	for p.token.Type == tokenize.TokenComment {
+		p.comments = append(p.comments, p.token)
+		p.token = p.lexer.Next()
+	}
 	return p.token
 }
 
+// lookahead returns the token after the current one, skipping comments.
+func (p *Parser) lookahead() *tokenize.Token {
+	for p.lexer.Lookahead().Type == tokenize.TokenComment {
+		p.comments = append(p.comments, p.lexer.Next())
+	}
+	return p.lexer.Lookahead()
+}
+
+// start returns the position of the current token, the first one of the
+// node about to be parsed.
+func (p *Parser) start() tokenize.Position {
+	return *p.token.Position
+}
+
+// finish sets the position of node, from start to the end of the last
+// consumed token.
+func (p *Parser) finish(node ast.Node, start tokenize.Position) {
+	node.SetPosition(start, p.prevEnd)
+}
+
+func (p *Parser) finishStatement(node ast.Statement, start tokenize.Position) ast.Statement {
+	p.finish(node, start)
+	return node
+}
+
+func (p *Parser) finishExpression(node ast.Expression, start tokenize.Position) ast.Expression {
+	p.finish(node, start)
+	return node
+}
+
 func (p *Parser) test(tt ...tokenize.TokenType) bool {
 	for _, t := range tt {
 		if t == p.token.Type {
@@ -639,8 +908,24 @@ func (p *Parser) test(tt ...tokenize.TokenType) bool {
 	return false
 }
 
+// diagnose records d unless an error was already reported at the same
+// place, one mistake often confuses the parser more than once.
+func (p *Parser) diagnose(d diagnostic.Diagnostic) {
+	if n := len(p.diagnostics); n > 0 && p.diagnostics[n-1].Start.Offset == d.Start.Offset {
+		return
+	}
+	p.diagnostics = append(p.diagnostics, d)
+}
+
+func (p *Parser) report(token *tokenize.Token, message string, hints ...string) {
+	p.diagnose(diagnostic.NewError(*token.Position, *token.End, message, hints...))
+}
+
+// errorMessage reports an error at the current token and abandons the
+// statement being parsed.
 func (p *Parser) errorMessage(format string, args ...interface{}) {
-	panic(fmt.Errorf(format, args...))
+	p.report(p.token, fmt.Sprintf(format, args...))
+	panic(bailout{})
 }
 
 func (p *Parser) expect(tt tokenize.TokenType) *tokenize.Token {
@@ -652,6 +937,17 @@ func (p *Parser) expect(tt tokenize.TokenType) *tokenize.Token {
 	return result
 }
 
+// expectClosing is expect for a closing bracket, the hint points at the
+// bracket it should match.
+func (p *Parser) expectClosing(tt tokenize.TokenType, open *tokenize.Token) *tokenize.Token {
+	if p.token.Type != tt {
+		p.report(p.token, fmt.Sprintf("'%s' expected, but got: '%s'", tt.String(), p.token.Type.String()),
+			fmt.Sprintf("add '%s' to match the '%s' at %s", tt.String(), open.Type.String(), open.Position.String()))
+		panic(bailout{})
+	}
+	return p.expect(tt)
+}
+
 func (p *Parser) empty() bool {
 	return p.token.Type == tokenize.TokenEof
 }
@@ -3,13 +3,16 @@ package parser_test
 import (
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 
+	"github.com/janqx/quark-lang/v1/ast"
+	"github.com/janqx/quark-lang/v1/diagnostic"
 	"github.com/janqx/quark-lang/v1/parser"
 )
 
 func TestParser(t *testing.T) {
-	source, err := os.ReadFile(`C:\Users\Administrator\Desktop\projects\quark-lang\example\oop.jango`)
+	source, err := os.ReadFile("../example/closure.qk")
 	if err != nil {
 		panic(err)
 	}
@@ -20,3 +23,111 @@ func TestParser(t *testing.T) {
 	}
 	fmt.Println(chunk.String())
 }
+
+func TestParser_Positions(t *testing.T) {
+	source := "x = 1 + foo(2)\nif x {\n  return \"héllo\"[0]\n}\n"
+	chunk, err := parser.NewParser("t.qk", []byte(source)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assign := chunk.Statements.List[0].(*ast.AssignStatement)
+	binary := assign.Expressions.List[0].(*ast.BinaryExpression)
+	ifStatement := chunk.Statements.List[2].(*ast.IfStatement)
+	returnStatement := ifStatement.ThenBody.(*ast.BlockStatement).Statements.List[1].(*ast.ReturnStatement)
+	index := returnStatement.Expressions.List[0].(*ast.IndexAccessExpression)
+	tests := []struct {
+		node       ast.Node
+		start, end string
+	}{
+		{assign, "t.qk:1:1", "t.qk:1:15"},
+		{assign.Assignables[0], "t.qk:1:1", "t.qk:1:2"},
+		{binary, "t.qk:1:5", "t.qk:1:15"},
+		{binary.Right, "t.qk:1:9", "t.qk:1:15"},
+		{ifStatement, "t.qk:2:1", "t.qk:4:2"},
+		{returnStatement, "t.qk:3:3", "t.qk:3:20"},
+		{index.Value, "t.qk:3:10", "t.qk:3:17"},
+	}
+	for _, test := range tests {
+		if start, end := test.node.Start().String(), test.node.End().String(); start != test.start || end != test.end {
+			t.Errorf("%s: expected %s-%s, got %s-%s", test.node.String(), test.start, test.end, start, end)
+		}
+	}
+	if offset := index.Index.Start().Offset; offset != 40 {
+		t.Errorf("expected byte offset 40, got %d", offset)
+	}
+}
+
+func TestParser_Diagnostics(t *testing.T) {
+	source := "x = (1 +\ny = 2\nif y > 1 {\n  z = \"abc\n  1 = y\n}\n}\nw = [1, 2\n"
+	_, err := parser.NewParser("t.qk", []byte(source)).Parse()
+	diagnostics, ok := err.(diagnostic.Diagnostics)
+	if !ok {
+		t.Fatalf("expected diagnostics, got %v", err)
+	}
+	expected := []string{
+		"t.qk:1:9: error: unexpected token near '<newline>'",
+		"t.qk:4:7: error: string literal not terminated",
+		"t.qk:5:3: error: cannot assign to '1'",
+		"t.qk:7:1: error: unexpected '}'",
+		"t.qk:9:1: error: ']' expected, but got: '<eof>'",
+	}
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got:\n%s", len(expected), diagnostics.Error())
+	}
+	for i, d := range diagnostics {
+		if message := strings.SplitN(d.String(), "\n", 2)[0]; message != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], message)
+		}
+	}
+	if hints := diagnostics[4].Hints; len(hints) != 1 || hints[0] != "add ']' to match the '[' at t.qk:8:5" {
+		t.Errorf("unexpected hints: %v", hints)
+	}
+}
+
+func TestParser_TypeAnnotations(t *testing.T) {
+	source := "fn add(a: Int, b) -> List[String]? { return null }\nx: Dict[Int], y = {}, 1\n"
+	chunk, err := parser.NewParser("t.qk", []byte(source)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := chunk.Statements.List[0].(*ast.FunctionDeclareStatement)
+	if len(fn.ParameterTypes) != 2 || fn.ParameterTypes[0].String() != "Int" || fn.ParameterTypes[1] != nil {
+		t.Fatalf("unexpected parameter types: %v", fn.ParameterTypes)
+	}
+	if spans := fn.ParameterSpans; len(spans) != 2 || spans[0].Start.Column != 8 || spans[0].End.Column != 9 || spans[1].Start.Column != 16 {
+		t.Fatalf("unexpected parameter spans: %v", spans)
+	}
+	if fn.ReturnType.String() != "List[String]?" {
+		t.Fatalf("unexpected return type: %s", fn.ReturnType)
+	}
+	assign := chunk.Statements.List[2].(*ast.AssignStatement)
+	if len(assign.Types) != 1 || assign.Types[0].String() != "Dict[Int]" {
+		t.Fatalf("unexpected types: %v", assign.Types)
+	}
+
+	_, err = parser.NewParser("t.qk", []byte("a[0]: Int = 1")).Parse()
+	if err == nil || !strings.Contains(err.Error(), "cannot annotate 'a[0]'") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestParser_Comments(t *testing.T) {
+	source := "// a\nx = 1 /* b */\nfor k /* c */ in x {}\n"
+	p := parser.NewParser("t.qk", []byte(source))
+	p.SetMode(parser.ScanComments)
+	chunk, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var comments []string
+	for _, comment := range p.Comments() {
+		comments = append(comments, fmt.Sprintf("%s %s-%s", comment.Value, comment.Position, comment.End))
+	}
+	expected := "// a t.qk:1:1-t.qk:1:5, /* b */ t.qk:2:7-t.qk:2:14, /* c */ t.qk:3:7-t.qk:3:14"
+	if s := strings.Join(comments, ", "); s != expected {
+		t.Fatalf("expected %s, got %s", expected, s)
+	}
+	if _, ok := chunk.Statements.List[2].(*ast.ForInStatement); !ok {
+		t.Fatalf("expected a for-in statement, got %T", chunk.Statements.List[2])
+	}
+}
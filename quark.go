@@ -30,6 +30,10 @@ const (
 	MaxIntCacheRange = 127
 
 	SourceFileExt = ".qk"
+
+	// VariadicParameters disables the argument count check of a builtin
+	// function, the function validates its arguments by itself.
+	VariadicParameters = -1
 )
 
 func ToBool(x Object) bool {
@@ -82,6 +86,8 @@ func ToInterface(x Object) (interface{}, error) {
 		return x.Value, nil
 	case *StringObject:
 		return x.Value, nil
+	case *BytesObject:
+		return x.Value, nil
 	case *ListObject:
 		return x.Value, nil
 	case *DictObject:
@@ -112,6 +118,8 @@ func FromInterface(x interface{}) (Object, error) {
 		return NewFloat(x), nil
 	case string:
 		return NewString(x), nil
+	case []byte:
+		return NewBytes(x), nil
 	case []Object:
 		return NewList(x), nil
 	case map[string]Object:
@@ -0,0 +1,83 @@
+package quark
+
+import "unicode/utf8"
+
+// runeIndexStride is the distance, in runes, between two checkpoints of a
+// runeIndex. A smaller stride trades memory for faster random access.
+const runeIndexStride = 32
+
+// runeIndex maps rune positions of a string to byte offsets. Pure ASCII
+// strings need no table at all, otherwise only every runeIndexStride-th
+// rune is recorded and the remaining ones are decoded on demand.
+type runeIndex struct {
+	length      int
+	ascii       bool
+	checkpoints []int
+}
+
+func newRuneIndex(s string) *runeIndex {
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return &runeIndex{
+			length: len(s),
+			ascii:  true,
+		}
+	}
+	index := &runeIndex{
+		checkpoints: make([]int, 0, len(s)/runeIndexStride+1),
+	}
+	for offset := range s {
+		if index.length%runeIndexStride == 0 {
+			index.checkpoints = append(index.checkpoints, offset)
+		}
+		index.length++
+	}
+	return index
+}
+
+// offset returns the byte offset of the i-th rune of s, i may be equal to
+// the rune count, in which case the length of s is returned.
+func (r *runeIndex) offset(s string, i int) int {
+	if r.ascii {
+		return i
+	}
+	if i >= r.length {
+		return len(s)
+	}
+	offset := r.checkpoints[i/runeIndexStride]
+	for n := i % runeIndexStride; n > 0; n-- {
+		_, size := utf8.DecodeRuneInString(s[offset:])
+		offset += size
+	}
+	return offset
+}
+
+// sliceBounds converts the operands of a slice expression into a checked
+// [low, high) range, a null bound selects the start or the end.
+func sliceBounds(low, high Object, length int) (int, int, error) {
+	lo, hi := 0, length
+	if _, ok := low.(*NullObject); !ok {
+		index, ok := low.(*IntObject)
+		if !ok {
+			return 0, 0, ErrInvalidIndexType
+		}
+		lo = int(index.Value)
+	}
+	if _, ok := high.(*NullObject); !ok {
+		index, ok := high.(*IntObject)
+		if !ok {
+			return 0, 0, ErrInvalidIndexType
+		}
+		hi = int(index.Value)
+	}
+	if lo < 0 || hi > length || lo > hi {
+		return 0, 0, ErrIndexOutOfRange
+	}
+	return lo, hi, nil
+}
@@ -5,12 +5,14 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/janqx/quark-lang/v1/diagnostic"
 	"github.com/janqx/quark-lang/v1/parser"
 )
 
 type Script struct {
 	ctx       *Context
 	variables map[string]*Variable
+	warnings  diagnostic.Diagnostics
 }
 
 func NewScript(ctx *Context) *Script {
@@ -50,53 +52,128 @@ func (s *Script) ExistsVariable(name string) bool {
 	return exists
 }
 
+// Warnings returns the warnings reported by the checker for the last source
+// compiled by the script.
+func (s *Script) Warnings() diagnostic.Diagnostics {
+	return s.warnings
+}
+
 func (s *Script) RunString(source string) (Object, error) {
 	compiled, err := s.compile("<repl>", source)
 	if err != nil {
 		return nil, err
 	}
-	compiled.PrintInstructionList()
-	vm := NewVM(s.ctx)
-	err = vm.Prepare(compiled.entryFunction, 0)
-	if err != nil {
-		return nil, err
-	}
-	return vm.Execute()
+	return s.run(compiled)
 }
 
+// RunFile runs a source file or a bytecode file written by Compile, source
+// files are compiled through the cache of the context.
 func (s *Script) RunFile(filename string) error {
 	var err error
 	var fullpath string
-	if ext := filepath.Ext(filename); ext != SourceFileExt {
-		return fmt.Errorf("invalid ext name: %s, except: %s", ext, SourceFileExt)
+	ext := filepath.Ext(filename)
+	if ext != SourceFileExt && ext != BytecodeFileExt {
+		return fmt.Errorf("invalid ext name: %s, except: %s or %s", ext, SourceFileExt, BytecodeFileExt)
 	}
 	if fullpath, err = filepath.Abs(filename); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(-1)
+		return err
 	}
 	source, err := os.ReadFile(fullpath)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(-1)
+		return err
 	}
-	compiled, err := s.compile(fullpath, string(source))
-	if err != nil {
+	if ext == BytecodeFileExt {
+		_, err = s.Load(source)
 		return err
 	}
-	vm := NewVM(s.ctx)
-	err = vm.Prepare(compiled.entryFunction, 0)
+	compiled, err := s.ctx.compileCached(fullpath, source, func() (*compiled, error) {
+		return s.compile(fullpath, string(source))
+	})
 	if err != nil {
 		return err
 	}
-	_, err = vm.Execute()
+	// the checker doesn't run again when the code comes from the cache
+	s.warnings = compiled.warnings
+	_, err = s.run(compiled)
 	return err
 }
 
+// Compile compiles source to bytecode, Load and RunFile run it without
+// parsing the source again.
+func (s *Script) Compile(filename string, source string) ([]byte, error) {
+	compiled, err := s.compile(filename, source)
+	if err != nil {
+		return nil, err
+	}
+	return compiled.marshal(s.ctx)
+}
+
+// Load runs bytecode produced by Compile and returns its result.
+func (s *Script) Load(data []byte) (Object, error) {
+	compiled, err := unmarshal(s.ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	return s.run(compiled)
+}
+
+// DisassembleString compiles source like RunString and returns its
+// disassembly instead of running it.
+func (s *Script) DisassembleString(source string) (string, error) {
+	compiled, err := s.compile("<repl>", source)
+	if err != nil {
+		return "", err
+	}
+	return s.ctx.Disassemble(compiled.entryFunction), nil
+}
+
+// DisassembleFile returns the disassembly of a source or bytecode file.
+func (s *Script) DisassembleFile(filename string) (string, error) {
+	fullpath, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+	source, err := os.ReadFile(fullpath)
+	if err != nil {
+		return "", err
+	}
+	var compiled *compiled
+	if filepath.Ext(filename) == BytecodeFileExt {
+		compiled, err = unmarshal(s.ctx, source)
+	} else {
+		compiled, err = s.compile(fullpath, string(source))
+	}
+	if err != nil {
+		return "", err
+	}
+	return s.ctx.Disassemble(compiled.entryFunction), nil
+}
+
+func (s *Script) run(compiled *compiled) (Object, error) {
+	s.ctx.load(compiled)
+	vm := NewVM(s.ctx)
+	if err := vm.Prepare(compiled.entryFunction, 0); err != nil {
+		return nil, err
+	}
+	return vm.Execute()
+}
+
 func (s *Script) compile(filename string, source string) (*compiled, error) {
 	p := parser.NewParser(filename, []byte(source))
 	chunk, err := p.Parse()
 	if err != nil {
 		return nil, err
 	}
-	return NewCompiler(s.ctx, nil).Compile(chunk)
+	diagnostics := NewChecker(s.ctx).Check(chunk)
+	s.warnings = diagnostics.Warnings()
+	if diagnostics.HasErrors() {
+		return nil, diagnostics.Errors()
+	}
+	compiled, err := NewCompiler(s.ctx, nil).Compile(chunk)
+	if err != nil {
+		return nil, err
+	}
+	compiled.setSource(source)
+	compiled.warnings = s.warnings
+	return compiled, nil
 }
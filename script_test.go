@@ -1,6 +1,12 @@
 package quark_test
 
 import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/janqx/quark-lang/v1"
@@ -60,11 +66,656 @@ func TestScript_RunString_Import(t *testing.T) {
 	`)
 }
 
+func TestContext_UnloadModule(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "m.qk")
+	ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+	ctx.ImportBasePath = dir
+	script := quark.NewScript(ctx)
+	for i, value := range []string{"1", "1", "3"} {
+		if err := ioutil.WriteFile(filename, []byte("export { value: "+strconv.Itoa(i+1)+" }"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if i == 2 && !ctx.UnloadModule("m.qk") {
+			t.Fatal("module wasn't loaded")
+		}
+		result, err := script.RunString(`return import("m.qk").value`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := result.ToString(); s != value {
+			t.Fatalf("#%d: unexpected result: %s", i, s)
+		}
+	}
+	if ctx.UnloadModule("missing.qk") {
+		t.Fatal("unloaded a module that wasn't loaded")
+	}
+}
+
+func TestScript_RunString_ImportWithoutExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "plain.qk"), []byte("x = 1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "m.qk"), []byte(`plain = import("plain.qk")
+export { plain: plain }`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+	ctx.ImportBasePath = dir
+	result, err := quark.NewScript(ctx).RunString(`return [import("plain.qk"), import("m.qk").plain]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := result.ToString(); s != "[null, null]" {
+		t.Fatalf("unexpected result: %s", s)
+	}
+}
+
 func TestScript_RunFile_Brainfuck(t *testing.T) {
+	// the example renders a mandelbrot set, which takes about half an hour
+	if testing.Short() {
+		t.Skip("skipping the brainfuck example in short mode")
+	}
+	dir, err := ioutil.TempDir("", "quark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
 	ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+	ctx.CacheDir = dir
 	script := quark.NewScript(ctx)
-	err := script.RunFile(`E:\jqx\projects\quark-lang\example\brainfuck.qk`)
+	err = script.RunFile("example/brainfuck.qk")
 	if err != nil {
 		panic(err)
 	}
 }
+
+func TestScript_RunString_Unicode(t *testing.T) {
+	ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+	script := quark.NewScript(ctx)
+	result, err := script.RunString(`
+s = "hello，世界！"
+n, reversed = 0, ""
+for c in s[6:] {
+  n, reversed = n + 1, c + reversed
+}
+return [length(s), s[6], s[6:8], s[:5], n, reversed, decode(encode(s)) == s, length(encode(s))]
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := result.ToString(); s != "[9, 世, 世界, hello, 3, ！界世, true, 17]" {
+		t.Fatalf("unexpected result: %s", s)
+	}
+}
+
+func TestScript_RunString_Bytes(t *testing.T) {
+	ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+	script := quark.NewScript(ctx)
+	result, err := script.RunString(`
+encoding = import("encoding")
+fn header() {
+  return b"\x01\x02"
+}
+a = header()
+a[0] = 255
+b = header()
+payload = a + b + b"ok\n"
+return [payload, payload[1:3], payload[0], length(payload), encoding.toHex(payload), decode(encoding.fromBase64(encoding.toBase64(b"hi")))]
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := result.ToString(); s != `[b"\xff\x02\x01\x02ok\n", b"\x02\x01", 255, 7, ff0201026f6b0a, hi]` {
+		t.Fatalf("unexpected result: %s", s)
+	}
+
+	value, err := quark.FromInterface([]byte{0xca, 0xfe})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw, _ := quark.ToInterface(value); string(raw.([]byte)) != "\xca\xfe" {
+		t.Fatalf("unexpected conversion: %v", raw)
+	}
+}
+
+func TestScript_RunString_Methods(t *testing.T) {
+	ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+	script := quark.NewScript(ctx)
+	result, err := script.RunString(`
+words = "  b a  c ".trim().split(" ")
+words.push("d")
+numbers = [3, 1, 2]
+numbers.sort()
+config = {port: 80}
+config.merge({host: "localhost"})
+return [",".join(words).upper(), words.pop(2), words.index("c"), numbers, config.keys(), config.get("user", "root")]
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := result.ToString(); s != "[B,A,,C,D, , 2, [1, 2, 3], [host, port], root]" {
+		t.Fatalf("unexpected result: %s", s)
+	}
+}
+
+func TestScript_RunString_Equality(t *testing.T) {
+	ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+	script := quark.NewScript(ctx)
+	result, err := script.RunString(`
+a = [1, "x", {k: [null]}]
+b = [1, "x", {k: [null]}]
+c = a
+words = ["b", "", "ab", "a"]
+words.sort()
+mixed = [[1, 2], "z", null, 2.5, [1], true, 1]
+mixed.sort()
+return [a == b, a is b, a is c, 1 == "1", null == null, 1 == 1.0, "b" < "ab", [1, 2] < [1, 3], [1] < [1, 0], words, mixed]
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := result.ToString(); s != "[true, false, true, false, true, true, false, true, true, [, a, ab, b], [null, true, 1, 2.500000000000, z, [1], [1, 2]]]" {
+		t.Fatalf("unexpected result: %s", s)
+	}
+}
+
+func TestScript_RunString_CyclicToString(t *testing.T) {
+	ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+	result, err := quark.NewScript(ctx).RunString(`
+x = [1]
+x.push(x)
+d = {k: 1}
+d.k = d
+y = [2]
+return [x, d, [d.k, y, y]]
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := result.ToString(); s != "[[1, [...]], { k: {...} }, [{ k: {...} }, [2], [2]]]" {
+		t.Fatalf("unexpected result: %s", s)
+	}
+}
+
+func TestScript_RunString_TypeErrors(t *testing.T) {
+	modules := stdlib.LoadModules()
+	modules["host"] = map[string]quark.Object{
+		"crash": quark.NewBuiltinFunction("crash", func(ctx *quark.Context, args []quark.Object) (quark.Object, error) {
+			panic("host failure")
+		}, 0),
+	}
+	ctx := quark.NewContext(quark.ModeREPL, modules)
+	script := quark.NewScript(ctx)
+	tests := []struct {
+		source  string
+		message string
+	}{
+		{"null + 1", "unsupported operand type(s) for +: 'Null' and 'Int'"},
+		{"1 - \"a\"", "unsupported operand type(s) for -: 'Int' and 'String'"},
+		{"-\"a\"", "bad operand type for unary -: 'String'"},
+		{"[1].foo", "'List' object has no attribute 'foo'"},
+		{"1[0]", "'Int' object is not subscriptable"},
+		{"for x in 5 {}", "'Int' object is not iterable"},
+		{"x = 1\nx()", "'Int' object is not callable"},
+		{"1 / 0", "division by zero"},
+		{"fn f(n) { return f(n + 1) }\nf(0)", "stack overflow"},
+		{"import(\"host\").crash()", "runtime panic: host failure"},
+	}
+	for _, test := range tests {
+		_, err := script.RunString(test.source)
+		var runtimeErr *quark.RuntimeError
+		if !errors.As(err, &runtimeErr) || runtimeErr.Message != test.message {
+			t.Fatalf("%q: expected error %q, got %v", test.source, test.message, err)
+		}
+	}
+	// the context must still be usable after the errors above
+	result, err := script.RunString("return -(1 + 2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := result.ToString(); s != "-3" {
+		t.Fatalf("unexpected result: %s", s)
+	}
+}
+
+func TestScript_MissingFile(t *testing.T) {
+	ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+	ctx.ImportBasePath = os.TempDir()
+	script := quark.NewScript(ctx)
+	// both used to exit the process
+	if _, err := script.RunString(`import("missing-module.qk")`); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("import: expected a missing file error, got %v", err)
+	}
+	if err := script.RunFile(filepath.Join(os.TempDir(), "missing-script.qk")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("RunFile: expected a missing file error, got %v", err)
+	}
+}
+
+func TestScript_RunString_ErrorPosition(t *testing.T) {
+	ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+	script := quark.NewScript(ctx)
+	_, err := script.RunString("fn get(list) {\n\treturn list[5]\n}\nget([1])")
+	var runtimeErr *quark.RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected a RuntimeError, got %v", err)
+	}
+	if runtimeErr.Line != 2 || runtimeErr.Column != 9 || !errors.Is(err, quark.ErrIndexOutOfRange) {
+		t.Fatalf("unexpected error: %#v", runtimeErr)
+	}
+	expected := "<repl>:2:9: index out of range\n    \treturn list[5]\n    \t       ^"
+	if err.Error() != expected {
+		t.Fatalf("unexpected message:\n%s", err.Error())
+	}
+}
+
+func TestScript_RunString_ErrorSourceLine(t *testing.T) {
+	ctx := quark.NewContext(quark.ModeREPL, stdlib.LoadModules())
+	script := quark.NewScript(ctx)
+	// the line comes from the input which defined f, not from the last one
+	if _, err := script.RunString("f = fn() {\n  return null + 1\n}"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := script.RunString("x = 5\ny = 6\nf()")
+	var runtimeErr *quark.RuntimeError
+	if !errors.As(err, &runtimeErr) || runtimeErr.Line != 2 || runtimeErr.SourceLine != "  return null + 1" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// bytecode can name any file, it must not be read
+	dir, err := ioutil.TempDir("", "quark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "secret.txt")
+	if err := ioutil.WriteFile(filename, []byte("password"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	data, err := script.Compile(filename, "x = null + 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = quark.NewScript(quark.NewContext(quark.ModeNormal, stdlib.LoadModules())).Load(data)
+	if !errors.As(err, &runtimeErr) || runtimeErr.Line != 1 || runtimeErr.SourceLine != "" || strings.Contains(err.Error(), "password") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestScript_RunString_Traceback(t *testing.T) {
+	ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+	script := quark.NewScript(ctx)
+	_, err := script.RunString(`fn inner(x) { return length(x) }
+outer = fn(x) {
+  return inner(x)
+}
+outer(1)`)
+	var traceback *quark.Traceback
+	if !errors.As(err, &traceback) {
+		t.Fatalf("expected a traceback, got %v", err)
+	}
+	expected := `Traceback (most recent call last):
+  File "<repl>", line 5, in <compiled-function entry>
+  File "<repl>", line 3, in <closure #2>
+  File "<repl>", line 1, in inner
+  File "<builtin>", in length`
+	if s := traceback.String(); s != expected {
+		t.Fatalf("unexpected traceback:\n%s", s)
+	}
+}
+
+func TestScript_RunString_Check(t *testing.T) {
+	ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+	script := quark.NewScript(ctx)
+	_, err := script.RunString(`fn f(x) {
+  if x { export x }
+  return undefined
+}
+break`)
+	expected := `<repl>:2:10: error: 'export' outside the top level
+<repl>:3:10: error: undeclared identifier 'undefined'
+<repl>:5:1: error: 'break' outside loop`
+	if err == nil || err.Error() != expected {
+		t.Fatalf("unexpected error:\n%v", err)
+	}
+
+	_, err = script.RunString(`fn f(length) {
+  unused = 1
+  return length
+  println("never")
+}
+f(1)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `<repl>:1:1: warning: parameter 'length' shadows the global 'length'
+<repl>:2:3: warning: variable 'unused' is declared but never used
+    hint: rename it to '_unused' if this is intentional
+<repl>:4:3: warning: unreachable code`
+	if s := script.Warnings().Error(); s != expected {
+		t.Fatalf("unexpected warnings:\n%s", s)
+	}
+
+	_, err = script.RunString(`fn g(x) {
+  if x { return 1 } else { return 2 }
+  println("never")
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := script.Warnings().Error(); s != "<repl>:3:3: warning: unreachable code" {
+		t.Fatalf("unexpected warnings:\n%s", s)
+	}
+}
+
+func TestScript_RunString_TypeAnnotations(t *testing.T) {
+	ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+	script := quark.NewScript(ctx)
+	result, err := script.RunString(`fn add(a: Int, b: Int) -> Int { return a + b }
+x: List[Int] = [add(1, 2)]
+f = fn(y: Int?) -> Int { return y }
+return f(x[0])`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := result.ToString(); s != "3" {
+		t.Fatalf("unexpected result: %s", s)
+	}
+}
+
+func TestScript_RunString_OptimizationLevels(t *testing.T) {
+	source := `x = 60 * 60 * 24
+if false { x = 0 } else if x > 2 { x = x + 1 } else { x = -1 }
+total = 0
+for i in [1, 2, 3] {
+  if i == 3 { break }
+  if !(true && i > 1) { continue }
+  total = total + i
+}
+return [x, total, 1 < 2 ? "yes" : "no", false || null]`
+	for _, level := range []quark.OptimizationLevel{quark.OptimizeNone, quark.OptimizeBasic, quark.OptimizeFull} {
+		ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+		ctx.OptimizationLevel = level
+		result, err := quark.NewScript(ctx).RunString(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := result.ToString(); s != "[86401, 2, yes, null]" {
+			t.Fatalf("level %d: unexpected result: %s", level, s)
+		}
+	}
+}
+
+func TestScript_RunString_FoldedBytes(t *testing.T) {
+	// a folded constant is copied like a literal, changing the result
+	// must not change the constant
+	source := `fn f() {
+  x = b"ab" + b"c"
+  x[0] = x[0] + 1
+  return x
+}
+fn g() { return b"abc" }
+return [f(), f(), g()]`
+	for _, level := range []quark.OptimizationLevel{quark.OptimizeNone, quark.OptimizeBasic, quark.OptimizeFull} {
+		ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+		ctx.OptimizationLevel = level
+		result, err := quark.NewScript(ctx).RunString(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := result.ToString(); s != `[b"bbc", b"bbc", b"abc"]` {
+			t.Fatalf("level %d: unexpected result: %s", level, s)
+		}
+	}
+}
+
+func TestScript_RunString_Superinstructions(t *testing.T) {
+	source := `fn f(n) {
+  total = 0
+  for i = 0; i < n; i = i + 1 {
+    if i >= 3 { total = total + 1 }
+    total = total * 2
+  }
+  s = "a"
+  if s == "a" { s = s + "b" }
+  return [total, s, n < 2.5, n + 0.5]
+}
+return f(5)`
+	for _, level := range []quark.OptimizationLevel{quark.OptimizeBasic, quark.OptimizeFull} {
+		ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+		ctx.OptimizationLevel = level
+		result, err := quark.NewScript(ctx).RunString(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := result.ToString(); s != "[6, ab, false, 5]" {
+			t.Fatalf("level %d: unexpected result: %s", level, s)
+		}
+	}
+}
+
+// benchmarkFusion runs source compiled with and without superinstructions,
+// the context is set up and the source compiled before the timer starts.
+func benchmarkFusion(b *testing.B, source string) {
+	// the output of the programs isn't measured
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer devNull.Close()
+	stdout := os.Stdout
+	os.Stdout = devNull
+	defer func() {
+		os.Stdout = stdout
+	}()
+	for _, fused := range []bool{false, true} {
+		name := "unfused"
+		if fused {
+			name = "fused"
+		}
+		b.Run(name, func(b *testing.B) {
+			ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+			quark.SetFusion(ctx, fused)
+			run, err := quark.NewScript(ctx).Prepare(source)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := run(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkScript_Fib(b *testing.B) {
+	benchmarkFusion(b, `fn fib(n) {
+  if n < 3 { return 1 }
+  return fib(n - 1) + fib(n - 2)
+}
+return fib(35)`)
+}
+
+// squares is a brainfuck program by Daniel B. Cristofani printing the
+// squares from 0 to 10000, about 1.4 million brainfuck instructions.
+const squares = `++++[>+++++<-]>[<+++++>-]+<+[>[>+>+<<-]++>>[<<+>>-]>>>[-]++>[-]+>>>+[[-]++++++>>>]
+<<<[[<++++++++<++>>-]+<.<[>----<-]<]<<[>>>>>[>>>[-]+++++++++<[>-<-]+++++++++>[-[<->-]
++[<<<]]<[>+<-]>]<<-]<<-]`
+
+func BenchmarkScript_Brainfuck(b *testing.B) {
+	source, err := ioutil.ReadFile("example/brainfuck.qk")
+	if err != nil {
+		b.Fatal(err)
+	}
+	// the mandelbrot program of the example takes half an hour
+	s := string(source)
+	s = s[:strings.Index(s, "execute(`")] + "execute(`" + squares + "`)\n"
+	benchmarkFusion(b, s)
+}
+
+func TestScript_Compile_Load(t *testing.T) {
+	source := `fn make(k) {
+  return fn(x) { return x * k + 1 }
+}
+f = make(3)
+s = ""
+for i = 0; i < 3; i = i + 1 { s = s + to_string(i) }
+return [f(2), length("héllo"), b"ab", 1.25, s]`
+	data, err := quark.NewScript(quark.NewContext(quark.ModeNormal, stdlib.LoadModules())).Compile("test.qk", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the globals of another context have different indexes
+	ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+	result, err := quark.NewScript(ctx).Load(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := result.ToString(); s != "[7, 5, b\"ab\", 1.250000000000, 012]" {
+		t.Fatalf("unexpected result: %s", s)
+	}
+
+	dir, err := ioutil.TempDir("", "quark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "test"+quark.BytecodeFileExt)
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := quark.NewScript(ctx).RunFile(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, invalid := range [][]byte{nil, data[:len(data)/2], append(data, 0), []byte("QKC\x00\x04")} {
+		if _, err := quark.NewScript(ctx).Load(invalid); !errors.Is(err, quark.ErrInvalidBytecode) {
+			t.Errorf("%q: unexpected error %v", invalid, err)
+		}
+	}
+}
+
+func TestContext_CompileCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "m.qk")
+	cached := filepath.Join(dir, quark.DefaultCacheDir, "m"+quark.BytecodeFileExt)
+
+	run := func(ctx *quark.Context, expected string) {
+		t.Helper()
+		ctx.ImportBasePath = dir
+		result, err := quark.NewScript(ctx).RunString(`return import("m.qk").value`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := result.ToString(); s != expected {
+			t.Fatalf("unexpected result: %s, expected %s", s, expected)
+		}
+	}
+	write := func(filename string, content string) {
+		t.Helper()
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(filename, "export { value: 1 }")
+	run(quark.NewContext(quark.ModeNormal, stdlib.LoadModules()), "1")
+	info, err := os.Stat(cached)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// an unchanged source is loaded from the cache, which isn't rewritten
+	run(quark.NewContext(quark.ModeNormal, stdlib.LoadModules()), "1")
+	if again, err := os.Stat(cached); err != nil || !again.ModTime().Equal(info.ModTime()) {
+		t.Fatal("the cache was rewritten")
+	}
+
+	write(filename, "export { value: 2 }")
+	run(quark.NewContext(quark.ModeNormal, stdlib.LoadModules()), "2")
+
+	write(cached, "garbage")
+	run(quark.NewContext(quark.ModeNormal, stdlib.LoadModules()), "2")
+
+	relocated := filepath.Join(dir, "cache")
+	ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+	ctx.CacheDir = relocated
+	run(ctx, "2")
+	if files, _ := ioutil.ReadDir(relocated); len(files) != 1 {
+		t.Fatalf("unexpected files in the relocated cache: %v", files)
+	}
+
+	os.RemoveAll(filepath.Join(dir, quark.DefaultCacheDir))
+	ctx = quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+	ctx.DisableCache = true
+	run(ctx, "2")
+	if _, err := os.Stat(cached); !os.IsNotExist(err) {
+		t.Fatal("the cache was written although it is disabled")
+	}
+
+	// the warnings of the checker are cached with the code
+	write(filename, `fn f() { unused = 1 }`)
+	expected := filename + `:1:10: warning: variable 'unused' is declared but never used
+    hint: rename it to '_unused' if this is intentional`
+	for i := 0; i < 2; i++ {
+		script := quark.NewScript(quark.NewContext(quark.ModeNormal, stdlib.LoadModules()))
+		if err := script.RunFile(filename); err != nil {
+			t.Fatal(err)
+		}
+		if s := script.Warnings().Error(); s != expected {
+			t.Fatalf("unexpected warnings:\n%s", s)
+		}
+		again, err := os.Stat(cached)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 && !again.ModTime().Equal(info.ModTime()) {
+			t.Fatal("the cache wasn't used")
+		}
+		info = again
+	}
+}
+
+func TestScript_DisassembleString(t *testing.T) {
+	ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+	text, err := quark.NewScript(ctx).DisassembleString(`fn add(a, b) {
+  return a + b
+}
+s = "hi"
+for i in [1, 2] { s = s + to_string(add(i, 1)) }
+return s`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"function <compiled-function entry>() in <repl>:\n    1 | fn add(a, b) {\n",
+		" (<function add>)\n",
+		"    4 | s = \"hi\"\n",
+		"(\"hi\")\n",
+		"OpStoreLocal            1 (s)\n",
+		"OpLoadGlobal            ",
+		" (to_string)\n",
+		"L0:\n",
+		"OpIterNext              L1\n",
+		"function add(a, b) in <repl>:\n    2 | return a + b\n",
+		"OpLoadLocal             0 (a)\n",
+	} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("%q not in disassembly:\n%s", expected, text)
+		}
+	}
+}
@@ -0,0 +1,417 @@
+package quark
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	BytecodeFileExt = ".qkc"
+
+	// BytecodeVersion is incremented whenever the encoding or the
+	// instruction set changes, files of other versions are rejected.
+	BytecodeVersion = 2
+)
+
+var bytecodeMagic = []byte("QKC\x00")
+
+var ErrInvalidBytecode = errors.New("invalid bytecode")
+
+const (
+	constantInt byte = iota + 1
+	constantFloat
+	constantString
+	constantBytes
+	constantFunction
+)
+
+// A bytecode file holds, after the magic and the version:
+//
+//	globals    the names of the globals it uses, global operands index
+//	           this list and are linked to the globals of the context by
+//	           name when the file is loaded
+//	functions  the entry function first, each with its name, filename,
+//	           parameter names, symbol table, local names, instructions
+//	           and line table
+//	constants  the pool shared by the functions
+//
+// Integers are varints, strings and byte strings are prefixed by their
+// length.
+
+func isGlobalOpcode(opcode Opcode) bool {
+	return opcode == OpLoadGlobal || opcode == OpStoreGlobal
+}
+
+// relinkGlobals replaces the operand of every global instruction in code
+// by relink(operand), the new operand must fit in the same instruction.
+func relinkGlobals(code []Instruction, relink func(Operand) (Operand, error)) error {
+	for i := 0; i < len(code); i++ {
+		prefixed := code[i].Opcode() == OpExtendedArg && i+1 < len(code)
+		inst := code[i]
+		operand := inst.Operand()
+		if prefixed {
+			inst = code[i+1]
+			operand = operand<<24 | inst.Operand()
+		}
+		if isGlobalOpcode(inst.Opcode()) {
+			operand, err := relink(operand)
+			if err != nil {
+				return err
+			}
+			if prefixed {
+				code[i] = NewInstruction(OpExtendedArg, operand>>24)
+				code[i+1] = NewInstruction(inst.Opcode(), operand)
+			} else if operand > InvalidOperand {
+				return fmt.Errorf("global index %d doesn't fit in an instruction", operand)
+			} else {
+				code[i] = NewInstruction(inst.Opcode(), operand)
+			}
+		}
+		if prefixed {
+			i++
+		}
+	}
+	return nil
+}
+
+type bytecodeWriter struct {
+	bytes.Buffer
+}
+
+func (w *bytecodeWriter) int(value int) {
+	var buf [binary.MaxVarintLen64]byte
+	w.Write(buf[:binary.PutVarint(buf[:], int64(value))])
+}
+
+func (w *bytecodeWriter) string(value string) {
+	w.int(len(value))
+	w.WriteString(value)
+}
+
+// marshal encodes the compiled chunk, the globals it uses are looked up
+// in the symbol table of ctx.
+func (c *compiled) marshal(ctx *Context) ([]byte, error) {
+	globalNames := make(map[int]string)
+	for name, symbol := range ctx.globalSymbolTable.Symbols {
+		if symbol.Scope == ScopeGlobal {
+			globalNames[symbol.Index] = name
+		}
+	}
+
+	// globals are numbered in the order of their index, so a global never
+	// gets a larger operand than it had
+	var used []int
+	seen := make(map[int]bool)
+	for _, fn := range c.compiledFunctions {
+		relinkGlobals(append([]Instruction(nil), fn.Instructions...), func(operand Operand) (Operand, error) {
+			if !seen[int(operand)] {
+				seen[int(operand)] = true
+				used = append(used, int(operand))
+			}
+			return operand, nil
+		})
+	}
+	sort.Ints(used)
+	globals := make(map[int]int, len(used))
+	for i, index := range used {
+		globals[index] = i
+	}
+
+	functions := make(map[*CompiledFunctionObject]int, len(c.compiledFunctions))
+	for i, fn := range c.compiledFunctions {
+		functions[fn] = i
+	}
+
+	w := &bytecodeWriter{}
+	w.Write(bytecodeMagic)
+	w.int(BytecodeVersion)
+
+	w.int(len(used))
+	for _, index := range used {
+		w.string(globalNames[index])
+	}
+
+	w.int(len(c.compiledFunctions))
+	for _, fn := range c.compiledFunctions {
+		w.string(fn.Name)
+		w.string(fn.Filename)
+		w.int(len(fn.ParameterNames))
+		for _, name := range fn.ParameterNames {
+			w.string(name)
+		}
+
+		w.int(fn.SymbolTable.LocalCount)
+		w.int(fn.SymbolTable.OuterCount)
+		names := make([]string, 0, len(fn.SymbolTable.Symbols))
+		for name, symbol := range fn.SymbolTable.Symbols {
+			if symbol.Scope != ScopeGlobal {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		w.int(len(names))
+		for _, name := range names {
+			symbol := fn.SymbolTable.Symbols[name]
+			w.string(name)
+			w.int(int(symbol.Scope))
+			w.int(symbol.Index)
+			w.int(int(symbol.OuterScope))
+			w.int(symbol.OuterIndex)
+		}
+		w.int(len(fn.SymbolTable.LocalNames))
+		for _, name := range fn.SymbolTable.LocalNames {
+			w.string(name)
+		}
+
+		code := append([]Instruction(nil), fn.Instructions...)
+		relinkGlobals(code, func(operand Operand) (Operand, error) {
+			return Operand(globals[int(operand)]), nil
+		})
+		w.int(len(code))
+		for _, inst := range code {
+			binary.Write(w, binary.LittleEndian, uint32(inst))
+		}
+
+		w.int(len(fn.Lines.Entries))
+		for _, entry := range fn.Lines.Entries {
+			w.int(entry.PC)
+			w.int(entry.Line)
+			w.int(entry.Column)
+		}
+	}
+
+	constants := c.entryFunction.Constants
+	w.int(len(constants))
+	for _, value := range constants {
+		switch value := value.(type) {
+		case *IntObject:
+			w.WriteByte(constantInt)
+			var buf [binary.MaxVarintLen64]byte
+			w.Write(buf[:binary.PutVarint(buf[:], value.Value)])
+		case *FloatObject:
+			w.WriteByte(constantFloat)
+			binary.Write(w, binary.LittleEndian, math.Float64bits(value.Value))
+		case *StringObject:
+			w.WriteByte(constantString)
+			w.string(value.Value)
+		case *BytesObject:
+			w.WriteByte(constantBytes)
+			w.string(string(value.Value))
+		case *CompiledFunctionObject:
+			index, ok := functions[value]
+			if !ok {
+				return nil, fmt.Errorf("constant function '%s' wasn't compiled with the chunk", value.Name)
+			}
+			w.WriteByte(constantFunction)
+			w.int(index)
+		default:
+			return nil, fmt.Errorf("constant of type '%s' can't be serialized", value.TypeName())
+		}
+	}
+	return w.Bytes(), nil
+}
+
+type bytecodeReader struct {
+	*bytes.Reader
+	err error
+}
+
+func (r *bytecodeReader) fail(format string, args ...interface{}) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%w: %s", ErrInvalidBytecode, fmt.Sprintf(format, args...))
+	}
+}
+
+func (r *bytecodeReader) int() int {
+	if r.err != nil {
+		return 0
+	}
+	value, err := binary.ReadVarint(r)
+	if err != nil || value < math.MinInt32 || value > math.MaxInt32 {
+		r.fail("bad integer")
+		return 0
+	}
+	return int(value)
+}
+
+// count reads a length, which can't be larger than the bytes left.
+func (r *bytecodeReader) count() int {
+	n := r.int()
+	if n < 0 || n > r.Len() {
+		r.fail("bad length %d", n)
+		return 0
+	}
+	return n
+}
+
+func (r *bytecodeReader) string() string {
+	n := r.count()
+	if r.err != nil {
+		return ""
+	}
+	buf := make([]byte, n)
+	r.Read(buf)
+	return string(buf)
+}
+
+func (r *bytecodeReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	b, err := r.ReadByte()
+	if err != nil {
+		r.fail("unexpected end")
+	}
+	return b
+}
+
+func (r *bytecodeReader) uint32() uint32 {
+	if r.err != nil {
+		return 0
+	}
+	var value uint32
+	if err := binary.Read(r, binary.LittleEndian, &value); err != nil {
+		r.fail("unexpected end")
+	}
+	return value
+}
+
+func (r *bytecodeReader) uint64() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	var value uint64
+	if err := binary.Read(r, binary.LittleEndian, &value); err != nil {
+		r.fail("unexpected end")
+	}
+	return value
+}
+
+// unmarshal decodes a chunk encoded by marshal, its globals are linked to
+// the globals of ctx, missing ones are added.
+func unmarshal(ctx *Context, data []byte) (*compiled, error) {
+	if !bytes.HasPrefix(data, bytecodeMagic) {
+		return nil, fmt.Errorf("%w: not a bytecode file", ErrInvalidBytecode)
+	}
+	r := &bytecodeReader{Reader: bytes.NewReader(data[len(bytecodeMagic):])}
+	if version := r.int(); r.err == nil && version != BytecodeVersion {
+		return nil, fmt.Errorf("%w: version %d isn't supported, expected %d", ErrInvalidBytecode, version, BytecodeVersion)
+	}
+
+	globals := make([]Operand, r.count())
+	for i := range globals {
+		name := r.string()
+		if r.err == nil {
+			globals[i] = Operand(ctx.addGlobalSymbol(name).Index)
+		}
+	}
+
+	functions := make([]*CompiledFunctionObject, r.count())
+	for i := range functions {
+		fn := &CompiledFunctionObject{
+			Name:     r.string(),
+			Filename: r.string(),
+		}
+		fn.ParameterNames = make([]string, r.count())
+		for k := range fn.ParameterNames {
+			fn.ParameterNames[k] = r.string()
+		}
+
+		fn.SymbolTable = NewSymbolTable(nil, TypeFunction)
+		fn.SymbolTable.LocalCount = r.int()
+		fn.SymbolTable.OuterCount = r.int()
+		for k, n := 0, r.count(); k < n; k++ {
+			symbol := &Symbol{
+				Name:       r.string(),
+				Scope:      SymbolScope(r.int()),
+				Index:      r.int(),
+				OuterScope: SymbolScope(r.int()),
+				OuterIndex: r.int(),
+				Owner:      fn.SymbolTable,
+			}
+			fn.SymbolTable.Symbols[symbol.Name] = symbol
+		}
+		fn.SymbolTable.LocalNames = make([]string, r.count())
+		for k := range fn.SymbolTable.LocalNames {
+			fn.SymbolTable.LocalNames[k] = r.string()
+		}
+
+		fn.Instructions = make([]Instruction, r.count())
+		for k := range fn.Instructions {
+			fn.Instructions[k] = Instruction(r.uint32())
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		err := relinkGlobals(fn.Instructions, func(operand Operand) (Operand, error) {
+			if int(operand) >= len(globals) {
+				return 0, fmt.Errorf("%w: global %d isn't declared", ErrInvalidBytecode, operand)
+			}
+			return globals[operand], nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for k, n := 0, r.count(); k < n; k++ {
+			fn.Lines.Entries = append(fn.Lines.Entries, LineTableEntry{
+				PC:     r.int(),
+				Line:   r.int(),
+				Column: r.int(),
+			})
+		}
+		functions[i] = fn
+	}
+	if r.err == nil && len(functions) == 0 {
+		r.fail("no entry function")
+	}
+
+	constants := make([]Object, r.count())
+	for i := range constants {
+		switch tag := r.byte(); tag {
+		case constantInt:
+			value, err := binary.ReadVarint(r)
+			if err != nil {
+				r.fail("bad integer")
+			}
+			constants[i] = NewInt(value)
+		case constantFloat:
+			constants[i] = NewFloat(math.Float64frombits(r.uint64()))
+		case constantString:
+			constants[i] = NewString(r.string())
+		case constantBytes:
+			constants[i] = NewBytes([]byte(r.string()))
+		case constantFunction:
+			index := r.int()
+			if index < 0 || index >= len(functions) {
+				r.fail("bad function %d", index)
+			} else {
+				constants[i] = functions[index]
+			}
+		default:
+			r.fail("bad constant tag %d", tag)
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.Len() > 0 {
+		return nil, fmt.Errorf("%w: %d trailing bytes", ErrInvalidBytecode, r.Len())
+	}
+	for _, fn := range functions {
+		fn.Constants = constants
+	}
+	for _, fn := range functions {
+		if err := ctx.Verify(fn); err != nil {
+			return nil, err
+		}
+	}
+	return &compiled{
+		entryFunction:     functions[0],
+		compiledFunctions: functions,
+	}, nil
+}
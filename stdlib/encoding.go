@@ -0,0 +1,75 @@
+package stdlib
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/janqx/quark-lang/v1"
+)
+
+var encodingModule = map[string]quark.Object{
+	"toHex":      quark.NewBuiltinFunction("toHex", _toHex, 1),
+	"fromHex":    quark.NewBuiltinFunction("fromHex", _fromHex, 1),
+	"toBase64":   quark.NewBuiltinFunction("toBase64", _toBase64, 1),
+	"fromBase64": quark.NewBuiltinFunction("fromBase64", _fromBase64, 1),
+}
+
+func _toHex(ctx *quark.Context, args []quark.Object) (quark.Object, error) {
+	value, ok := args[0].(*quark.BytesObject)
+	if !ok {
+		return nil, quark.ErrInvalidArgument{
+			Name:     "bytes",
+			Expected: "Bytes",
+			Found:    args[0].TypeName(),
+		}
+	}
+
+	return quark.NewString(hex.EncodeToString(value.Value)), nil
+}
+
+func _fromHex(ctx *quark.Context, args []quark.Object) (quark.Object, error) {
+	value, ok := args[0].(*quark.StringObject)
+	if !ok {
+		return nil, quark.ErrInvalidArgument{
+			Name:     "string",
+			Expected: "String",
+			Found:    args[0].TypeName(),
+		}
+	}
+
+	result, err := hex.DecodeString(value.Value)
+	if err != nil {
+		return nil, err
+	}
+	return quark.NewBytes(result), nil
+}
+
+func _toBase64(ctx *quark.Context, args []quark.Object) (quark.Object, error) {
+	value, ok := args[0].(*quark.BytesObject)
+	if !ok {
+		return nil, quark.ErrInvalidArgument{
+			Name:     "bytes",
+			Expected: "Bytes",
+			Found:    args[0].TypeName(),
+		}
+	}
+
+	return quark.NewString(base64.StdEncoding.EncodeToString(value.Value)), nil
+}
+
+func _fromBase64(ctx *quark.Context, args []quark.Object) (quark.Object, error) {
+	value, ok := args[0].(*quark.StringObject)
+	if !ok {
+		return nil, quark.ErrInvalidArgument{
+			Name:     "string",
+			Expected: "String",
+			Found:    args[0].TypeName(),
+		}
+	}
+
+	result, err := base64.StdEncoding.DecodeString(value.Value)
+	if err != nil {
+		return nil, err
+	}
+	return quark.NewBytes(result), nil
+}
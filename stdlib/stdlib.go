@@ -3,12 +3,13 @@ package stdlib
 import "github.com/janqx/quark-lang/v1"
 
 var modules = map[string]map[string]quark.Object{
-	"fmt":     nil,
-	"os":      nil,
-	"math":    mathModule,
-	"time":    nil,
-	"strings": stringsModule,
-	"arrays":  arraysModule,
+	"fmt":      nil,
+	"os":       nil,
+	"math":     mathModule,
+	"time":     nil,
+	"strings":  stringsModule,
+	"arrays":   arraysModule,
+	"encoding": encodingModule,
 }
 
 func LoadModules() map[string]map[string]quark.Object {
@@ -33,6 +33,7 @@ type SymbolTable struct {
 	LocalCount  int
 	OuterCount  int
 	GlobalCount int
+	LocalNames  []string // by index, of the function's locals including those of its blocks
 }
 
 func NewSymbolTable(parent *SymbolTable, stt SymbolTableType) *SymbolTable {
@@ -63,6 +64,14 @@ func (s *SymbolTable) AddLocalSymbol(name string) *Symbol {
 	}
 	s.Symbols[name] = symbol
 	s.LocalCount++
+	owner := s
+	if s.Owner != nil {
+		owner = s.Owner
+	}
+	for len(owner.LocalNames) <= symbol.Index {
+		owner.LocalNames = append(owner.LocalNames, "")
+	}
+	owner.LocalNames[symbol.Index] = name
 	return symbol
 }
 
@@ -1,16 +1,30 @@
 package tokenize
 
+import "fmt"
+
 type Position struct {
 	Filename string
-	Offset   int // offset, starting at 0
+	Offset   int // byte offset, starting at 0
 	Line     int // line, starting at 1
 	Column   int // column, starting at 1
 }
 
-func (p *Position) IsValid() bool {
+func (p Position) IsValid() bool {
 	return p.Filename != "" && p.Offset >= 0 && p.Line > 0 && p.Column > 0
 }
 
-func (p *Position) String() string {
-	return ""
+// String formats the position as "file:line:col", parts that are unknown
+// are left out, "-" stands for no position at all.
+func (p Position) String() string {
+	s := p.Filename
+	if p.Line > 0 {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	if s == "" {
+		s = "-"
+	}
+	return s
 }
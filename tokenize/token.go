@@ -8,6 +8,7 @@ const (
 	TokenEof TokenType = iota
 
 	TokenNewline // \n
+	TokenComment // a // or /* */ comment, only produced on request
 
 	// separators
 	TokenOpenBracket  // [
@@ -21,6 +22,7 @@ const (
 	TokenColon        // :
 	TokenQuestion     // ?
 	TokenDot          // .
+	TokenArrow        // ->
 
 	// operators
 	TokenAssign   // =
@@ -62,6 +64,8 @@ const (
 	TokenImport
 	TokenExport
 	TokenDebugger
+	TokenIn
+	TokenIs
 
 	// identitie
 	TokenIdentifier
@@ -70,12 +74,14 @@ const (
 	TokenLiteralInt
 	TokenLiteralFloat
 	TokenLiteralString
+	TokenLiteralBytes
 )
 
 var TokenTypeToString = map[TokenType]string{
 	TokenEof: "<eof>",
 
 	TokenNewline: "<newline>", // \n
+	TokenComment: "<comment>",
 
 	// operators
 	TokenOpenBracket:  "[",
@@ -89,6 +95,7 @@ var TokenTypeToString = map[TokenType]string{
 	TokenColon:        ":",
 	TokenQuestion:     "?",
 	TokenDot:          ".",
+	TokenArrow:        "->",
 	TokenAssign:       "=",
 	TokenPlus:         "+",
 	TokenMinus:        "-",
@@ -128,6 +135,8 @@ var TokenTypeToString = map[TokenType]string{
 	TokenImport:   "__import__",
 	TokenExport:   "export",
 	TokenDebugger: "debugger",
+	TokenIn:       "in",
+	TokenIs:       "is",
 
 	// identitie
 	TokenIdentifier: "<identifier>",
@@ -136,6 +145,7 @@ var TokenTypeToString = map[TokenType]string{
 	TokenLiteralInt:    "<literal-int>",
 	TokenLiteralFloat:  "<literal-float>",
 	TokenLiteralString: "<literal-string>",
+	TokenLiteralBytes:  "<literal-bytes>",
 }
 
 var SeparatorToTokenType = map[rune]TokenType{
@@ -203,6 +213,8 @@ var KeywordToTokenType = map[string]TokenType{
 	"__import__": TokenImport,
 	"export":     TokenExport,
 	"debugger":   TokenDebugger,
+	"in":         TokenIn,
+	"is":         TokenIs,
 }
 
 func (tt TokenType) String() string {
@@ -213,6 +225,7 @@ type Token struct {
 	Type     TokenType
 	Value    interface{} // int64 float64 string
 	Position *Position
+	End      *Position // just past the last character of the token
 }
 
 func (t *Token) IsNewLine() bool {
@@ -224,6 +237,7 @@ func (t *Token) Clone() *Token {
 		Type:     t.Type,
 		Value:    t.Value,
 		Position: t.Position,
+		End:      t.End,
 	}
 }
 
@@ -237,6 +251,10 @@ func (t *Token) String() (s string) {
 		s += fmt.Sprintf("<literal-float %f>", t.Value.(float64))
 	} else if t.Type == TokenLiteralString {
 		s += fmt.Sprintf("<literal-string %s>", t.Value.(string))
+	} else if t.Type == TokenComment {
+		s += fmt.Sprintf("<comment %s>", t.Value.(string))
+	} else if t.Type == TokenLiteralBytes {
+		s += fmt.Sprintf("<literal-bytes %s>", t.Value.(string))
 	} else {
 		s += TokenTypeToString[t.Type]
 	}
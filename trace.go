@@ -0,0 +1,187 @@
+package quark
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// TraceFormat is the format of the entries written by a Tracer.
+type TraceFormat uint8
+
+const (
+	TraceText TraceFormat = iota // one aligned line per instruction
+	TraceJSON                    // JSON Lines, one object per instruction
+)
+
+// DefaultTraceStackSize is how many values of the top of the stack an
+// entry shows when Tracer.StackSize is 0.
+const DefaultTraceStackSize = 4
+
+// maxTraceValueLength is the number of runes a stack value is cut to.
+const maxTraceValueLength = 32
+
+// Tracer logs every instruction executed by a context before it runs, it
+// is set with the Tracer option of the context. An entry holds the
+// function, ip, opcode, operand, source line and the top of the operand
+// stack of the call.
+type Tracer struct {
+	Writer    io.Writer
+	Format    TraceFormat
+	Functions []string // only trace these functions if not empty
+	Modules   []string // only trace the functions of these files if not empty, "lib" matches "/src/lib.qk"
+	StackSize int      // the number of stack values shown, DefaultTraceStackSize if 0 and none if negative
+
+	err error
+}
+
+// TraceEntry is an entry of the JSON Lines format.
+type TraceEntry struct {
+	Function string   `json:"function"`
+	Filename string   `json:"file"`
+	Line     int      `json:"line"`
+	IP       int      `json:"ip"`
+	Depth    int      `json:"depth"` // of the call, the entry function is 1
+	Opcode   string   `json:"opcode"`
+	Operand  *int     `json:"operand,omitempty"`
+	Stack    []string `json:"stack"`            // from the bottom to the top
+	Elided   int      `json:"elided,omitempty"` // values below those of Stack
+	Source   string   `json:"source,omitempty"`
+}
+
+// Err returns the first error of the writer, nothing is written after it.
+func (t *Tracer) Err() error {
+	return t.err
+}
+
+func (t *Tracer) traced(fn *CompiledFunctionObject) bool {
+	if len(t.Functions) > 0 && !containsString(t.Functions, fn.Name) {
+		return false
+	}
+	if len(t.Modules) == 0 {
+		return true
+	}
+	base := filepath.Base(fn.Filename)
+	module := strings.TrimSuffix(base, filepath.Ext(base))
+	for _, name := range t.Modules {
+		if name == fn.Filename || name == base || name == module ||
+			strings.HasSuffix(fn.Filename, "/"+name) || strings.HasSuffix(fn.Filename, "\\"+name) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// trace is called by the VM once the instruction at ctx.ip was decoded.
+func (t *Tracer) trace(ctx *Context, opcode Opcode, operand Operand) {
+	frame := ctx.currentFrame
+	fn := frame.fn
+	if t.err != nil || !t.traced(fn) {
+		return
+	}
+	ip := ctx.ip
+	if ip > 0 && fn.Instructions[ip-1].Opcode() == OpExtendedArg {
+		ip--
+	}
+	entry := &TraceEntry{
+		Function: fn.Name,
+		Filename: fn.Filename,
+		IP:       ip,
+		Depth:    ctx.fp,
+		Opcode:   opcode.String(),
+		Stack:    []string{},
+	}
+	if ip < ctx.ip || operand.isValid() {
+		value := int(operand)
+		entry.Operand = &value
+	}
+	entry.Line, _ = fn.Lines.Lookup(ip)
+	if entry.Line > 0 {
+		entry.Source = strings.TrimSpace(fn.sourceLine(entry.Line))
+	}
+	size := t.StackSize
+	if size == 0 {
+		size = DefaultTraceStackSize
+	}
+	bottom := frame.bp + fn.SymbolTable.LocalCount
+	if size > 0 && ctx.sp-bottom > size {
+		entry.Elided = ctx.sp - bottom - size
+		bottom = ctx.sp - size
+	} else if size < 0 {
+		entry.Elided = ctx.sp - bottom
+		bottom = ctx.sp
+	}
+	for i := bottom; i < ctx.sp; i++ {
+		entry.Stack = append(entry.Stack, traceValue(ctx.stack[i]))
+	}
+
+	var buf bytes.Buffer
+	if t.Format == TraceJSON {
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		encoder.Encode(entry)
+	} else {
+		buf.WriteString(entry.String())
+	}
+	_, t.err = t.Writer.Write(buf.Bytes())
+}
+
+// String formats the entry as a line of the text format.
+func (e *TraceEntry) String() string {
+	var b strings.Builder
+	location := filepath.Base(e.Filename) + ":" + strconv.Itoa(e.Line)
+	fmt.Fprintf(&b, "%-16s %-25s %5d  %-22s", location, e.Function, e.IP, e.Opcode)
+	operand := ""
+	if e.Operand != nil {
+		operand = strconv.Itoa(*e.Operand)
+	}
+	fmt.Fprintf(&b, " %-6s [", operand)
+	if e.Elided > 0 {
+		fmt.Fprintf(&b, "+%d ", e.Elided)
+	}
+	b.WriteString(strings.Join(e.Stack, " "))
+	b.WriteString("]")
+	if e.Source != "" {
+		b.WriteString("  | " + e.Source)
+	}
+	return b.String() + "\n"
+}
+
+// traceValue formats a stack value, containers only show their size so
+// that tracing stays cheap.
+func traceValue(value Object) string {
+	var s string
+	switch value := value.(type) {
+	case nil:
+		return "nil"
+	case *ObjectRef:
+		return "&" + traceValue(value.Value)
+	case *StringObject:
+		s = strconv.Quote(value.Value)
+	case *ListObject:
+		return fmt.Sprintf("[#%d]", len(value.Value))
+	case *DictObject:
+		return fmt.Sprintf("{#%d}", len(value.Value))
+	case *CompiledFunctionObject:
+		return "<function " + value.Name + ">"
+	default:
+		s = value.ToString()
+	}
+	if runes := []rune(s); len(runes) > maxTraceValueLength {
+		s = string(runes[:maxTraceValueLength-3]) + "..."
+	}
+	return s
+}
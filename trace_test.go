@@ -0,0 +1,137 @@
+package quark_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/janqx/quark-lang/v1"
+	"github.com/janqx/quark-lang/v1/stdlib"
+)
+
+const traced = `fn twice(x) {
+  return x * 2
+}
+name = "quark"
+return twice(length(name))
+`
+
+func trace(t *testing.T, tracer *quark.Tracer) {
+	t.Helper()
+	ctx := quark.NewContext(quark.ModeNormal, stdlib.LoadModules())
+	ctx.Tracer = tracer
+	result, err := quark.NewScript(ctx).RunString(traced)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ToString() != "10" {
+		t.Errorf("got %s, want 10", result.ToString())
+	}
+}
+
+func TestTracer_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	trace(t, &quark.Tracer{Writer: &buf, Format: quark.TraceJSON})
+	var entries []quark.TraceEntry
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var entry quark.TraceEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("%v: %s", err, scanner.Text())
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		t.Fatal("nothing was traced")
+	}
+	first := entries[0]
+	if first.Function != "<compiled-function entry>" || first.Filename != "<repl>" || first.Line != 1 || first.IP != 0 || first.Depth != 1 {
+		t.Errorf("unexpected first entry %+v", first)
+	}
+	var calls, returns int
+	for _, entry := range entries {
+		switch {
+		case entry.Opcode == "OpCall" && entry.Function == "<compiled-function entry>" && entry.Line == 5:
+			calls++
+			if entry.Operand == nil || *entry.Operand != 1 {
+				t.Errorf("unexpected operand of %+v", entry)
+			}
+		case entry.Opcode == "OpReturn" && entry.Function == "twice":
+			returns++
+			if entry.Depth != 2 || entry.Source != "return x * 2" || strings.Join(entry.Stack, " ") != "10" {
+				t.Errorf("unexpected return %+v", entry)
+			}
+		case entry.Opcode == "OpStoreLocal" && entry.Line == 4:
+			if strings.Join(entry.Stack, " ") != `"quark"` {
+				t.Errorf("unexpected stack of %+v", entry)
+			}
+		}
+	}
+	// length and twice
+	if calls != 2 || returns != 1 {
+		t.Errorf("got %d calls and %d returns, want 2 and 1", calls, returns)
+	}
+}
+
+func TestTracer_Text(t *testing.T) {
+	var buf bytes.Buffer
+	trace(t, &quark.Tracer{Writer: &buf, Functions: []string{"twice"}, StackSize: 1})
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) < 2 {
+		t.Fatalf("got %q", lines)
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "<repl>:2") || !strings.Contains(line, " twice ") || !strings.HasSuffix(line, "| return x * 2") {
+			t.Errorf("unexpected line %q", line)
+		}
+	}
+	if last := lines[len(lines)-1]; !strings.Contains(last, "OpReturn") || !strings.Contains(last, "[10]") {
+		t.Errorf("unexpected last line %q", last)
+	}
+}
+
+func TestTracer_Filters(t *testing.T) {
+	tests := []struct {
+		name   string
+		tracer quark.Tracer
+		traced bool
+	}{
+		{"module", quark.Tracer{Modules: []string{"<repl>"}}, true},
+		{"other module", quark.Tracer{Modules: []string{"lib"}}, false},
+		{"function", quark.Tracer{Functions: []string{"missing", "twice"}}, true},
+		{"other function", quark.Tracer{Functions: []string{"missing"}}, false},
+		{"both", quark.Tracer{Functions: []string{"twice"}, Modules: []string{"lib"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tracer := tt.tracer
+			tracer.Writer = &buf
+			trace(t, &tracer)
+			if got := buf.Len() > 0; got != tt.traced {
+				t.Errorf("traced %v, want %v", got, tt.traced)
+			}
+		})
+	}
+}
+
+type failingWriter struct {
+	writes int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return 0, errors.New("disk full")
+}
+
+func TestTracer_WriteError(t *testing.T) {
+	w := &failingWriter{}
+	tracer := &quark.Tracer{Writer: w}
+	trace(t, tracer)
+	if w.writes != 1 || tracer.Err() == nil {
+		t.Errorf("got %d writes and error %v, want 1 and an error", w.writes, tracer.Err())
+	}
+}
@@ -0,0 +1,89 @@
+package quark
+
+import (
+	"fmt"
+	"strings"
+)
+
+type TracebackFrame struct {
+	Function string
+	Filename string
+	Line     int
+	Column   int
+	Builtin  bool
+}
+
+func (f TracebackFrame) String() string {
+	if f.Line == 0 {
+		return fmt.Sprintf("  File \"%s\", in %s", f.Filename, f.Function)
+	}
+	return fmt.Sprintf("  File \"%s\", line %d, in %s", f.Filename, f.Line, f.Function)
+}
+
+// Traceback lists the active calls at the point an error was raised, the
+// outermost call comes first. It is attached to every RuntimeError and can
+// be extracted with errors.As.
+type Traceback struct {
+	Frames []TracebackFrame
+}
+
+// maxRepeatedFrames is how many identical frames in a row are printed
+// before the rest are summarized, deep recursion would flood the output.
+const maxRepeatedFrames = 3
+
+func (t *Traceback) String() string {
+	var b strings.Builder
+	b.WriteString("Traceback (most recent call last):")
+	repeated := 0
+	for i, frame := range t.Frames {
+		if i > 0 && frame == t.Frames[i-1] {
+			repeated++
+		} else {
+			if repeated > maxRepeatedFrames {
+				fmt.Fprintf(&b, "\n  [previous line repeated %d more times]", repeated-maxRepeatedFrames)
+			}
+			repeated = 0
+		}
+		if repeated < maxRepeatedFrames {
+			b.WriteString("\n" + frame.String())
+		}
+	}
+	if repeated > maxRepeatedFrames {
+		fmt.Fprintf(&b, "\n  [previous line repeated %d more times]", repeated-maxRepeatedFrames)
+	}
+	return b.String()
+}
+
+func (t *Traceback) Error() string {
+	return t.String()
+}
+
+// traceback walks the call frames of the context, the position of each
+// frame is that of its current instruction, i.e. the pending call for all
+// but the innermost frame. Frame 0 is the context's top frame which never
+// runs code.
+func (c *Context) traceback() *Traceback {
+	result := &Traceback{}
+	for i := 1; i <= c.fp; i++ {
+		fn := c.frames[i].fn
+		pc := c.ip
+		if i < c.fp {
+			pc = c.frames[i+1].ip
+		}
+		line, column := fn.Lines.Lookup(pc)
+		result.Frames = append(result.Frames, TracebackFrame{
+			Function: fn.Name,
+			Filename: fn.Filename,
+			Line:     line,
+			Column:   column,
+		})
+	}
+	if builtin := c.currentBuiltin; builtin != nil {
+		result.Frames = append(result.Frames, TracebackFrame{
+			Function: builtin.Name,
+			Filename: "<builtin>",
+			Builtin:  true,
+		})
+	}
+	return result
+}
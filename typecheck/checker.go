@@ -0,0 +1,689 @@
+package typecheck
+
+import (
+	"fmt"
+
+	"github.com/janqx/quark-lang/v1/ast"
+	"github.com/janqx/quark-lang/v1/diagnostic"
+	"github.com/janqx/quark-lang/v1/tokenize"
+)
+
+// Builtins are the signatures of the builtin functions.
+var Builtins = map[string]*Type{
+	"print":     FunctionOf([]*Type{Any}, Null),
+	"println":   FunctionOf([]*Type{Any}, Null),
+	"panic":     FunctionOf([]*Type{Any}, Null),
+	"input":     FunctionOf([]*Type{Any}, String),
+	"copy":      FunctionOf([]*Type{Any}, Any),
+	"length":    FunctionOf([]*Type{Any}, Int),
+	"typename":  FunctionOf([]*Type{Any}, String),
+	"append":    FunctionOf([]*Type{ListOf(Any), Any}, ListOf(Any)),
+	"delete":    FunctionOf([]*Type{Any, Any}, Null),
+	"import":    FunctionOf([]*Type{String}, Any),
+	"to_bool":   FunctionOf([]*Type{Any}, Bool),
+	"to_int":    FunctionOf([]*Type{Any}, Int),
+	"to_float":  FunctionOf([]*Type{Any}, Float),
+	"to_string": FunctionOf([]*Type{Any}, String),
+	"chr":       FunctionOf([]*Type{Int}, String),
+	"encode":    FunctionOf([]*Type{String}, Bytes),
+	"decode":    FunctionOf([]*Type{Bytes}, String),
+	"bytes":     FunctionOf([]*Type{Any}, Bytes),
+}
+
+type variable struct {
+	typ      *Type
+	declared *Type     // the annotation, nil if there is none
+	origin   *variable // the variable a narrowed entry stands for
+}
+
+type scope struct {
+	parent    *scope
+	variables map[string]*variable
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{
+		parent:    parent,
+		variables: make(map[string]*variable),
+	}
+}
+
+type function struct {
+	parent *function
+	result *Type // nil if the return type isn't annotated
+}
+
+// Checker infers the types of expressions from literals, annotations and
+// the signatures of known functions, and reports the operations that
+// can't succeed with them. Inference is local: a variable without an
+// annotation takes the type of the value last assigned to it.
+type Checker struct {
+	scope       *scope
+	function    *function
+	result      *Type // of the last expression visited
+	diagnostics diagnostic.Diagnostics
+}
+
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// Check returns the type errors found in chunk sorted by position.
+func Check(chunk *ast.Chunk) diagnostic.Diagnostics {
+	return NewChecker().Check(chunk)
+}
+
+func (c *Checker) Check(chunk *ast.Chunk) diagnostic.Diagnostics {
+	builtins := newScope(nil)
+	for name, typ := range Builtins {
+		builtins.variables[name] = &variable{typ: typ, declared: typ}
+	}
+	c.scope = newScope(builtins)
+	c.function = &function{}
+	c.diagnostics = nil
+	chunk.Accept(c)
+	c.diagnostics.Sort()
+	return c.diagnostics
+}
+
+func (c *Checker) error(start, end tokenize.Position, format string, args ...interface{}) {
+	c.diagnostics = append(c.diagnostics, diagnostic.NewError(start, end, fmt.Sprintf(format, args...)))
+}
+
+func (c *Checker) infer(expression ast.Expression) *Type {
+	c.result = Any
+	expression.Accept(c)
+	return c.result
+}
+
+func (c *Checker) lookup(name string) (*variable, *scope) {
+	for s := c.scope; s != nil; s = s.parent {
+		if v, ok := s.variables[name]; ok {
+			return v, s
+		}
+	}
+	return nil, nil
+}
+
+// resolve converts an annotation into a type, unknown names are reported
+// and treated as Any.
+func (c *Checker) resolve(annotation *ast.Type) *Type {
+	if annotation == nil {
+		return Any
+	}
+	arguments := len(annotation.Arguments)
+	var result *Type
+	switch annotation.Name {
+	case "Any":
+		result = Any
+	case "Null":
+		result = Null
+	case "Bool":
+		result = Bool
+	case "Int":
+		result = Int
+	case "Float":
+		result = Float
+	case "String":
+		result = String
+	case "Bytes":
+		result = Bytes
+	case "Function":
+		result = AnyFunction
+	case "List":
+		result = ListOf(Any)
+		if arguments == 1 {
+			result.Element = c.resolve(annotation.Arguments[0])
+		}
+		arguments--
+	case "Dict":
+		result = DictOf(Any)
+		if arguments == 1 {
+			result.Element = c.resolve(annotation.Arguments[0])
+		}
+		arguments--
+	default:
+		c.error(annotation.Start, annotation.End, "unknown type '%s'", annotation.Name)
+		return Any
+	}
+	if arguments > 0 {
+		c.error(annotation.Start, annotation.End, "too many type arguments for '%s'", annotation.Name)
+	}
+	return result.withNullable(annotation.Nullable)
+}
+
+// declare adds a variable to the current scope, declared is nil for
+// variables without an annotation.
+func (c *Checker) declare(name string, typ *Type, declared *Type) {
+	c.scope.variables[name] = &variable{typ: typ, declared: declared}
+}
+
+// assign stores a value of type typ in the variable name. Annotated
+// variables keep their type, the others take the new one, or a join of
+// both when the assignment happens in a nested block and may be skipped.
+func (c *Checker) assign(node ast.Node, name string, typ *Type, annotation *ast.Type) {
+	v, s := c.lookup(name)
+	if annotation != nil {
+		declared := c.resolve(annotation)
+		c.check(node, declared, typ, "cannot assign '%s' to '%s' of type '%s'", typ, name, declared)
+		c.declare(name, declared, declared)
+		return
+	}
+	if v == nil {
+		c.declare(name, typ, nil)
+		return
+	}
+	if declared := v.declared; declared != nil {
+		c.check(node, declared, typ, "cannot assign '%s' to '%s' of type '%s'", typ, name, declared)
+		if v.origin != nil {
+			v.typ = typ.withNullable(typ.MaybeNull() && declared.MaybeNull())
+		}
+		return
+	}
+	if s == c.scope {
+		v.typ = typ
+	} else {
+		v.typ = Join(v.typ, typ)
+	}
+	if v.origin != nil && v.origin.declared == nil {
+		v.origin.typ = Join(v.origin.typ, typ)
+	}
+}
+
+func (c *Checker) check(node ast.Node, to, from *Type, format string, args ...interface{}) {
+	if !Assignable(to, from) {
+		c.error(node.Start(), node.End(), format, args...)
+	}
+}
+
+// narrowing returns the names that are known not to be null when cond is
+// true and when it is false.
+func narrowing(cond ast.Expression) (whenTrue []string, whenFalse []string) {
+	switch cond := cond.(type) {
+	case *ast.IdentifierExpression:
+		return []string{cond.Name}, nil
+	case *ast.UnaryExpression:
+		if cond.Op == tokenize.TokenNot {
+			whenTrue, whenFalse = narrowing(cond.Expression)
+			return whenFalse, whenTrue
+		}
+	case *ast.BinaryExpression:
+		switch cond.Op {
+		case tokenize.TokenLogicAnd:
+			left, _ := narrowing(cond.Left)
+			right, _ := narrowing(cond.Right)
+			return append(left, right...), nil
+		case tokenize.TokenLogicOr:
+			_, left := narrowing(cond.Left)
+			_, right := narrowing(cond.Right)
+			return nil, append(left, right...)
+		case tokenize.TokenEQ, tokenize.TokenNEQ, tokenize.TokenIs:
+			name := comparedWithNull(cond.Left, cond.Right)
+			if name == "" {
+				name = comparedWithNull(cond.Right, cond.Left)
+			}
+			if name == "" {
+				return nil, nil
+			}
+			if cond.Op == tokenize.TokenNEQ {
+				return []string{name}, nil
+			}
+			return nil, []string{name}
+		}
+	}
+	return nil, nil
+}
+
+func comparedWithNull(x, y ast.Expression) string {
+	identifier, ok := x.(*ast.IdentifierExpression)
+	if !ok {
+		return ""
+	}
+	if _, ok := y.(*ast.NullLiteralExpression); !ok {
+		return ""
+	}
+	return identifier.Name
+}
+
+// narrow shadows the given variables in the current scope with non-null
+// versions of themselves.
+func (c *Checker) narrow(names []string) {
+	for _, name := range names {
+		v, _ := c.lookup(name)
+		if v == nil || !v.typ.MaybeNull() || v.typ.Kind == KindNull {
+			continue
+		}
+		origin := v
+		if v.origin != nil {
+			origin = v.origin
+		}
+		c.scope.variables[name] = &variable{
+			typ:      v.typ.withNullable(false),
+			declared: v.declared,
+			origin:   origin,
+		}
+	}
+}
+
+// checkBranch checks body in a scope of its own in which names aren't null.
+func (c *Checker) checkBranch(body ast.Statement, names []string) {
+	c.scope = newScope(c.scope)
+	c.narrow(names)
+	body.Accept(c)
+	c.scope = c.scope.parent
+}
+
+// signature returns the type of a function, parameters without an
+// annotation are Any.
+func (c *Checker) signature(names []string, annotations []*ast.Type, returnType *ast.Type) *Type {
+	parameters := make([]*Type, len(names))
+	for i := range names {
+		parameters[i] = Any
+		if i < len(annotations) && annotations[i] != nil {
+			parameters[i] = c.resolve(annotations[i])
+		}
+	}
+	result := Any
+	if returnType != nil {
+		result = c.resolve(returnType)
+	}
+	return FunctionOf(parameters, result)
+}
+
+func (c *Checker) checkFunctionBody(typ *Type, names []string, annotations []*ast.Type, returnType *ast.Type, body ast.Statement) {
+	c.scope = newScope(c.scope)
+	c.function = &function{parent: c.function}
+	if returnType != nil {
+		c.function.result = typ.Result
+	}
+	for i, name := range names {
+		var declared *Type
+		if i < len(annotations) && annotations[i] != nil {
+			declared = typ.Parameters[i]
+		}
+		c.declare(name, typ.Parameters[i], declared)
+	}
+	body.Accept(c)
+	c.function = c.function.parent
+	c.scope = c.scope.parent
+}
+
+func (c *Checker) VisitChunk(node *ast.Chunk) {
+	node.Statements.Accept(c)
+}
+
+func (c *Checker) VisitStatementList(node *ast.StatementList) {
+	for _, s := range node.List {
+		s.Accept(c)
+	}
+}
+
+func (c *Checker) VisitContinueStatement(node *ast.ContinueStatement) {
+}
+
+func (c *Checker) VisitBreakStatement(node *ast.BreakStatement) {
+}
+
+func (c *Checker) VisitBlockStatement(node *ast.BlockStatement) {
+	c.scope = newScope(c.scope)
+	node.Statements.Accept(c)
+	c.scope = c.scope.parent
+}
+
+func (c *Checker) VisitReturnStatement(node *ast.ReturnStatement) {
+	typ := Null
+	for _, e := range node.Expressions.List {
+		typ = c.infer(e)
+	}
+	if node.Expressions.Count() > 1 {
+		typ = Any
+	}
+	if expected := c.function.result; expected != nil {
+		c.check(node, expected, typ, "cannot return '%s' from a function returning '%s'", typ, expected)
+	}
+}
+
+func (c *Checker) VisitIfStatement(node *ast.IfStatement) {
+	c.infer(node.Condition)
+	whenTrue, whenFalse := narrowing(node.Condition)
+	c.checkBranch(node.ThenBody, whenTrue)
+	// the else branches only run when the condition is false, so is what
+	// follows an if whose body always leaves the block
+	c.scope = newScope(c.scope)
+	c.narrow(whenFalse)
+	for _, elif := range node.Elifs {
+		c.infer(elif.Condition)
+		whenTrue, whenFalse := narrowing(elif.Condition)
+		c.checkBranch(elif.Body, whenTrue)
+		c.narrow(whenFalse)
+	}
+	if node.ElseBody != nil {
+		node.ElseBody.Accept(c)
+	}
+	c.scope = c.scope.parent
+	if len(node.Elifs) == 0 && node.ElseBody == nil && ast.Terminates(node.ThenBody) {
+		_, whenFalse := narrowing(node.Condition)
+		c.narrow(whenFalse)
+	}
+}
+
+func (c *Checker) VisitForStatement(node *ast.ForStatement) {
+	if node.Init != nil {
+		node.Init.Accept(c)
+	}
+	if node.Condition != nil {
+		c.infer(node.Condition)
+	}
+	node.Body.Accept(c)
+	if node.Increment != nil {
+		node.Increment.Accept(c)
+	}
+}
+
+func (c *Checker) VisitForInStatement(node *ast.ForInStatement) {
+	iterable := c.infer(node.Iterable)
+	element := Any
+	switch {
+	case iterable.Kind == KindAny:
+	case iterable.MaybeNull():
+		c.error(node.Iterable.Start(), node.Iterable.End(), "iteration over possibly-null value of type '%s'", iterable)
+	case iterable.Kind == KindList:
+		element = iterable.Element
+	case iterable.Kind == KindDict, iterable.Kind == KindString:
+		element = String
+	case iterable.Kind == KindBytes:
+		element = Int
+	}
+	c.assign(node, node.Name, element, nil)
+	node.Body.Accept(c)
+}
+
+func (c *Checker) VisitFunctionDeclareStatement(node *ast.FunctionDeclareStatement) {
+	typ := c.signature(node.ParameterNames, node.ParameterTypes, node.ReturnType)
+	if v, _ := c.lookup(node.Name); v != nil && v.declared != nil {
+		c.check(node, v.declared, typ, "cannot assign '%s' to '%s' of type '%s'", typ, node.Name, v.declared)
+	} else {
+		c.declare(node.Name, typ, nil)
+	}
+	c.checkFunctionBody(typ, node.ParameterNames, node.ParameterTypes, node.ReturnType, node.Body)
+}
+
+func (c *Checker) VisitImportStatement(node *ast.ImportStatement) {
+}
+
+func (c *Checker) VisitExportStatement(node *ast.ExportStatement) {
+	c.infer(node.Module)
+}
+
+func (c *Checker) VisitAssignStatement(node *ast.AssignStatement) {
+	types := make([]*Type, len(node.Expressions.List))
+	for i, e := range node.Expressions.List {
+		types[i] = c.infer(e)
+	}
+	for i, assignable := range node.Assignables {
+		typ := Any
+		if len(types) == len(node.Assignables) {
+			typ = types[i]
+		}
+		var annotation *ast.Type
+		if i < len(node.Types) {
+			annotation = node.Types[i]
+		}
+		if identifier, ok := assignable.(*ast.IdentifierExpression); ok {
+			c.assign(assignable, identifier.Name, typ, annotation)
+		} else {
+			c.infer(assignable)
+		}
+	}
+}
+
+func (c *Checker) VisitCallFunctionStatement(node *ast.CallFunctionStatement) {
+	c.call(node, node.Callable, node.Args)
+}
+
+func (c *Checker) VisitExpressionStatement(node *ast.ExpressionStatement) {
+	c.infer(node.Expression)
+}
+
+func (c *Checker) VisitDebuggerStatement(node *ast.DebuggerStatement) {
+}
+
+func (c *Checker) VisitExpressionList(node *ast.ExpressionList) {
+	for _, e := range node.List {
+		c.infer(e)
+	}
+	c.result = Any
+}
+
+func (c *Checker) VisitNullLiteralExpression(node *ast.NullLiteralExpression) {
+	c.result = Null
+}
+
+func (c *Checker) VisitTrueLiteralExpression(node *ast.TrueLiteralExpression) {
+	c.result = Bool
+}
+
+func (c *Checker) VisitFalseLiteralExpression(node *ast.FalseLiteralExpression) {
+	c.result = Bool
+}
+
+func (c *Checker) VisitIntLiteralExpression(node *ast.IntLiteralExpression) {
+	c.result = Int
+}
+
+func (c *Checker) VisitFloatLiteralExpression(node *ast.FloatLiteralExpression) {
+	c.result = Float
+}
+
+func (c *Checker) VisitStringLiteralExpression(node *ast.StringLiteralExpression) {
+	c.result = String
+}
+
+func (c *Checker) VisitBytesLiteralExpression(node *ast.BytesLiteralExpression) {
+	c.result = Bytes
+}
+
+func (c *Checker) joinAll(expressions []ast.Expression) *Type {
+	if len(expressions) == 0 {
+		return Any
+	}
+	result := c.infer(expressions[0])
+	for _, e := range expressions[1:] {
+		result = Join(result, c.infer(e))
+	}
+	return result
+}
+
+func (c *Checker) VisitListLiteralExpression(node *ast.ListLiteralExpression) {
+	c.result = ListOf(c.joinAll(node.Value.List))
+}
+
+func (c *Checker) VisitDictLiteralExpression(node *ast.DictLiteralExpression) {
+	values := make([]ast.Expression, 0, len(node.Value))
+	for _, value := range node.Value {
+		values = append(values, value)
+	}
+	c.result = DictOf(c.joinAll(values))
+}
+
+func (c *Checker) VisitIdentifierExpression(node *ast.IdentifierExpression) {
+	c.result = Any
+	if v, _ := c.lookup(node.Name); v != nil {
+		c.result = v.typ
+	}
+}
+
+func (c *Checker) VisitIndexAccessExpression(node *ast.IndexAccessExpression) {
+	value := c.infer(node.Value)
+	index := c.infer(node.Index)
+	c.result = Any
+	switch {
+	case value.Kind == KindAny:
+	case value.MaybeNull():
+		c.error(node.Start(), node.End(), "index of possibly-null value of type '%s'", value)
+	case value.Kind == KindList:
+		c.check(node.Index, Int, index, "list index must be 'Int', not '%s'", index)
+		c.result = value.Element
+	case value.Kind == KindDict:
+		c.result = value.Element
+	case value.Kind == KindString:
+		c.check(node.Index, Int, index, "string index must be 'Int', not '%s'", index)
+		c.result = String
+	case value.Kind == KindBytes:
+		c.check(node.Index, Int, index, "bytes index must be 'Int', not '%s'", index)
+		c.result = Int
+	default:
+		c.error(node.Start(), node.End(), "'%s' object is not subscriptable", value)
+	}
+}
+
+func (c *Checker) VisitSliceExpression(node *ast.SliceExpression) {
+	value := c.infer(node.Value)
+	if node.Low != nil {
+		c.infer(node.Low)
+	}
+	if node.High != nil {
+		c.infer(node.High)
+	}
+	c.result = value
+	if value.MaybeNull() {
+		c.error(node.Start(), node.End(), "slice of possibly-null value of type '%s'", value)
+		c.result = Any
+	}
+}
+
+func (c *Checker) VisitAttributeAccessExpression(node *ast.AttributeAccessExpression) {
+	value := c.infer(node.Value)
+	if value.MaybeNull() {
+		c.error(node.Start(), node.End(), "attribute access on possibly-null value of type '%s'", value)
+	}
+	c.result = Any
+}
+
+func (c *Checker) VisitFunctionDeclareExpression(node *ast.FunctionDeclareExpression) {
+	typ := c.signature(node.ParameterNames, node.ParameterTypes, node.ReturnType)
+	c.checkFunctionBody(typ, node.ParameterNames, node.ParameterTypes, node.ReturnType, node.Body)
+	c.result = typ
+}
+
+// call checks the arguments of a call against the signature of the
+// callee and returns the type of its result.
+func (c *Checker) call(node ast.Node, callable ast.Expression, args *ast.ExpressionList) *Type {
+	types := make([]*Type, len(args.List))
+	for i, arg := range args.List {
+		types[i] = c.infer(arg)
+	}
+	typ := c.infer(callable)
+	name := "function"
+	if identifier, ok := callable.(*ast.IdentifierExpression); ok {
+		name = "'" + identifier.Name + "'"
+	}
+	switch {
+	case typ.Kind == KindAny:
+		return Any
+	case typ.MaybeNull():
+		c.error(node.Start(), node.End(), "call of possibly-null value of type '%s'", typ)
+		return Any
+	case typ.Kind != KindFunction:
+		c.error(node.Start(), node.End(), "'%s' object is not callable", typ)
+		return Any
+	case typ.Variadic:
+		return typ.Result
+	}
+	if len(types) != len(typ.Parameters) {
+		c.error(node.Start(), node.End(), "%s takes %d argument(s) but %d were given", name, len(typ.Parameters), len(types))
+		return typ.Result
+	}
+	for i, parameter := range typ.Parameters {
+		c.check(args.List[i], parameter, types[i], "argument %d of %s must be '%s', not '%s'", i+1, name, parameter, types[i])
+	}
+	return typ.Result
+}
+
+func (c *Checker) VisitCallFunctionExpression(node *ast.CallFunctionExpression) {
+	c.result = c.call(node, node.Callable, node.Args)
+}
+
+func (c *Checker) VisitUnaryExpression(node *ast.UnaryExpression) {
+	operand := c.infer(node.Expression)
+	c.result = Any
+	switch node.Op {
+	case tokenize.TokenNot:
+		c.result = Bool
+	case tokenize.TokenPlus, tokenize.TokenMinus:
+		if operand.numeric() {
+			c.result = operand
+		} else if operand.Kind != KindAny {
+			c.error(node.Start(), node.End(), "bad operand type for unary %s: '%s'", node.Op, operand)
+		}
+	case tokenize.TokenBitNot:
+		if operand.Kind == KindInt && !operand.Nullable {
+			c.result = Int
+		} else if operand.Kind != KindAny {
+			c.error(node.Start(), node.End(), "bad operand type for unary %s: '%s'", node.Op, operand)
+		}
+	}
+}
+
+// binaryResult returns the type of x op y, nil if the operands are not
+// supported.
+func binaryResult(op tokenize.TokenType, x, y *Type) *Type {
+	switch op {
+	case tokenize.TokenLogicAnd, tokenize.TokenLogicOr:
+		return Join(x, y)
+	case tokenize.TokenEQ, tokenize.TokenNEQ, tokenize.TokenIs,
+		tokenize.TokenLT, tokenize.TokenLTE, tokenize.TokenGT, tokenize.TokenGTE:
+		return Bool
+	}
+	if x.Kind == KindAny || y.Kind == KindAny {
+		return Any
+	}
+	switch op {
+	case tokenize.TokenPlus:
+		if !x.Nullable && !y.Nullable && x.Kind == y.Kind && (x.Kind == KindString || x.Kind == KindBytes) {
+			return x
+		}
+		fallthrough
+	case tokenize.TokenMinus, tokenize.TokenMul, tokenize.TokenDiv:
+		// like the runtime, a Float right operand is truncated and Floats
+		// have no arithmetic of their own
+		if Equal(x, Int) && y.numeric() {
+			return Int
+		}
+	case tokenize.TokenMod:
+		if Equal(x, Int) && Equal(y, Int) {
+			return Int
+		}
+	case tokenize.TokenBitAnd, tokenize.TokenBitOr, tokenize.TokenBitXor, tokenize.TokenBitLhs, tokenize.TokenBitRhs:
+		if Equal(x, Int) && Equal(y, Int) {
+			return Int
+		}
+	}
+	return nil
+}
+
+func (c *Checker) VisitBinaryExpression(node *ast.BinaryExpression) {
+	left := c.infer(node.Left)
+	right := c.infer(node.Right)
+	c.result = binaryResult(node.Op, left, right)
+	if c.result == nil {
+		c.error(node.Start(), node.End(), "unsupported operand type(s) for %s: '%s' and '%s'", node.Op, left, right)
+		c.result = Any
+	}
+}
+
+func (c *Checker) VisitTernaryExpression(node *ast.TernaryExpression) {
+	c.infer(node.Cond)
+	whenTrue, whenFalse := narrowing(node.Cond)
+	x := c.inferNarrowed(node.X, whenTrue)
+	y := c.inferNarrowed(node.Y, whenFalse)
+	c.result = Join(x, y)
+}
+
+func (c *Checker) inferNarrowed(expression ast.Expression, names []string) *Type {
+	c.scope = newScope(c.scope)
+	c.narrow(names)
+	result := c.infer(expression)
+	c.scope = c.scope.parent
+	return result
+}
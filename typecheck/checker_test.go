@@ -0,0 +1,47 @@
+package typecheck_test
+
+import (
+	"testing"
+
+	"github.com/janqx/quark-lang/v1/parser"
+	"github.com/janqx/quark-lang/v1/typecheck"
+)
+
+func check(t *testing.T, source string) string {
+	chunk, err := parser.NewParser("t.qk", []byte(source)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return typecheck.Check(chunk).Error()
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{"x: Int = 1\nx = 2", ""},
+		{"x: Int = \"a\"", "t.qk:1:1: error: cannot assign 'String' to 'x' of type 'Int'"},
+		{"x: List[String] = []\ny: Int = x[0]", "t.qk:2:1: error: cannot assign 'String' to 'y' of type 'Int'"},
+		{"fn add(a: Int, b: Int) -> Int { return a + b }\nadd(1)", "t.qk:2:1: error: 'add' takes 2 argument(s) but 1 were given"},
+		{"fn add(a: Int, b: Int) -> Int { return a + b }\nadd(1, \"b\")", "t.qk:2:8: error: argument 2 of 'add' must be 'Int', not 'String'"},
+		{"fn f() -> String { return 1 }", "t.qk:1:20: error: cannot return 'Int' from a function returning 'String'"},
+		{"length(1, 2)", "t.qk:1:1: error: 'length' takes 1 argument(s) but 2 were given"},
+		{"x = 1 + \"a\"", "t.qk:1:5: error: unsupported operand type(s) for +: 'Int' and 'String'"},
+		{"x: Int = 1 + 2.5", ""},
+		{"x: Float = 2.5 + 1", "t.qk:1:12: error: unsupported operand type(s) for +: 'Float' and 'Int'"},
+		{"x = 7 % 2.5", "t.qk:1:5: error: unsupported operand type(s) for %: 'Int' and 'Float'"},
+		{"d: Dict[Int]? = null\nd.keys()", "t.qk:2:1: error: attribute access on possibly-null value of type 'Dict[Int]?'"},
+		{"d: Dict[Int]? = null\nif d != null { d.keys() }", ""},
+		{"fn f(d: Dict[Int]?) {\n  if d == null { return }\n  d.keys()\n}", ""},
+		{"fn f(d: Dict[Int]?) { return d ? d.keys() : null }", ""},
+		{"x = null\nx = {}\nx.keys()", ""},
+		{"x: Foo = 1", "t.qk:1:4: error: unknown type 'Foo'"},
+		{"fn f(a, b) { return a.x + b }\nf(null, 1)", ""},
+	}
+	for _, test := range tests {
+		if s := check(t, test.source); s != test.expected {
+			t.Errorf("%q: unexpected diagnostics:\n%s", test.source, s)
+		}
+	}
+}
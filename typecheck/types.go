@@ -0,0 +1,203 @@
+package typecheck
+
+import (
+	"strings"
+)
+
+type Kind uint8
+
+const (
+	KindAny Kind = iota
+	KindNull
+	KindBool
+	KindInt
+	KindFloat
+	KindString
+	KindBytes
+	KindList
+	KindDict
+	KindFunction
+)
+
+var kindNames = map[Kind]string{
+	KindAny:      "Any",
+	KindNull:     "Null",
+	KindBool:     "Bool",
+	KindInt:      "Int",
+	KindFloat:    "Float",
+	KindString:   "String",
+	KindBytes:    "Bytes",
+	KindList:     "List",
+	KindDict:     "Dict",
+	KindFunction: "Function",
+}
+
+// Type is a static type. Any is compatible with every type, it is used
+// wherever nothing is known, so unannotated code never reports errors.
+type Type struct {
+	Kind       Kind
+	Element    *Type   // of List and Dict, Dict keys are always strings
+	Parameters []*Type // of Function
+	Variadic   bool    // the Function accepts any number of arguments
+	Result     *Type   // of Function
+	Nullable   bool
+}
+
+var (
+	Any    = &Type{Kind: KindAny}
+	Null   = &Type{Kind: KindNull}
+	Bool   = &Type{Kind: KindBool}
+	Int    = &Type{Kind: KindInt}
+	Float  = &Type{Kind: KindFloat}
+	String = &Type{Kind: KindString}
+	Bytes  = &Type{Kind: KindBytes}
+)
+
+func ListOf(element *Type) *Type {
+	return &Type{Kind: KindList, Element: element}
+}
+
+func DictOf(element *Type) *Type {
+	return &Type{Kind: KindDict, Element: element}
+}
+
+func FunctionOf(parameters []*Type, result *Type) *Type {
+	return &Type{Kind: KindFunction, Parameters: parameters, Result: result}
+}
+
+// AnyFunction is the type of functions whose signature is unknown.
+var AnyFunction = &Type{Kind: KindFunction, Variadic: true, Result: Any}
+
+func (t *Type) String() string {
+	var s string
+	switch t.Kind {
+	case KindList, KindDict:
+		s = kindNames[t.Kind] + "[" + t.Element.String() + "]"
+	case KindFunction:
+		if t.Variadic {
+			s = "Function"
+			break
+		}
+		parameters := make([]string, len(t.Parameters))
+		for i, parameter := range t.Parameters {
+			parameters[i] = parameter.String()
+		}
+		s = "fn(" + strings.Join(parameters, ", ") + ") -> " + t.Result.String()
+	default:
+		s = kindNames[t.Kind]
+	}
+	if t.Nullable {
+		s += "?"
+	}
+	return s
+}
+
+// MaybeNull reports whether a value of type t may be null, Any is not
+// considered to be null.
+func (t *Type) MaybeNull() bool {
+	return t.Kind == KindNull || t.Nullable
+}
+
+func (t *Type) withNullable(nullable bool) *Type {
+	if t.Kind == KindAny || t.Kind == KindNull || t.Nullable == nullable {
+		return t
+	}
+	result := *t
+	result.Nullable = nullable
+	return &result
+}
+
+func (t *Type) numeric() bool {
+	return !t.Nullable && (t.Kind == KindInt || t.Kind == KindFloat)
+}
+
+// Equal reports whether x and y are the same type.
+func Equal(x, y *Type) bool {
+	if x.Kind != y.Kind || x.Nullable != y.Nullable || x.Variadic != y.Variadic {
+		return false
+	}
+	switch x.Kind {
+	case KindList, KindDict:
+		return Equal(x.Element, y.Element)
+	case KindFunction:
+		if x.Variadic {
+			return true
+		}
+		if len(x.Parameters) != len(y.Parameters) || !Equal(x.Result, y.Result) {
+			return false
+		}
+		for i := range x.Parameters {
+			if !Equal(x.Parameters[i], y.Parameters[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Assignable reports whether a value of type from can be stored in a
+// variable of type to. Element types are compared leniently, so an empty
+// list literal can initialize a List[String].
+func Assignable(to, from *Type) bool {
+	if to.Kind == KindAny || from.Kind == KindAny {
+		return true
+	}
+	if from.MaybeNull() && !to.MaybeNull() {
+		return false
+	}
+	if from.Kind == KindNull {
+		return true
+	}
+	switch {
+	case to.Kind == from.Kind:
+	case to.Kind == KindFloat && from.Kind == KindInt:
+		return true
+	default:
+		return false
+	}
+	switch to.Kind {
+	case KindList, KindDict:
+		return Assignable(to.Element, from.Element)
+	case KindFunction:
+		if to.Variadic || from.Variadic {
+			return true
+		}
+		if len(to.Parameters) != len(from.Parameters) || !Assignable(to.Result, from.Result) {
+			return false
+		}
+		for i := range to.Parameters {
+			if !Assignable(from.Parameters[i], to.Parameters[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Join returns a type that can hold values of both x and y.
+func Join(x, y *Type) *Type {
+	switch {
+	case x.Kind == KindAny || y.Kind == KindAny:
+		return Any
+	case x.Kind == KindNull:
+		return y.withNullable(true)
+	case y.Kind == KindNull:
+		return x.withNullable(true)
+	}
+	nullable := x.Nullable || y.Nullable
+	x, y = x.withNullable(false), y.withNullable(false)
+	switch {
+	case Equal(x, y):
+		return x.withNullable(nullable)
+	case x.numeric() && y.numeric():
+		return Float.withNullable(nullable)
+	case x.Kind == y.Kind && x.Kind == KindList:
+		return ListOf(Join(x.Element, y.Element)).withNullable(nullable)
+	case x.Kind == y.Kind && x.Kind == KindDict:
+		return DictOf(Join(x.Element, y.Element)).withNullable(nullable)
+	case x.Kind == y.Kind && x.Kind == KindFunction:
+		return AnyFunction.withNullable(nullable)
+	default:
+		return Any
+	}
+}
@@ -0,0 +1,293 @@
+package quark
+
+import "fmt"
+
+// VerifyError reports an instruction that makes a function unsafe to run.
+type VerifyError struct {
+	Function string
+	PC       int
+	Message  string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("invalid bytecode in '%s' at #%d: %s", e.Function, e.PC, e.Message)
+}
+
+func (e *VerifyError) Unwrap() error {
+	return ErrInvalidBytecode
+}
+
+// unit is an instruction together with its OpExtendedArg prefix.
+type unit struct {
+	start   int // of the prefix, where jumps land
+	pc      int // of the instruction
+	opcode  Opcode
+	operand Operand
+}
+
+type verifier struct {
+	ctx   *Context
+	fn    *CompiledFunctionObject
+	units map[int]*unit // by start
+}
+
+// Verify checks that the instructions of fn can't make the VM misbehave:
+// every opcode must exist, operands must be in range, jumps must land on
+// an instruction and the stack must never underflow, overflow or have
+// different depths where paths meet. Every function is verified before
+// it first runs, which also records how deep its operand stack goes so
+// that calls can make sure it fits.
+func (c *Context) Verify(fn *CompiledFunctionObject) error {
+	if fn.verified {
+		return nil
+	}
+	v := &verifier{ctx: c, fn: fn}
+	if err := v.decode(); err != nil {
+		return err
+	}
+	for pc := range fn.Instructions {
+		if u, ok := v.units[pc]; ok {
+			if err := v.checkOperand(u); err != nil {
+				return err
+			}
+		}
+	}
+	for _, symbol := range fn.SymbolTable.Symbols {
+		if symbol.Scope == ScopeOuter && (symbol.Index < 0 || symbol.Index >= fn.SymbolTable.OuterCount || symbol.OuterIndex < 0) {
+			return v.error(0, "outer '%s' out of range", symbol.Name)
+		}
+	}
+	if err := v.checkStack(); err != nil {
+		return err
+	}
+	fn.verified = true
+	return nil
+}
+
+func (v *verifier) error(pc int, format string, args ...interface{}) error {
+	return &VerifyError{
+		Function: v.fn.Name,
+		PC:       pc,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+func (v *verifier) decode() error {
+	code := v.fn.Instructions
+	if len(code) == 0 {
+		return v.error(0, "no instructions")
+	}
+	if v.fn.SymbolTable == nil || v.fn.SymbolTable.LocalCount < 0 || v.fn.SymbolTable.OuterCount < 0 {
+		return v.error(0, "invalid symbol table")
+	}
+	v.units = make(map[int]*unit, len(code))
+	for pc := 0; pc < len(code); pc++ {
+		u := &unit{start: pc, pc: pc, opcode: code[pc].Opcode(), operand: code[pc].Operand()}
+		if u.opcode == OpExtendedArg {
+			if pc+1 == len(code) || code[pc+1].Opcode() == OpExtendedArg {
+				return v.error(pc, "OpExtendedArg must prefix an instruction")
+			}
+			pc++
+			u.pc = pc
+			u.opcode = code[pc].Opcode()
+			u.operand = u.operand<<24 | code[pc].Operand()
+		}
+		if int(u.opcode) >= len(OpcodeToString) || OpcodeToString[u.opcode] == "" {
+			return v.error(pc, "invalid opcode %d", u.opcode)
+		}
+		v.units[u.start] = u
+	}
+	return nil
+}
+
+// tail returns the instruction at pc if it is part of the sequence of a
+// superinstruction, i.e. it has the given opcode and no prefix.
+func (v *verifier) tail(pc int, valid func(Opcode) bool) (*unit, bool) {
+	u, ok := v.units[pc]
+	if !ok || u.pc != pc || !valid(u.opcode) {
+		return nil, false
+	}
+	return u, true
+}
+
+func opcodeIs(opcode Opcode) func(Opcode) bool {
+	return func(op Opcode) bool {
+		return op == opcode
+	}
+}
+
+func (v *verifier) checkOperand(u *unit) error {
+	fn := v.fn
+	index := int(u.operand)
+	switch u.opcode {
+	case OpLoadConst:
+		if index >= len(fn.Constants) {
+			return v.error(u.pc, "constant %d out of range", index)
+		}
+	case OpLoadLocal, OpStoreLocal:
+		if index >= fn.SymbolTable.LocalCount {
+			return v.error(u.pc, "local %d out of range", index)
+		}
+	case OpLoadOuter, OpStoreOuter:
+		if index >= fn.SymbolTable.OuterCount {
+			return v.error(u.pc, "outer %d out of range", index)
+		}
+	case OpLoadGlobal, OpStoreGlobal:
+		if index >= len(v.ctx.globals) {
+			return v.error(u.pc, "global %d out of range", index)
+		}
+	case OpJump, OpJumpIfFalse, OpJumpIfFalseOrPop, OpJumpIfTrueOrPop, OpIterNext:
+		if target, ok := v.units[index]; !ok || target.start != index {
+			return v.error(u.pc, "jump target %d isn't an instruction", index)
+		}
+	case OpIncLocalConst, OpBinaryLocalConst, OpCompareLocalConstJump, OpCompareLocalsJump:
+		if index >= fn.SymbolTable.LocalCount {
+			return v.error(u.pc, "local %d out of range", index)
+		}
+		if u.pc != u.start {
+			return v.error(u.pc, "%s can't be prefixed", u.opcode)
+		}
+		second := opcodeIs(OpLoadConst)
+		if u.opcode == OpCompareLocalsJump {
+			second = opcodeIs(OpLoadLocal)
+		}
+		operator := isBinary
+		if u.opcode == OpIncLocalConst {
+			operator = opcodeIs(OpBinaryAdd)
+		}
+		last := opcodeIs(OpJumpIfFalse)
+		if u.opcode == OpIncLocalConst {
+			last = opcodeIs(OpStoreLocal)
+		}
+		_, ok2 := v.tail(u.pc+1, second)
+		_, ok3 := v.tail(u.pc+2, operator)
+		ok4 := true
+		if u.opcode != OpBinaryLocalConst {
+			_, ok4 = v.tail(u.pc+3, last)
+		}
+		if !ok2 || !ok3 || !ok4 {
+			return v.error(u.pc, "%s isn't followed by its sequence", u.opcode)
+		}
+	}
+	return nil
+}
+
+// effect returns how many values u pops and pushes when execution goes
+// on with the next instruction.
+func effect(u *unit) (pops int, pushes int) {
+	n := int(u.operand)
+	switch u.opcode {
+	case OpLoadNull, OpLoadTrue, OpLoadFalse, OpLoadConst, OpLoadLocal, OpLoadOuter, OpLoadGlobal:
+		return 0, 1
+	case OpLoadIndex, OpLoadAttribute:
+		return 2, 1
+	case OpLoadSlice:
+		return 3, 1
+	case OpStoreLocal, OpStoreOuter, OpStoreGlobal, OpRemoveTop, OpJumpIfFalse:
+		return 1, 0
+	case OpStoreIndex, OpStoreAttribute:
+		return 3, 0
+	case OpUnaryBitNot, OpUnaryNot, OpUnaryPlus, OpUnaryMinus, OpIterInit, OpClosure, OpCopy:
+		return 1, 1
+	case OpJumpIfFalseOrPop, OpJumpIfTrueOrPop:
+		return 1, 0
+	case OpIterNext:
+		return 1, 2
+	case OpCall:
+		return n + 1, 1
+	case OpBuildList:
+		return n, 1
+	case OpBuildDict:
+		return 2 * n, 1
+	case OpReturn, OpExport:
+		return 1, 0
+	case OpBinaryLocalConst:
+		return 0, 1
+	default:
+		if isBinary(u.opcode) {
+			return 2, 1
+		}
+		return 0, 0
+	}
+}
+
+// checkStack follows every path through the function and computes the
+// depth of the operand stack before each instruction.
+func (v *verifier) checkStack() error {
+	depth := make(map[int]int, len(v.units))
+	maxDepth := 0
+	pending := []int{0}
+	depth[0] = 0
+
+	// visit records the depth at target, paths that meet must agree
+	visit := func(from *unit, target int, d int) error {
+		if _, ok := v.units[target]; !ok {
+			return v.error(from.pc, "execution runs past the end")
+		}
+		if previous, ok := depth[target]; ok {
+			if previous != d {
+				return v.error(target, "stack depth is %d or %d", previous, d)
+			}
+			return nil
+		}
+		depth[target] = d
+		pending = append(pending, target)
+		return nil
+	}
+
+	for len(pending) > 0 {
+		start := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		u := v.units[start]
+		d := depth[start]
+
+		pops, pushes := effect(u)
+		if d < pops {
+			return v.error(u.pc, "%s pops %d value(s) from a stack of %d", u.opcode, pops, d)
+		}
+		next := d - pops + pushes
+		if next > maxDepth {
+			maxDepth = next
+		}
+
+		var err error
+		switch u.opcode {
+		case OpReturn, OpExport:
+			continue
+		case OpJump:
+			err = visit(u, int(u.operand), d)
+		case OpJumpIfFalse:
+			if err = visit(u, int(u.operand), next); err == nil {
+				err = visit(u, u.pc+1, next)
+			}
+		case OpJumpIfFalseOrPop, OpJumpIfTrueOrPop:
+			if err = visit(u, int(u.operand), d); err == nil {
+				err = visit(u, u.pc+1, next)
+			}
+		case OpIterNext:
+			// the iterator is peeked, the loop quits without a value
+			if err = visit(u, int(u.operand), d); err == nil {
+				err = visit(u, u.pc+1, d+1)
+			}
+		case OpIncLocalConst:
+			err = visit(u, u.pc+4, next)
+		case OpBinaryLocalConst:
+			err = visit(u, u.pc+3, next)
+		case OpCompareLocalConstJump, OpCompareLocalsJump:
+			if err = visit(u, int(v.units[u.pc+3].operand), next); err == nil {
+				err = visit(u, u.pc+4, next)
+			}
+		default:
+			err = visit(u, u.pc+1, next)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if v.fn.SymbolTable.LocalCount+maxDepth >= MaxStackSize {
+		return v.error(0, "needs a stack of %d values", v.fn.SymbolTable.LocalCount+maxDepth)
+	}
+	v.fn.maxDepth = maxDepth
+	return nil
+}
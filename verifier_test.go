@@ -0,0 +1,186 @@
+package quark
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/janqx/quark-lang/v1/parser"
+)
+
+func TestVerify_CompiledCode(t *testing.T) {
+	filenames, err := filepath.Glob("example/*.qk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, filename := range filenames {
+		source, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunk, err := parser.NewParser(filename, source).Parse()
+		if err != nil {
+			// some examples use syntax that isn't supported yet
+			continue
+		}
+		for _, level := range []OptimizationLevel{OptimizeNone, OptimizeBasic, OptimizeFull} {
+			ctx := NewContext(ModeNormal, nil)
+			ctx.OptimizationLevel = level
+			result, err := NewCompiler(ctx, nil).Compile(chunk)
+			if err != nil {
+				continue
+			}
+			for _, fn := range result.compiledFunctions {
+				fn.verified = false
+				if err := ctx.Verify(fn); err != nil {
+					t.Errorf("%s, level %d: %v", filename, level, err)
+				}
+			}
+		}
+	}
+}
+
+func TestVerify_InvalidCode(t *testing.T) {
+	tests := []struct {
+		code     []Instruction
+		expected string
+	}{
+		{nil, "no instructions"},
+		{[]Instruction{NewInstruction(Opcode(250), 0)}, "invalid opcode 250"},
+		{[]Instruction{NewInstruction(OpLoadConst, 1), NewInstruction(OpReturn, 1)}, "constant 1 out of range"},
+		{[]Instruction{NewInstruction(OpLoadLocal, 2), NewInstruction(OpReturn, 1)}, "local 2 out of range"},
+		{[]Instruction{NewInstruction(OpJump, 7)}, "jump target 7 isn't an instruction"},
+		{[]Instruction{NewInstruction(OpBinaryAdd, InvalidOperand), NewInstruction(OpReturn, 1)}, "OpBinaryAdd pops 2 value(s) from a stack of 0"},
+		{[]Instruction{NewInstruction(OpLoadNull, InvalidOperand)}, "execution runs past the end"},
+		{[]Instruction{NewInstruction(OpExtendedArg, 0)}, "OpExtendedArg must prefix an instruction"},
+		{[]Instruction{
+			NewInstruction(OpExtendedArg, 0),
+			NewInstruction(OpLoadNull, InvalidOperand),
+			NewInstruction(OpJump, 1),
+		}, "jump target 1 isn't an instruction"},
+		{[]Instruction{
+			NewInstruction(OpLoadTrue, InvalidOperand),
+			NewInstruction(OpJumpIfFalse, 3),
+			NewInstruction(OpLoadNull, InvalidOperand),
+			NewInstruction(OpLoadNull, InvalidOperand),
+			NewInstruction(OpReturn, 1),
+		}, "stack depth is 0 or 1"},
+		{[]Instruction{
+			NewInstruction(OpIncLocalConst, 0),
+			NewInstruction(OpLoadConst, 0),
+			NewInstruction(OpLoadNull, InvalidOperand),
+			NewInstruction(OpReturn, 1),
+		}, "OpIncLocalConst isn't followed by its sequence"},
+	}
+	ctx := NewContext(ModeNormal, nil)
+	for _, test := range tests {
+		fn := &CompiledFunctionObject{
+			Name:         "f",
+			Instructions: test.code,
+			Constants:    []Object{NewInt(1)},
+			SymbolTable:  NewSymbolTable(nil, TypeFunction),
+		}
+		fn.SymbolTable.LocalCount = 1
+		err := ctx.Verify(fn)
+		var verifyError *VerifyError
+		if !errors.As(err, &verifyError) || verifyError.Message != test.expected {
+			t.Errorf("%v: unexpected error %v, expected %q", test.code, err, test.expected)
+		} else if !errors.Is(err, ErrInvalidBytecode) {
+			t.Errorf("%v: %v isn't an ErrInvalidBytecode", test.code, err)
+		}
+	}
+}
+
+func TestVerify_RunUnexpectedValues(t *testing.T) {
+	tests := []struct {
+		code     []Instruction
+		expected string
+	}{
+		{[]Instruction{
+			NewInstruction(OpLoadLocal, 0),
+			NewInstruction(OpReturn, 1),
+		}, ""},
+		{[]Instruction{
+			NewInstruction(OpLoadNull, InvalidOperand),
+			NewInstruction(OpLoadConst, 0),
+			NewInstruction(OpLoadAttribute, InvalidOperand),
+			NewInstruction(OpReturn, 1),
+		}, "attribute name must be a string, not 'Int'"},
+		{[]Instruction{
+			NewInstruction(OpLoadNull, InvalidOperand),
+			NewInstruction(OpLoadNull, InvalidOperand),
+			NewInstruction(OpLoadConst, 0),
+			NewInstruction(OpStoreAttribute, InvalidOperand),
+			NewInstruction(OpLoadNull, InvalidOperand),
+			NewInstruction(OpReturn, 1),
+		}, "attribute name must be a string, not 'Int'"},
+		{[]Instruction{
+			NewInstruction(OpLoadConst, 0),
+			NewInstruction(OpLoadNull, InvalidOperand),
+			NewInstruction(OpBuildDict, 1),
+			NewInstruction(OpReturn, 1),
+		}, "dict keys must be strings"},
+		{[]Instruction{
+			NewInstruction(OpLoadConst, 0),
+			NewInstruction(OpIterNext, 3),
+			NewInstruction(OpRemoveTop, InvalidOperand),
+			NewInstruction(OpReturn, 1),
+		}, "'Int' object is not an iterator"},
+	}
+	for _, test := range tests {
+		ctx := NewContext(ModeNormal, nil)
+		fn := &CompiledFunctionObject{
+			Name:         "f",
+			Instructions: test.code,
+			Constants:    []Object{NewInt(1)},
+			SymbolTable:  NewSymbolTable(nil, TypeFunction),
+		}
+		fn.SymbolTable.LocalCount = 1
+		vm := NewVM(ctx)
+		err := vm.Prepare(fn, 0)
+		if err == nil {
+			var result Object
+			result, err = vm.Execute()
+			if err == nil && result != Null {
+				t.Errorf("%v: unexpected result %v", test.code, result)
+			}
+		}
+		var panicError PanicError
+		if errors.As(err, &panicError) {
+			t.Errorf("%v: panicked: %v", test.code, err)
+		} else if test.expected == "" && err != nil || test.expected != "" && (err == nil || !strings.Contains(err.Error(), test.expected)) {
+			t.Errorf("%v: unexpected error %v, expected %q", test.code, err, test.expected)
+		}
+	}
+}
+
+func TestVerify_StackDepth(t *testing.T) {
+	code := make([]Instruction, 0, MaxStackSize)
+	for i := 0; i < MaxStackSize/2; i++ {
+		code = append(code, NewInstruction(OpLoadNull, InvalidOperand))
+	}
+	code = append(code, NewInstruction(OpBuildList, MaxStackSize/2), NewInstruction(OpReturn, 1))
+	fn := &CompiledFunctionObject{
+		Name:         "f",
+		Instructions: code,
+		SymbolTable:  NewSymbolTable(nil, TypeFunction),
+	}
+	ctx := NewContext(ModeNormal, nil)
+	vm := NewVM(ctx)
+	// most of the stack is taken by the caller, the operands of f don't fit
+	ctx.sp += MaxStackSize/2 + 1
+	if err := vm.Prepare(fn, 0); err != ErrStackOverflow {
+		t.Fatalf("unexpected error %v, expected %v", err, ErrStackOverflow)
+	}
+	ctx.sp -= MaxStackSize/2 + 1
+	if err := vm.Prepare(fn, 0); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := vm.Execute(); err != nil {
+		t.Fatal(err)
+	} else if list, ok := result.(*ListObject); !ok || len(list.Value) != MaxStackSize/2 {
+		t.Errorf("unexpected result %v", result)
+	}
+}
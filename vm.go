@@ -14,6 +14,11 @@ type CallFrame struct {
 
 type VM struct {
 	ctx *Context
+
+	// frame state before Prepare, restored when execution fails
+	baseFp int
+	baseSp int
+	baseIp int
 }
 
 func NewVM(ctx *Context) *VM {
@@ -24,22 +29,92 @@ func NewVM(ctx *Context) *VM {
 
 // 为了接下来执行的callable对象做准备
 func (vm *VM) Prepare(callee Object, argc int) error {
-	return vm.call(callee, argc)
+	vm.baseFp = vm.ctx.fp
+	vm.baseSp = vm.ctx.sp - argc
+	vm.baseIp = vm.ctx.ip
+	if err := vm.call(callee, argc); err != nil {
+		vm.unwind()
+		return err
+	}
+	return nil
 }
 
 // 执行callable对象，并返回函数返回值
-func (vm *VM) Execute() (Object, error) {
+func (vm *VM) Execute() (result Object, err error) {
+	// panics raised by builtins or host objects must not take down the
+	// embedding process, they are reported like any other script error
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, PanicError{Value: r}
+		}
+		if err != nil {
+			err = vm.runtimeError(err)
+			vm.unwind()
+		}
+	}()
 	if err := vm.execute(); err != nil {
 		return nil, err
 	}
 	return vm.pop(), nil
 }
 
+// runtimeError attaches the position of the failing instruction to err.
+func (vm *VM) runtimeError(err error) error {
+	if _, ok := err.(*RuntimeError); ok {
+		return err
+	}
+	fn := vm.ctx.currentFrame.fn
+	line, column := fn.Lines.Lookup(vm.ctx.ip)
+	result := &RuntimeError{
+		ErrorMessage: ErrorMessage{
+			Filename: fn.Filename,
+			Line:     line,
+			Column:   column,
+			Message:  err.Error(),
+		},
+		Traceback: vm.ctx.traceback(),
+		Err:       err,
+	}
+	if line > 0 {
+		result.SourceLine = fn.sourceLine(line)
+	}
+	return result
+}
+
+// unwind drops the frames and stack values left by a failed execution, so
+// the context can be reused, e.g. by the next line in the REPL.
+func (vm *VM) unwind() {
+	ctx := vm.ctx
+	for i := vm.baseSp; i < ctx.sp && i < MaxStackSize; i++ {
+		ctx.stack[i] = nil
+	}
+	for i := vm.baseFp + 1; i <= ctx.fp && i < MaxCallFrameSize; i++ {
+		ctx.frames[i] = nil
+	}
+	ctx.sp = vm.baseSp
+	ctx.fp = vm.baseFp
+	ctx.ip = vm.baseIp
+	ctx.currentFrame = ctx.frames[ctx.fp]
+	ctx.currentBuiltin = nil
+}
+
 func (vm *VM) execute() error {
 	ctx := vm.ctx
 	for ctx.ip+1 < len(ctx.currentFrame.fn.Instructions) && atomic.LoadInt32(&(ctx.abortFlag)) == 0 {
 		ctx.ip++
+		if ctx.debugger != nil && ctx.debugger.next() {
+			return ErrAborted
+		}
 		inst := ctx.currentFrame.fn.Instructions[ctx.ip]
+		operand := inst.Operand()
+		if inst.Opcode() == OpExtendedArg {
+			ctx.ip++
+			inst = ctx.currentFrame.fn.Instructions[ctx.ip]
+			operand = operand<<24 | inst.Operand()
+		}
+		if ctx.Tracer != nil {
+			ctx.Tracer.trace(ctx, inst.Opcode(), operand)
+		}
 		switch inst.Opcode() {
 		case OpNop:
 		case OpLoadNull:
@@ -49,59 +124,76 @@ func (vm *VM) execute() error {
 		case OpLoadFalse:
 			vm.push(False)
 		case OpLoadConst:
-			vm.push(ctx.constants[inst.Operand()])
+			vm.push(ctx.currentFrame.fn.Constants[operand])
 		case OpLoadLocal:
-			vm.push(vm.getLocal(int(inst.Operand())))
+			vm.push(vm.getLocal(int(operand)))
 		case OpLoadOuter:
-			vm.push(vm.getOuter(int(inst.Operand())))
+			vm.push(vm.getOuter(int(operand)))
 		case OpLoadGlobal:
-			vm.push(vm.getGlobal(int(inst.Operand())))
+			vm.push(vm.getGlobal(int(operand)))
 		case OpLoadIndex:
 			index := vm.pop()
 			obj := vm.pop()
 			value, err := obj.IndexGet(index)
 			if err != nil {
-				return err
+				return typeError(err, "'%s' object is not subscriptable", obj.TypeName())
 			}
 			vm.push(value)
 		case OpLoadAttribute:
-			attr := vm.pop()
-			obj := vm.pop()
-			value, err := obj.AttributeGet(attr.(*StringObject).Value)
+			name, err := attributeName(vm.pop())
 			if err != nil {
 				return err
 			}
+			obj := vm.pop()
+			value, err := obj.AttributeGet(name)
+			if err == ErrNotImplemented {
+				return NewErrUnknownAttribute(obj.TypeName(), name)
+			} else if err != nil {
+				return err
+			}
+			vm.push(value)
+		case OpLoadSlice:
+			high := vm.pop()
+			low := vm.pop()
+			obj := vm.pop()
+			value, err := obj.Slice(low, high)
+			if err != nil {
+				return typeError(err, "'%s' object is not sliceable", obj.TypeName())
+			}
 			vm.push(value)
 		case OpStoreLocal:
-			vm.setLocal(int(inst.Operand()), vm.pop())
+			vm.setLocal(int(operand), vm.pop())
 		case OpStoreOuter:
-			vm.setOuter(int(inst.Operand()), vm.pop())
+			vm.setOuter(int(operand), vm.pop())
 		case OpStoreGlobal:
-			vm.setGlobal(int(inst.Operand()), vm.pop())
+			vm.setGlobal(int(operand), vm.pop())
 		case OpStoreIndex:
 			index := vm.pop()
-			list := vm.pop()
+			obj := vm.pop()
 			value := vm.pop()
-			if err := list.IndexSet(index, value); err != nil {
-				return err
+			if err := obj.IndexSet(index, value); err != nil {
+				return typeError(err, "'%s' object does not support item assignment", obj.TypeName())
 			}
 		case OpStoreAttribute:
-			attr := vm.pop()
+			name, err := attributeName(vm.pop())
+			if err != nil {
+				return err
+			}
 			obj := vm.pop()
 			value := vm.pop()
-			if err := obj.AttributeSet(attr.(*StringObject).Value, value); err != nil {
-				return err
+			if err := obj.AttributeSet(name, value); err != nil {
+				return typeError(err, "'%s' object does not support attribute assignment", obj.TypeName())
 			}
 		case OpBuildList:
-			if err := vm.buildList(int(inst.Operand())); err != nil {
+			if err := vm.buildList(int(operand)); err != nil {
 				return err
 			}
 		case OpBuildDict:
-			if err := vm.buildDict(int(inst.Operand())); err != nil {
+			if err := vm.buildDict(int(operand)); err != nil {
 				return err
 			}
 		case OpUnaryBitNot, OpUnaryNot, OpUnaryPlus, OpUnaryMinus:
-			obj, err := vm.unaryOp(inst.Opcode(), vm.pop())
+			obj, err := unaryOp(inst.Opcode(), vm.pop())
 			if err != nil {
 				return err
 			}
@@ -117,35 +209,54 @@ func (vm *VM) execute() error {
 			OpBinaryGTE,
 			OpBinaryEQ,
 			OpBinaryNEQ,
+			OpBinaryIs,
 			OpBinaryBitAnd,
 			OpBinaryBitOr,
 			OpBinaryBitXor,
 			OpBinaryBitLhs,
 			OpBinaryBitRhs:
 			ctx.sp -= 2
-			obj, err := vm.binaryOp(inst.Opcode(), ctx.stack[ctx.sp], ctx.stack[ctx.sp+1])
+			obj, err := binaryOp(inst.Opcode(), ctx.stack[ctx.sp], ctx.stack[ctx.sp+1])
 			if err != nil {
 				return err
 			}
 			vm.push(obj)
 		case OpJump:
-			ctx.ip = int(inst.Operand()) - 1
+			ctx.ip = int(operand) - 1
 		case OpJumpIfFalse:
 			if !vm.pop().ToBool() {
-				ctx.ip = int(inst.Operand()) - 1
+				ctx.ip = int(operand) - 1
 			}
 		case OpJumpIfFalseOrPop:
 			if !vm.peek().ToBool() {
-				ctx.ip = int(inst.Operand()) - 1
+				ctx.ip = int(operand) - 1
 			} else {
 				vm.pop()
 			}
 		case OpJumpIfTrueOrPop:
 			if vm.peek().ToBool() {
-				ctx.ip = int(inst.Operand()) - 1
+				ctx.ip = int(operand) - 1
 			} else {
 				vm.pop()
 			}
+		case OpIterInit:
+			obj := vm.pop()
+			iterator, err := obj.Iterate()
+			if err != nil {
+				return typeError(err, "'%s' object is not iterable", obj.TypeName())
+			}
+			vm.push(iterator)
+		case OpIterNext:
+			// the iterator stays on the stack until the loop quits
+			iterator, ok := vm.peek().(*IteratorObject)
+			if !ok {
+				return NewTypeError("'%s' object is not an iterator", vm.peek().TypeName())
+			}
+			if value, ok := iterator.Next(); ok {
+				vm.push(value)
+			} else {
+				ctx.ip = int(operand) - 1
+			}
 		case OpClosure:
 			closure, err := vm.makeClosure(vm.pop())
 			if err != nil {
@@ -153,7 +264,7 @@ func (vm *VM) execute() error {
 			}
 			vm.push(closure)
 		case OpCall:
-			if err := vm.call(vm.pop(), int(inst.Operand())); err != nil {
+			if err := vm.call(vm.pop(), int(operand)); err != nil {
 				return err
 			}
 		case OpReturn:
@@ -163,10 +274,21 @@ func (vm *VM) execute() error {
 			vm.push(result)
 			ctx.fp--
 			ctx.currentFrame = ctx.frames[ctx.fp]
+			if ctx.fp == vm.baseFp {
+				// back in the caller of Prepare
+				return nil
+			}
 		case OpRemoveTop:
 			vm.pop()
+		case OpCopy:
+			obj := vm.pop()
+			value, err := obj.Copy()
+			if err != nil {
+				return typeError(err, "'%s' object can't be copied", obj.TypeName())
+			}
+			vm.push(value)
 		case OpImport:
-			// modulePath := ctx.constants[inst.Operand()].(*StringObject).Value
+			// modulePath := ctx.currentFrame.fn.Constants[operand].(*StringObject).Value
 			// moduleAbsolute, err := filepath.Abs(filepath.Join(ctx.ImportBasePath, modulePath))
 			// if err != nil {
 			// 	return err
@@ -190,7 +312,6 @@ func (vm *VM) execute() error {
 			// if compiler.Err != nil {
 			// 	return err
 			// }
-			// compiled.PrintInstructionList()
 			// _, err = NewVM(ctx).ExecuteWithCompiledFunction(compiled.EntryFunction)
 			// if err != nil {
 			// 	return err
@@ -211,8 +332,48 @@ func (vm *VM) execute() error {
 			ctx.fp--
 			ctx.currentFrame = ctx.frames[ctx.fp]
 			return nil
+		case OpIncLocalConst:
+			code := ctx.currentFrame.fn.Instructions
+			index := int(operand)
+			obj, err := fastBinaryOp(OpBinaryAdd, vm.getLocal(index), ctx.currentFrame.fn.Constants[code[ctx.ip+1].Operand()])
+			if err != nil {
+				ctx.ip += 2
+				return err
+			}
+			vm.setLocal(index, obj)
+			ctx.ip += 3
+		case OpBinaryLocalConst:
+			code := ctx.currentFrame.fn.Instructions
+			opcode := code[ctx.ip+2].Opcode()
+			obj, err := fastBinaryOp(opcode, vm.getLocal(int(operand)), ctx.currentFrame.fn.Constants[code[ctx.ip+1].Operand()])
+			if err != nil {
+				ctx.ip += 2
+				return err
+			}
+			vm.push(obj)
+			ctx.ip += 2
+		case OpCompareLocalConstJump, OpCompareLocalsJump:
+			code := ctx.currentFrame.fn.Instructions
+			var y Object
+			if inst.Opcode() == OpCompareLocalsJump {
+				y = vm.getLocal(int(code[ctx.ip+1].Operand()))
+			} else {
+				y = ctx.currentFrame.fn.Constants[code[ctx.ip+1].Operand()]
+			}
+			obj, err := fastBinaryOp(code[ctx.ip+2].Opcode(), vm.getLocal(int(operand)), y)
+			if err != nil {
+				ctx.ip += 2
+				return err
+			}
+			if obj.ToBool() {
+				ctx.ip += 3
+			} else {
+				ctx.ip = int(code[ctx.ip+3].Operand()) - 1
+			}
 		case OpDebugger:
-			fmt.Println("debugger")
+			if ctx.debugger != nil && ctx.debugger.pause(PauseDebugger) {
+				return ErrAborted
+			}
 		default:
 			return ErrInvalidOpcode
 		}
@@ -220,7 +381,18 @@ func (vm *VM) execute() error {
 	return nil
 }
 
-func (vm *VM) unaryOp(opcode Opcode, x Object) (Object, error) {
+func unaryOp(opcode Opcode, x Object) (Object, error) {
+	result, err := doUnaryOp(opcode, x)
+	if err == ErrNotImplemented && opcode == OpUnaryNot {
+		return FromBool(!x.ToBool()), nil
+	}
+	if err != nil {
+		return nil, typeError(err, "bad operand type for unary %s: '%s'", operators[opcode], x.TypeName())
+	}
+	return result, nil
+}
+
+func doUnaryOp(opcode Opcode, x Object) (Object, error) {
 	switch opcode {
 	case OpUnaryBitNot:
 		return x.UnaryBitNot()
@@ -235,7 +407,55 @@ func (vm *VM) unaryOp(opcode Opcode, x Object) (Object, error) {
 	}
 }
 
-func (vm *VM) binaryOp(opcode Opcode, left, right Object) (Object, error) {
+// fastBinaryOp computes the common operations on ints and strings inline,
+// superinstructions use it to skip the method dispatch of binaryOp.
+func fastBinaryOp(opcode Opcode, left, right Object) (Object, error) {
+	switch x := left.(type) {
+	case *IntObject:
+		if y, ok := right.(*IntObject); ok {
+			switch opcode {
+			case OpBinaryAdd:
+				return NewInt(x.Value + y.Value), nil
+			case OpBinarySub:
+				return NewInt(x.Value - y.Value), nil
+			case OpBinaryMul:
+				return NewInt(x.Value * y.Value), nil
+			case OpBinaryLT:
+				return FromBool(x.Value < y.Value), nil
+			case OpBinaryLTE:
+				return FromBool(x.Value <= y.Value), nil
+			case OpBinaryGT:
+				return FromBool(x.Value > y.Value), nil
+			case OpBinaryGTE:
+				return FromBool(x.Value >= y.Value), nil
+			case OpBinaryEQ:
+				return FromBool(x.Value == y.Value), nil
+			case OpBinaryNEQ:
+				return FromBool(x.Value != y.Value), nil
+			}
+		}
+	case *StringObject:
+		if y, ok := right.(*StringObject); ok {
+			switch opcode {
+			case OpBinaryEQ:
+				return FromBool(x.Value == y.Value), nil
+			case OpBinaryNEQ:
+				return FromBool(x.Value != y.Value), nil
+			}
+		}
+	}
+	return binaryOp(opcode, left, right)
+}
+
+func binaryOp(opcode Opcode, left, right Object) (Object, error) {
+	result, err := doBinaryOp(opcode, left, right)
+	if err != nil {
+		return nil, typeError(err, "unsupported operand type(s) for %s: '%s' and '%s'", operators[opcode], left.TypeName(), right.TypeName())
+	}
+	return result, nil
+}
+
+func doBinaryOp(opcode Opcode, left, right Object) (Object, error) {
 	switch opcode {
 	case OpBinaryAdd:
 		return left.BinaryAdd(right)
@@ -259,6 +479,8 @@ func (vm *VM) binaryOp(opcode Opcode, left, right Object) (Object, error) {
 		return left.BinaryEq(right)
 	case OpBinaryNEQ:
 		return left.BinaryNeq(right)
+	case OpBinaryIs:
+		return FromBool(left == right), nil
 	case OpBinaryBitAnd:
 		return left.BinaryBitAnd(right)
 	case OpBinaryBitOr:
@@ -290,8 +512,11 @@ func (vm *VM) buildDict(count int) error {
 	m := make(map[string]Object)
 	for i := 0; i < count; i++ {
 		value := vm.pop()
-		key := vm.pop()
-		m[key.(*StringObject).Value] = value
+		key, ok := vm.pop().(*StringObject)
+		if !ok {
+			return NewTypeError("dict keys must be strings")
+		}
+		m[key.Value] = value
 	}
 	vm.push(&DictObject{
 		Value: m,
@@ -299,9 +524,19 @@ func (vm *VM) buildDict(count int) error {
 	return nil
 }
 
+// attributeName returns the name pushed for OpLoadAttribute and
+// OpStoreAttribute.
+func attributeName(obj Object) (string, error) {
+	name, ok := obj.(*StringObject)
+	if !ok {
+		return "", NewTypeError("attribute name must be a string, not '%s'", obj.TypeName())
+	}
+	return name.Value, nil
+}
+
 func (vm *VM) call(callee Object, argc int) error {
 	if !callee.Callable() {
-		return fmt.Errorf("can't call object: %s", callee.TypeName())
+		return NewTypeError("'%s' object is not callable", callee.TypeName())
 	}
 
 	var args []Object = nil
@@ -327,34 +562,47 @@ func (vm *VM) call(callee Object, argc int) error {
 }
 
 func (vm *VM) makeClosure(fn Object) (*ClosureObject, error) {
+	return vm.makeClosureIn(fn, vm.ctx.currentFrame)
+}
+
+// makeClosureIn captures the outers of fn from frame.
+func (vm *VM) makeClosureIn(fn Object, frame *CallFrame) (*ClosureObject, error) {
 	compiledFn, ok := fn.(*CompiledFunctionObject)
 	if !ok {
 		return nil, fmt.Errorf("is not a compiled-function: %s", fn.TypeName())
 	}
+	if err := vm.ctx.Verify(compiledFn); err != nil {
+		return nil, err
+	}
 	numOuters := compiledFn.SymbolTable.OuterCount
 	outers := make([]Object, numOuters)
 	if numOuters > 0 {
 		for _, symbol := range compiledFn.SymbolTable.Symbols {
 			if symbol.Scope == ScopeOuter {
+				// the enclosing function is only known now
+				if symbol.OuterScope == ScopeLocal && symbol.OuterIndex >= frame.fn.SymbolTable.LocalCount ||
+					symbol.OuterScope == ScopeOuter && symbol.OuterIndex >= len(frame.outers) {
+					return nil, fmt.Errorf("'%s' captures '%s' which isn't in scope", compiledFn.Name, symbol.Name)
+				}
 				if symbol.OuterScope == ScopeLocal {
-					switch obj := vm.ctx.stack[vm.ctx.currentFrame.bp+symbol.OuterIndex].(type) {
+					switch obj := vm.ctx.stack[frame.bp+symbol.OuterIndex].(type) {
 					case *ObjectRef:
 						outers[symbol.Index] = obj
 					default:
 						outers[symbol.Index] = &ObjectRef{
 							Value: obj,
 						}
-						vm.ctx.stack[vm.ctx.currentFrame.bp+symbol.OuterIndex] = outers[symbol.Index]
+						vm.ctx.stack[frame.bp+symbol.OuterIndex] = outers[symbol.Index]
 					}
 				} else if symbol.OuterScope == ScopeOuter {
-					switch obj := vm.ctx.currentFrame.outers[symbol.OuterIndex].(type) {
+					switch obj := frame.outers[symbol.OuterIndex].(type) {
 					case *ObjectRef:
 						outers[symbol.Index] = obj
 					default:
 						outers[symbol.Index] = &ObjectRef{
 							Value: obj,
 						}
-						vm.ctx.currentFrame.outers[symbol.OuterIndex] = outers[symbol.Index]
+						frame.outers[symbol.OuterIndex] = outers[symbol.Index]
 					}
 				}
 			}
@@ -375,6 +623,9 @@ func (vm *VM) callCompiledFunction(fn *CompiledFunctionObject, args []Object) er
 }
 
 func (vm *VM) callClosure(closure *ClosureObject, args []Object) error {
+	if err := vm.ctx.Verify(closure.Fn); err != nil {
+		return err
+	}
 	frame := &CallFrame{
 		fn:     closure.Fn,
 		outers: closure.Outers,
@@ -382,15 +633,21 @@ func (vm *VM) callClosure(closure *ClosureObject, args []Object) error {
 		bp:     vm.ctx.sp,
 	}
 
-	vm.ctx.sp += closure.Fn.SymbolTable.LocalCount
-
-	if vm.ctx.sp >= MaxStackSize {
+	// the verifier computed how deep the operands of the function go
+	if vm.ctx.fp+1 >= MaxCallFrameSize || vm.ctx.sp+closure.Fn.SymbolTable.LocalCount+closure.Fn.maxDepth >= MaxStackSize {
 		return ErrStackOverflow
 	}
 
+	vm.ctx.sp += closure.Fn.SymbolTable.LocalCount
+
 	if len(args) > 0 {
 		copy(vm.ctx.stack[frame.bp:frame.bp+len(args)], args)
 	}
+	// the slots hold what the stack held before, locals not assigned yet
+	// must not show it
+	for i := frame.bp + len(args); i < vm.ctx.sp; i++ {
+		vm.ctx.stack[i] = nil
+	}
 
 	vm.ctx.fp++
 	vm.ctx.frames[vm.ctx.fp] = frame
@@ -401,12 +658,15 @@ func (vm *VM) callClosure(closure *ClosureObject, args []Object) error {
 }
 
 func (vm *VM) callBuiltinFunction(fn *BuiltinFunctionObject, args []Object) error {
-	if fn.NumParameters != len(args) {
+	if fn.NumParameters != VariadicParameters && fn.NumParameters != len(args) {
 		return ErrWrongNumberArguments
 	}
+	// currentBuiltin stays set on failure, the traceback reports it
+	vm.ctx.currentBuiltin = fn
 	if result, err := fn.Fn(vm.ctx, args); err != nil {
 		return err
 	} else {
+		vm.ctx.currentBuiltin = nil
 		vm.push(result)
 		return nil
 	}
@@ -429,10 +689,13 @@ func (vm *VM) peek() Object {
 func (vm *VM) getLocal(index int) Object {
 	value := vm.ctx.stack[vm.ctx.currentFrame.bp+index]
 	if ref, ok := value.(*ObjectRef); ok {
-		return ref.Value
-	} else {
-		return value
+		value = ref.Value
+	}
+	if value == nil {
+		// not assigned yet, only bytecode built elsewhere reads it
+		return Null
 	}
+	return value
 }
 
 func (vm *VM) setLocal(index int, value Object) {
@@ -446,10 +709,12 @@ func (vm *VM) setLocal(index int, value Object) {
 func (vm *VM) getOuter(index int) Object {
 	value := vm.ctx.currentFrame.outers[index]
 	if ref, ok := value.(*ObjectRef); ok {
-		return ref.Value
-	} else {
-		return value
+		value = ref.Value
+	}
+	if value == nil {
+		return Null
 	}
+	return value
 }
 
 func (vm *VM) setOuter(index int, value Object) {